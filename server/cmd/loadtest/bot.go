@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// loadTest 一次压测，负责创建牌桌并汇总统计
+type loadTest struct {
+	base   *url.URL
+	config config
+	client *http.Client
+	dialer *websocket.Dialer
+	stats  *stats
+	active atomic.Int64 // 进行中的牌桌数
+}
+
+// newLoadTest 创建压测
+func newLoadTest(base *url.URL, config config) *loadTest {
+	return &loadTest{
+		base:   base,
+		config: config,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{MaxIdleConnsPerHost: 100},
+		},
+		dialer: &websocket.Dialer{HandshakeTimeout: 10 * time.Second},
+		stats:  newStats(),
+	}
+}
+
+// run 在预热时间内均匀地开出所有牌桌，等到全部打完或被取消
+func (lt *loadTest) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	step := lt.config.rampUp / time.Duration(lt.config.tables)
+
+	for i := 0; i < lt.config.tables; i++ {
+		if i > 0 && step > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(step):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			lt.playTable(ctx, index)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// reportProgress 定期打印进度
+func (lt *loadTest) reportProgress(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			messages, finished, drops := lt.stats.progress()
+			log.Printf("进行中 %d 桌，已完成 %d 局，收到 %d 条消息，掉线 %d", lt.active.Load(), finished, messages, drops)
+		}
+	}
+}
+
+// playTable 创建一张牌桌，所有机器人入座连接后打完指定局数
+func (lt *loadTest) playTable(ctx context.Context, index int) {
+	t := &table{lt: lt, stop: make(chan struct{})}
+	t.markAction()
+
+	// 创建者入座成为房主，其余机器人加入
+	body := map[string]interface{}{
+		"playerName":    fmt.Sprintf("bot%d-0", index),
+		"mode":          lt.config.settings.Mode,
+		"startingLives": lt.config.settings.StartingLives,
+		"maxRounds":     lt.config.settings.MaxRounds,
+		"bestOf":        lt.config.settings.BestOf,
+	}
+	result, err := lt.post(ctx, "/api/games", body["playerName"].(string), body)
+	if err != nil {
+		lt.stats.failure("创建游戏失败: " + err.Error())
+		return
+	}
+	gameID := result["gameId"]
+	t.bots = append(t.bots, &bot{table: t, name: body["playerName"].(string), playerID: result["playerId"], host: true})
+
+	for seat := 1; seat < lt.config.players; seat++ {
+		name := fmt.Sprintf("bot%d-%d", index, seat)
+		result, err := lt.post(ctx, "/api/games/join", name, map[string]string{"gameId": gameID, "playerName": name})
+		if err != nil {
+			lt.stats.failure("加入游戏失败: " + err.Error())
+			return
+		}
+		t.bots = append(t.bots, &bot{table: t, name: name, playerID: result["playerId"]})
+	}
+
+	// 依次建立WebSocket连接
+	for _, b := range t.bots {
+		if err := b.connect(gameID); err != nil {
+			lt.stats.failure("连接失败: " + err.Error())
+			t.close()
+			return
+		}
+		go b.readLoop()
+	}
+
+	lt.active.Add(1)
+	defer lt.active.Add(-1)
+
+	// 等所有机器人打完，任何一个掉线或压测被取消时结束整桌
+	finished := make(chan struct{})
+	go func() {
+		for _, b := range t.bots {
+			<-b.done
+		}
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-t.stop:
+	case <-ctx.Done():
+	}
+	t.close()
+	<-finished
+}
+
+// post 以 user 的身份发送JSON请求并解析返回的对象，被限流时按 Retry-After 等待后重试
+func (lt *loadTest) post(ctx context.Context, path string, user string, body interface{}) (map[string]string, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, lt.base.JoinPath(path).String(), bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+user)
+		resp, err := lt.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			if wait, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				resp.Body.Close()
+				lt.stats.failure("被限流后重试: " + path)
+				select {
+				case <-time.After(time.Duration(wait) * time.Second):
+					continue
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			message, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+			return nil, fmt.Errorf("%d %s", resp.StatusCode, strings.TrimSpace(string(message)))
+		}
+		result := make(map[string]string)
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+}
+
+// wsURL 返回连接指定游戏的WebSocket地址
+func (lt *loadTest) wsURL(gameID string, playerID string) string {
+	u := lt.base.JoinPath("/ws")
+	u.Scheme = "ws"
+	if lt.base.Scheme == "https" {
+		u.Scheme = "wss"
+	}
+	u.RawQuery = url.Values{"gameId": {gameID}, "playerId": {playerID}}.Encode()
+	return u.String()
+}
+
+// table 一张牌桌上的机器人
+type table struct {
+	lt       *loadTest
+	bots     []*bot
+	action   atomic.Int64 // 最近一次客户端请求的时间（纳秒）
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// markAction 记录一次客户端请求的时间
+func (t *table) markAction() {
+	t.action.Store(time.Now().UnixNano())
+}
+
+// sinceAction 返回距最近一次客户端请求的时间
+func (t *table) sinceAction() time.Duration {
+	return time.Duration(time.Now().UnixNano() - t.action.Load())
+}
+
+// abort 有机器人掉线时结束整桌，以免其余机器人一直等待
+func (t *table) abort() {
+	t.stopOnce.Do(func() { close(t.stop) })
+}
+
+// close 断开所有机器人
+func (t *table) close() {
+	for _, b := range t.bots {
+		b.stop()
+	}
+}
+
+// bot 一名机器人玩家，轮到自己时出牌或质疑，打完指定局数后断开
+type bot struct {
+	table    *table
+	name     string
+	playerID string
+	host     bool
+	conn     *websocket.Conn
+	done     chan struct{}
+	writeMu  sync.Mutex
+	stopped  atomic.Bool // 主动断开，之后的读取错误不算掉线
+
+	// 以下字段只在 readLoop 中访问
+	ready   bool                   // 已发送准备
+	started bool                   // 房主已请求开始
+	prompt  map[string]interface{} // 还没处理的出牌或质疑请求
+	games   int                    // 已打完的局数
+}
+
+// connect 建立WebSocket连接
+func (b *bot) connect(gameID string) error {
+	b.table.markAction()
+	conn, _, err := b.table.lt.dialer.Dial(b.table.lt.wsURL(gameID, b.playerID), nil)
+	if err != nil {
+		return err
+	}
+	b.conn = conn
+	b.done = make(chan struct{})
+	b.table.lt.stats.connected()
+	return nil
+}
+
+// readLoop 读取消息并记录延迟，直到连接断开
+func (b *bot) readLoop() {
+	defer close(b.done)
+
+	for {
+		_, data, err := b.conn.ReadMessage()
+		if err != nil {
+			if !b.stopped.Load() {
+				b.table.lt.stats.drop()
+				b.table.abort()
+			}
+			return
+		}
+		latency := b.table.sinceAction()
+
+		var message map[string]interface{}
+		if err := json.Unmarshal(data, &message); err != nil {
+			b.table.lt.stats.failure("无效的消息")
+			continue
+		}
+		messageType, _ := message["type"].(string)
+		b.table.lt.stats.observe(messageType, latency)
+
+		b.handle(messageType, message)
+	}
+}
+
+// handle 根据收到的消息决定下一步行动
+func (b *bot) handle(messageType string, message map[string]interface{}) {
+	switch messageType {
+	case "error":
+		text, _ := message["message"].(string)
+		b.table.lt.stats.failure(text)
+
+	case "your_turn", "challenge_request":
+		// 等同一次操作最后广播的游戏状态到达后再行动，以免用到过时的手牌
+		b.prompt = message
+
+	case "game_state":
+		state, _ := message["state"].(map[string]interface{})
+		b.onState(state)
+
+	case "game_over":
+		b.games++
+		if b.host {
+			b.table.lt.stats.gameOver()
+		}
+		if b.games >= b.table.lt.config.games {
+			b.stop()
+			return
+		}
+		b.sendLater(map[string]interface{}{"type": "rematch", "accept": true})
+	}
+}
+
+// onState 收到游戏状态后准备、开始游戏或回应出牌和质疑请求
+func (b *bot) onState(state map[string]interface{}) {
+	if state == nil {
+		return
+	}
+
+	if !b.ready {
+		b.ready = true
+		b.sendLater(map[string]interface{}{"type": "ready", "ready": true})
+		return
+	}
+
+	// 满员时所有人准备后会自动开始，人数不足时由房主开始
+	if b.host && !b.started && state["state"] == "waiting" && allReady(state, b.table.lt.config.players) {
+		b.started = true
+		b.sendLater(map[string]interface{}{"type": "start_game"})
+		return
+	}
+
+	if b.prompt == nil {
+		return
+	}
+	prompt := b.prompt
+	b.prompt = nil
+
+	if prompt["type"] == "challenge_request" {
+		// 单张出牌总是质疑，其他情况三分之一的概率质疑
+		challenge := prompt["cardCount"] == float64(1) || rand.Intn(3) == 0
+		b.sendLater(map[string]interface{}{"type": "challenge", "challenge": challenge})
+		return
+	}
+	b.sendLater(map[string]interface{}{"type": "play_cards", "cards": chooseCards(state, b.playerID)})
+}
+
+// sendLater 思考一段时间后发送消息
+func (b *bot) sendLater(message map[string]interface{}) {
+	time.AfterFunc(b.table.lt.config.think, func() {
+		b.send(message)
+	})
+}
+
+// send 发送一条消息并记录请求时间
+func (b *bot) send(message map[string]interface{}) {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+
+	if b.stopped.Load() {
+		return
+	}
+	b.table.markAction()
+	// 发送失败时连接已断开，由 readLoop 记录掉线
+	b.conn.WriteJSON(message)
+}
+
+// stop 主动断开连接
+func (b *bot) stop() {
+	if b.conn == nil || b.stopped.Swap(true) {
+		return
+	}
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+
+	b.conn.Close()
+}
+
+// allReady 检查牌桌是否已坐满指定人数且所有人都已准备
+func allReady(state map[string]interface{}, players int) bool {
+	seated, _ := state["players"].(map[string]interface{})
+	if len(seated) != players {
+		return false
+	}
+	for _, p := range seated {
+		player, _ := p.(map[string]interface{})
+		if player["ready"] != true {
+			return false
+		}
+	}
+	return true
+}
+
+// chooseCards 出牌策略：打出所有目标牌和大王（最多3张），没有时打出第一张牌
+func chooseCards(state map[string]interface{}, playerID string) []string {
+	targetCard, _ := state["targetCard"].(string)
+	seated, _ := state["players"].(map[string]interface{})
+	me, _ := seated[playerID].(map[string]interface{})
+	hand, _ := me["hand"].([]interface{})
+
+	cards := make([]string, 0, 3)
+	for _, c := range hand {
+		if card, _ := c.(string); (card == targetCard || card == "Joker") && len(cards) < 3 {
+			cards = append(cards, card)
+		}
+	}
+	if len(cards) == 0 && len(hand) > 0 {
+		if card, ok := hand[0].(string); ok {
+			cards = append(cards, card)
+		}
+	}
+	return cards
+}
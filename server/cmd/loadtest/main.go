@@ -0,0 +1,137 @@
+// loadtest 对本机运行的服务器进行压力测试：通过 /api/games 批量创建牌桌，
+// 每桌的机器人玩家通过 /ws 连接并打完游戏，结束后按服务器→客户端的消息类型
+// 报告延迟分位数、掉线的连接数和收到的错误消息。
+//
+// 延迟是从同一桌最近一次客户端请求（连接、准备、出牌、质疑等）到收到消息的时间。
+// 倒计时以及开枪后的停顿由服务器定时器驱动，这些消息的延迟包含等待时间，
+// 压测时建议以 -result-delay 0 启动服务器。
+//
+// 每个机器人以自己的名字作为用户令牌。服务器按IP限制创建和加入游戏的频率
+// 以及同时进行的游戏数，被限流时按 Retry-After 等待后重试，并在报告中计入失败；
+// 大规模压测时建议在配置文件中把 limits.createGame 和 limits.joinGame 的 rate
+// 以及 limits.maxGamesPerIP 设为0。
+//
+// 用法:
+//
+//	go run ./cmd/loadtest -tables 1000 -players 4 -think 50ms
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"server/rules"
+)
+
+var (
+	serverURL = flag.String("server", "http://127.0.0.1:8080", "服务器地址，只允许本机")
+	tables    = flag.Int("tables", 100, "牌桌数量")
+	players   = flag.Int("players", 3, "每桌玩家数")
+	games     = flag.Int("games", 1, "每桌连续进行的局数，大于1时通过再来一局继续")
+	think     = flag.Duration("think", 100*time.Millisecond, "机器人每次行动前的思考时间")
+	rampUp    = flag.Duration("ramp-up", 10*time.Second, "在这段时间内均匀地创建所有牌桌")
+	duration  = flag.Duration("duration", 0, "最长运行时间，0表示等所有牌桌打完")
+	progress  = flag.Duration("progress", 5*time.Second, "打印进度的间隔，0表示不打印")
+	mode      = flag.String("mode", rules.GameModeSuddenDeath, "游戏模式")
+	lives     = flag.Int("lives", rules.DefaultStartingLives, "生命模式的初始命数")
+	maxRounds = flag.Int("max-rounds", 0, "最大轮数，0表示不限")
+)
+
+func main() {
+	flag.Parse()
+
+	config := config{
+		tables:  *tables,
+		players: *players,
+		games:   *games,
+		think:   *think,
+		rampUp:  *rampUp,
+		settings: rules.Settings{
+			Mode:          *mode,
+			StartingLives: *lives,
+			MaxRounds:     *maxRounds,
+			BestOf:        1,
+		},
+	}
+	if config.settings.Mode == rules.GameModeSuddenDeath {
+		config.settings.StartingLives = 1
+	}
+	if err := config.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	base, err := localServer(*serverURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// 收到中断信号或超过最长运行时间时断开所有机器人，仍然输出报告
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	lt := newLoadTest(base, config)
+	if *progress > 0 {
+		go lt.reportProgress(ctx, *progress)
+	}
+
+	start := time.Now()
+	log.Printf("开始压测 %s: %d 桌，每桌 %d 名玩家", base, config.tables, config.players)
+	lt.run(ctx)
+	lt.stats.report(os.Stdout, time.Since(start))
+}
+
+// config 压测参数
+type config struct {
+	tables   int
+	players  int
+	games    int
+	think    time.Duration
+	rampUp   time.Duration
+	settings rules.Settings
+}
+
+// validate 检查压测参数
+func (c config) validate() error {
+	if c.tables < 1 {
+		return fmt.Errorf("牌桌数量至少为1")
+	}
+	if c.players < rules.MinPlayers || c.players > rules.MaxPlayers {
+		return fmt.Errorf("每桌玩家数必须在%d到%d之间", rules.MinPlayers, rules.MaxPlayers)
+	}
+	if c.games < 1 {
+		return fmt.Errorf("每桌局数至少为1")
+	}
+	return c.settings.Validate()
+}
+
+// localServer 解析服务器地址，只接受解析到本机回环地址的主机
+func localServer(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, fmt.Errorf("无效的服务器地址: %s", raw)
+	}
+
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("无法解析服务器地址 %s: %v", u.Hostname(), err)
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() {
+			return nil, fmt.Errorf("只能压测本机服务器，%s 解析到了 %s", u.Hostname(), ip)
+		}
+	}
+	return u, nil
+}
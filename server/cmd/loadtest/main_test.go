@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLocalServer 只接受本机地址
+func TestLocalServer(t *testing.T) {
+	for _, raw := range []string{"http://127.0.0.1:8080", "http://localhost:8080", "https://[::1]"} {
+		if _, err := localServer(raw); err != nil {
+			t.Errorf("%s 应被接受: %v", raw, err)
+		}
+	}
+	for _, raw := range []string{"http://10.0.0.1:8080", "http://192.168.1.2", "ws://127.0.0.1", "127.0.0.1:8080", ""} {
+		if _, err := localServer(raw); err == nil {
+			t.Errorf("%s 应被拒绝", raw)
+		}
+	}
+}
+
+// TestPercentile 最近秩法的分位数
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	cases := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, c := range cases {
+		if got := percentile(sorted, c.p); got != c.want {
+			t.Errorf("p%v: 期望 %v，实际 %v", c.p, c.want, got)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("空数据: %v", got)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// stats 汇总所有机器人的观测结果
+type stats struct {
+	mu          sync.Mutex
+	latencies   map[string][]time.Duration // 每种消息类型的延迟
+	failures    map[string]int             // 错误消息和请求失败，按内容计数
+	connections int
+	drops       int
+	games       int
+}
+
+// newStats 创建空的统计
+func newStats() *stats {
+	return &stats{
+		latencies: make(map[string][]time.Duration),
+		failures:  make(map[string]int),
+	}
+}
+
+// observe 记录收到一条消息
+func (s *stats) observe(messageType string, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latencies[messageType] = append(s.latencies[messageType], latency)
+}
+
+// failure 记录一条错误消息或失败的请求
+func (s *stats) failure(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[message]++
+}
+
+// connected 记录建立了一个连接
+func (s *stats) connected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connections++
+}
+
+// drop 记录一个意外断开的连接
+func (s *stats) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.drops++
+}
+
+// gameOver 记录打完一局
+func (s *stats) gameOver() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.games++
+}
+
+// progress 返回目前收到的消息数、打完的局数和掉线数
+func (s *stats) progress() (messages int, games int, drops int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, latencies := range s.latencies {
+		messages += len(latencies)
+	}
+	return messages, s.games, s.drops
+}
+
+// report 输出每种消息类型的延迟分位数、掉线数和错误消息
+func (s *stats) report(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(w, "\n运行 %s，打完 %d 局，连接 %d 个，掉线 %d 个\n\n",
+		elapsed.Round(time.Millisecond), s.games, s.connections, s.drops)
+
+	types := make([]string, 0, len(s.latencies))
+	for messageType := range s.latencies {
+		types = append(types, messageType)
+	}
+	sort.Strings(types)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "消息类型\t数量\tp50\tp90\tp99\t最大\t")
+	for _, messageType := range types {
+		latencies := s.latencies[messageType]
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t\n", messageType, len(latencies),
+			formatLatency(percentile(latencies, 50)),
+			formatLatency(percentile(latencies, 90)),
+			formatLatency(percentile(latencies, 99)),
+			formatLatency(latencies[len(latencies)-1]))
+	}
+	tw.Flush()
+
+	if len(s.failures) == 0 {
+		return
+	}
+
+	// 错误按出现次数从多到少排列
+	messages := make([]string, 0, len(s.failures))
+	for message := range s.failures {
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if s.failures[messages[i]] != s.failures[messages[j]] {
+			return s.failures[messages[i]] > s.failures[messages[j]]
+		}
+		return messages[i] < messages[j]
+	})
+	fmt.Fprintln(w, "\n错误消息:")
+	for _, message := range messages {
+		fmt.Fprintf(w, "%8d  %s\n", s.failures[message], message)
+	}
+}
+
+// percentile 按最近秩法返回已排序延迟的第p百分位数
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// formatLatency 以毫秒为单位格式化延迟
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
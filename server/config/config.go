@@ -0,0 +1,435 @@
+// Package config 加载服务器配置：默认值、配置文件和环境变量依次覆盖，最后统一校验
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/game"
+	"server/logging"
+	"server/rules"
+)
+
+// EnvPrefix 环境变量名的前缀，例如 LIARS_BAR_ADDR
+const EnvPrefix = "LIARS_BAR_"
+
+// Duration 在配置文件中写作 "30s"、"5m" 这样的时长
+type Duration time.Duration
+
+// MarshalText 实现 encoding.TextMarshaler
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config 服务器的完整配置
+type Config struct {
+	Addr           string `json:"addr" env:"ADDR"`                      // 服务地址
+	StaticDir      string `json:"staticDir" env:"STATIC_DIR"`           // 从磁盘读取网页客户端的目录，为空则使用编译进二进制的文件
+	AdminToken     string `json:"adminToken" env:"ADMIN_TOKEN"`         // 管理接口的令牌，为空则关闭管理功能
+	IdentitySecret string `json:"identitySecret" env:"IDENTITY_SECRET"` // 签发玩家身份令牌的密钥，为空则每次启动随机生成，重启后之前签发的身份全部失效
+
+	TLS       TLS       `json:"tls"`
+	HTTP      HTTP      `json:"http"`
+	Log       Log       `json:"log"`
+	WebSocket WebSocket `json:"websocket"`
+	Games     Games     `json:"games"`
+	Storage   Storage   `json:"storage"`
+	Limits    Limits    `json:"limits"`
+	Names     Names     `json:"names"`
+	Chat      Chat      `json:"chat"`
+	Rules     Rules     `json:"rules"`
+}
+
+// TLS 证书配置，同时给出证书和私钥时以 HTTPS/WSS 提供服务
+type TLS struct {
+	CertFile     string `json:"certFile" env:"TLS_CERT_FILE"`
+	KeyFile      string `json:"keyFile" env:"TLS_KEY_FILE"`
+	RedirectAddr string `json:"redirectAddr" env:"TLS_REDIRECT_ADDR"` // 在这个地址上把HTTP请求重定向到HTTPS，为空则不监听
+}
+
+// Enabled 是否启用TLS
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// HTTP 服务器超时配置，不限制整个请求的读写时间，否则会断开长连接的WebSocket
+type HTTP struct {
+	ReadHeaderTimeout Duration `json:"readHeaderTimeout" env:"HTTP_READ_HEADER_TIMEOUT"` // 读取请求头的最长时间
+	IdleTimeout       Duration `json:"idleTimeout" env:"HTTP_IDLE_TIMEOUT"`              // keep-alive 连接空闲多久后关闭
+}
+
+// Log 日志配置
+type Log struct {
+	Format string     `json:"format" env:"LOG_FORMAT"` // text 或 json
+	Level  slog.Level `json:"level" env:"LOG_LEVEL"`   // debug、info、warn 或 error
+	Debug  bool       `json:"debug" env:"DEBUG"`       // 日志中显示手牌、目标牌和子弹位置
+}
+
+// WebSocket 连接配置
+type WebSocket struct {
+	ReadBufferSize  int      `json:"readBufferSize" env:"WS_READ_BUFFER_SIZE"`
+	WriteBufferSize int      `json:"writeBufferSize" env:"WS_WRITE_BUFFER_SIZE"`
+	AllowedOrigins  []string `json:"allowedOrigins" env:"WS_ALLOWED_ORIGINS"`  // 允许的 Origin，"*" 表示全部允许
+	MaxMessageSize  int      `json:"maxMessageSize" env:"WS_MAX_MESSAGE_SIZE"` // 客户端单条消息的最大字节数，超过时断开连接
+}
+
+// Games 游戏管理配置
+type Games struct {
+	MaxGames        int      `json:"maxGames" env:"MAX_GAMES"`     // 同时存在的游戏数上限，0表示不限
+	MaxPlayers      int      `json:"maxPlayers" env:"MAX_PLAYERS"` // 每桌最多人数
+	WaitingTTL      Duration `json:"waitingTTL" env:"WAITING_TTL"`
+	AbandonedTTL    Duration `json:"abandonedTTL" env:"ABANDONED_TTL"`
+	FinishedTTL     Duration `json:"finishedTTL" env:"FINISHED_TTL"`
+	JanitorInterval Duration `json:"janitorInterval" env:"JANITOR_INTERVAL"`
+	ResultDelay     Duration `json:"resultDelay" env:"RESULT_DELAY"`
+	CountdownTick   Duration `json:"countdownTick" env:"COUNTDOWN_TICK"`
+	DrainTimeout    Duration `json:"drainTimeout" env:"DRAIN_TIMEOUT"` // 关闭时等待进行中的一轮结束的最长时间
+}
+
+// Storage 归档和快照配置
+type Storage struct {
+	ArchiveDir       string   `json:"archiveDir" env:"ARCHIVE_DIR"`   // 为空则不归档
+	SnapshotDir      string   `json:"snapshotDir" env:"SNAPSHOT_DIR"` // 为空则不保存快照
+	SnapshotInterval Duration `json:"snapshotInterval" env:"SNAPSHOT_INTERVAL"`
+	ProfileDir       string   `json:"profileDir" env:"PROFILE_DIR"` // 玩家战绩目录，为空则战绩只保存在内存中
+}
+
+// Limits 限流配置，速率为0表示不限流，限流参数只能在配置文件中设置
+type Limits struct {
+	CreateGame      game.RateLimit `json:"createGame"` // 每个IP和每个用户创建游戏的频率
+	JoinGame        game.RateLimit `json:"joinGame"`   // 每个IP和每个用户加入游戏的频率
+	Messages        game.RateLimit `json:"messages"`   // 每个WebSocket连接发送消息的频率
+	MaxGamesPerUser int            `json:"maxGamesPerUser" env:"MAX_GAMES_PER_USER"`
+	MaxGamesPerIP   int            `json:"maxGamesPerIP" env:"MAX_GAMES_PER_IP"`
+	TrustedProxies  []string       `json:"trustedProxies" env:"TRUSTED_PROXIES"` // 可信反向代理的IP或CIDR，为空时按连接地址限流，部署在代理后面时必须配置
+}
+
+// Names 玩家名字的规则
+type Names struct {
+	MaxLength  int      `json:"maxLength" env:"NAME_MAX_LENGTH"`  // 最多字符数
+	Duplicates string   `json:"duplicates" env:"NAME_DUPLICATES"` // 同桌重名时 suffix 自动加编号，reject 拒绝
+	Blocklist  []string `json:"blocklist" env:"NAME_BLOCKLIST"`   // 名字中不能出现的词
+}
+
+// 同桌重名的处理方式
+const (
+	DuplicatesSuffix = "suffix"
+	DuplicatesReject = "reject"
+)
+
+// Chat 聊天配置
+type Chat struct {
+	Limit       game.RateLimit `json:"limit"`                               // 每个玩家发言的频率
+	FilterWords []string       `json:"filterWords" env:"CHAT_FILTER_WORDS"` // 替换为星号的屏蔽词
+	EmoteLimit  game.RateLimit `json:"emoteLimit"`                          // 每个玩家发表情的频率
+}
+
+// Rules 默认规则和牌组，只能在配置文件中设置
+type Rules struct {
+	Defaults rules.Settings `json:"defaults"` // 创建游戏时请求中没有给出的规则
+	Deck     rules.Deck     `json:"deck"`
+}
+
+// Default 返回默认配置，与不带任何参数启动时的行为一致
+func Default() Config {
+	options := game.DefaultManagerOptions()
+	return Config{
+		Addr: ":8080",
+		HTTP: HTTP{
+			ReadHeaderTimeout: Duration(10 * time.Second),
+			IdleTimeout:       Duration(2 * time.Minute),
+		},
+		Log: Log{
+			Format: logging.FormatText,
+			Level:  slog.LevelInfo,
+		},
+		WebSocket: WebSocket{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			AllowedOrigins:  []string{"*"},
+			MaxMessageSize:  8 << 10,
+		},
+		Games: Games{
+			MaxPlayers:      rules.MaxPlayers,
+			WaitingTTL:      Duration(options.WaitingTTL),
+			AbandonedTTL:    Duration(options.AbandonedTTL),
+			FinishedTTL:     Duration(options.FinishedTTL),
+			JanitorInterval: Duration(options.JanitorInterval),
+			ResultDelay:     Duration(options.ResultDelay),
+			CountdownTick:   Duration(options.CountdownTick),
+			DrainTimeout:    Duration(time.Minute),
+		},
+		Storage: Storage{
+			ArchiveDir:       "archive",
+			SnapshotDir:      options.SnapshotDir,
+			SnapshotInterval: Duration(options.SnapshotInterval),
+			ProfileDir:       "profiles",
+		},
+		Limits: Limits{
+			CreateGame:      options.CreateLimit,
+			JoinGame:        options.JoinLimit,
+			Messages:        options.MessageLimit,
+			MaxGamesPerUser: options.MaxGamesPerUser,
+			MaxGamesPerIP:   options.MaxGamesPerIP,
+		},
+		Names: Names{
+			MaxLength:  game.MaxNameLength,
+			Duplicates: DuplicatesSuffix,
+		},
+		Chat: Chat{
+			Limit:      options.ChatLimit,
+			EmoteLimit: options.EmoteLimit,
+		},
+		Rules: Rules{
+			Defaults: rules.DefaultSettings(),
+			Deck:     rules.DefaultDeck(),
+		},
+	}
+}
+
+// Load 在默认配置上依次应用配置文件（path 为空时跳过）和环境变量，并校验结果
+// lookupEnv 通常为 os.LookupEnv
+func Load(path string, lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&cfg); err != nil {
+			return cfg, fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem(), lookupEnv); err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// applyEnv 按字段的 env 标签用环境变量覆盖配置
+func applyEnv(v reflect.Value, lookupEnv func(string) (string, bool)) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name, ok := v.Type().Field(i).Tag.Lookup("env")
+		if !ok {
+			if field.Kind() == reflect.Struct {
+				errs = append(errs, applyEnv(field, lookupEnv))
+			}
+			continue
+		}
+
+		value, ok := lookupEnv(EnvPrefix + name)
+		if !ok {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("环境变量 %s%s 无效: %w", EnvPrefix, name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setField 将环境变量的文本解析到字段中
+func setField(field reflect.Value, value string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		// 列表用逗号分隔
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("不支持的类型 %s", field.Type())
+	}
+	return nil
+}
+
+// Validate 校验配置并补全默认规则，返回所有问题
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr 不能为空"))
+	}
+	if c.Log.Format != logging.FormatText && c.Log.Format != logging.FormatJSON {
+		errs = append(errs, fmt.Errorf("未知的日志格式 %q", c.Log.Format))
+	}
+	if c.TLS.Enabled() && (c.TLS.CertFile == "" || c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("TLS 证书和私钥必须同时配置"))
+	}
+	if c.TLS.RedirectAddr != "" && !c.TLS.Enabled() {
+		errs = append(errs, errors.New("没有配置 TLS 证书时不能重定向到 HTTPS"))
+	}
+	if c.WebSocket.ReadBufferSize <= 0 || c.WebSocket.WriteBufferSize <= 0 {
+		errs = append(errs, errors.New("WebSocket 缓冲区大小必须为正数"))
+	}
+	if c.WebSocket.MaxMessageSize <= 0 {
+		errs = append(errs, errors.New("WebSocket 消息大小上限必须为正数"))
+	}
+	if c.Games.MaxGames < 0 {
+		errs = append(errs, errors.New("maxGames 不能为负"))
+	}
+	if c.Games.MaxPlayers < rules.MinPlayers {
+		errs = append(errs, fmt.Errorf("maxPlayers 不能少于 %d", rules.MinPlayers))
+	}
+	for name, d := range map[string]Duration{
+		"waitingTTL":        c.Games.WaitingTTL,
+		"abandonedTTL":      c.Games.AbandonedTTL,
+		"finishedTTL":       c.Games.FinishedTTL,
+		"janitorInterval":   c.Games.JanitorInterval,
+		"resultDelay":       c.Games.ResultDelay,
+		"countdownTick":     c.Games.CountdownTick,
+		"drainTimeout":      c.Games.DrainTimeout,
+		"readHeaderTimeout": c.HTTP.ReadHeaderTimeout,
+		"idleTimeout":       c.HTTP.IdleTimeout,
+		"snapshotInterval":  c.Storage.SnapshotInterval,
+	} {
+		if d < 0 {
+			errs = append(errs, fmt.Errorf("%s 不能为负", name))
+		}
+	}
+	for name, limit := range map[string]game.RateLimit{
+		"createGame": c.Limits.CreateGame,
+		"joinGame":   c.Limits.JoinGame,
+		"messages":   c.Limits.Messages,
+		"chat":       c.Chat.Limit,
+		"emote":      c.Chat.EmoteLimit,
+	} {
+		if err := limit.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("限流 %s 无效: %w", name, err))
+		}
+	}
+	if c.Limits.MaxGamesPerUser < 0 {
+		errs = append(errs, errors.New("maxGamesPerUser 不能为负"))
+	}
+	if c.Limits.MaxGamesPerIP < 0 {
+		errs = append(errs, errors.New("maxGamesPerIP 不能为负"))
+	}
+	if _, err := game.ParseTrustedProxies(c.Limits.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("trustedProxies 无效: %w", err))
+	}
+	if c.Names.MaxLength < 1 {
+		errs = append(errs, errors.New("名字长度上限至少为1"))
+	}
+	if c.Names.Duplicates != DuplicatesSuffix && c.Names.Duplicates != DuplicatesReject {
+		errs = append(errs, fmt.Errorf("未知的重名处理方式 %q", c.Names.Duplicates))
+	}
+	if err := c.Rules.Deck.Validate(c.Games.MaxPlayers); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Rules.Defaults.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("默认规则无效: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ManagerOptions 返回对应的游戏管理器配置，归档器需由调用方创建
+func (c Config) ManagerOptions() game.ManagerOptions {
+	options := game.ManagerOptions{
+		WaitingTTL:       time.Duration(c.Games.WaitingTTL),
+		AbandonedTTL:     time.Duration(c.Games.AbandonedTTL),
+		FinishedTTL:      time.Duration(c.Games.FinishedTTL),
+		JanitorInterval:  time.Duration(c.Games.JanitorInterval),
+		SnapshotDir:      c.Storage.SnapshotDir,
+		SnapshotInterval: time.Duration(c.Storage.SnapshotInterval),
+		ResultDelay:      time.Duration(c.Games.ResultDelay),
+		CountdownTick:    time.Duration(c.Games.CountdownTick),
+		MaxGames:         c.Games.MaxGames,
+		MaxPlayers:       c.Games.MaxPlayers,
+		Deck:             c.Rules.Deck,
+		DefaultSettings:  c.Rules.Defaults,
+		CreateLimit:      c.Limits.CreateGame,
+		JoinLimit:        c.Limits.JoinGame,
+		MessageLimit:     c.Limits.Messages,
+		MaxGamesPerUser:  c.Limits.MaxGamesPerUser,
+		MaxGamesPerIP:    c.Limits.MaxGamesPerIP,
+		Names: game.NamePolicy{
+			MaxLength:        c.Names.MaxLength,
+			Blocklist:        c.Names.Blocklist,
+			RejectDuplicates: c.Names.Duplicates == DuplicatesReject,
+		},
+		ChatLimit:  c.Chat.Limit,
+		EmoteLimit: c.Chat.EmoteLimit,
+		Identities: game.NewIdentityKey(c.IdentitySecret),
+	}
+	if len(c.Chat.FilterWords) > 0 {
+		options.ChatFilter = game.NewWordFilter(c.Chat.FilterWords)
+	}
+	// 列表已在 Validate 中检查过
+	options.TrustedProxies, _ = game.ParseTrustedProxies(c.Limits.TrustedProxies)
+	return options
+}
+
+// AllowOrigin 检查 WebSocket 握手的 Origin 是否被允许，没有 Origin 头的非浏览器客户端总是允许
+func (w WebSocket) AllowOrigin(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range w.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Print 以JSON格式输出生效的配置，管理员令牌会被隐去
+func (c Config) Print(w io.Writer) error {
+	if c.AdminToken != "" {
+		c.AdminToken = logging.Redacted
+	}
+	if c.IdentitySecret != "" {
+		c.IdentitySecret = logging.Redacted
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c)
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"server/game"
+	"server/logging"
+	"server/rules"
+)
+
+// env 用给定的映射模拟环境变量
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+// writeConfig 写入临时配置文件并返回路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefault(t *testing.T) {
+	cfg, err := Load("", env(nil))
+	if err != nil {
+		t.Fatalf("默认配置无效: %v", err)
+	}
+
+	options := cfg.ManagerOptions()
+	defaults := game.DefaultManagerOptions()
+	if options.WaitingTTL != defaults.WaitingTTL || options.SnapshotDir != defaults.SnapshotDir || options.ResultDelay != defaults.ResultDelay {
+		t.Errorf("默认配置与 DefaultManagerOptions 不一致: %+v", options)
+	}
+	if options.MaxPlayers != rules.MaxPlayers || options.Deck != rules.DefaultDeck() {
+		t.Errorf("默认人数或牌组不正确: %+v", options)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `{
+		"addr": ":9090",
+		"websocket": {"allowedOrigins": ["https://example.com"]},
+		"games": {"maxPlayers": 6, "waitingTTL": "5m"},
+		"rules": {
+			"defaults": {"mode": "lives", "startingLives": 2},
+			"deck": {"queens": 8, "kings": 8, "aces": 8, "jokers": 6}
+		}
+	}`)
+
+	cfg, err := Load(path, env(map[string]string{
+		"LIARS_BAR_ADDR":               ":7070",
+		"LIARS_BAR_LOG_LEVEL":          "debug",
+		"LIARS_BAR_WS_ALLOWED_ORIGINS": "https://a.example, https://b.example",
+		"LIARS_BAR_SNAPSHOT_INTERVAL":  "10s",
+		"LIARS_BAR_DEBUG":              "true",
+		"LIARS_BAR_NAME_BLOCKLIST":     "admin,root",
+		"LIARS_BAR_NAME_DUPLICATES":    "reject",
+		"LIARS_BAR_CHAT_FILTER_WORDS":  "darn",
+		"LIARS_BAR_TRUSTED_PROXIES":    "10.0.0.1, 192.168.0.0/16",
+	}))
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+
+	// 环境变量覆盖配置文件
+	if cfg.Addr != ":7070" {
+		t.Errorf("addr = %q", cfg.Addr)
+	}
+	if cfg.Log.Level != slog.LevelDebug || !cfg.Log.Debug {
+		t.Errorf("log = %+v", cfg.Log)
+	}
+	if got := strings.Join(cfg.WebSocket.AllowedOrigins, " "); got != "https://a.example https://b.example" {
+		t.Errorf("allowedOrigins = %q", got)
+	}
+	if cfg.Storage.SnapshotInterval != Duration(10*time.Second) {
+		t.Errorf("snapshotInterval = %v", cfg.Storage.SnapshotInterval)
+	}
+
+	// 配置文件覆盖默认值，没有写的字段保持默认
+	if cfg.Games.MaxPlayers != 6 || cfg.Games.WaitingTTL != Duration(5*time.Minute) {
+		t.Errorf("games = %+v", cfg.Games)
+	}
+	if cfg.Games.FinishedTTL != Duration(game.DefaultManagerOptions().FinishedTTL) {
+		t.Errorf("finishedTTL = %v，应保持默认值", cfg.Games.FinishedTTL)
+	}
+	if cfg.Rules.Defaults.Mode != rules.GameModeLives || cfg.Rules.Defaults.StartingLives != 2 || cfg.Rules.Defaults.BestOf != 1 {
+		t.Errorf("defaults = %+v", cfg.Rules.Defaults)
+	}
+	if names := cfg.ManagerOptions().Names; len(names.Blocklist) != 2 || !names.RejectDuplicates {
+		t.Errorf("names = %+v", names)
+	}
+	if filter := cfg.ManagerOptions().ChatFilter; filter == nil {
+		t.Error("没有创建聊天过滤器")
+	} else if text, _ := filter.Filter("Darn it"); text != "**** it" {
+		t.Errorf("过滤后 = %q", text)
+	}
+	if proxies := cfg.ManagerOptions().TrustedProxies; len(proxies) != 2 {
+		t.Errorf("trustedProxies = %v", proxies)
+	}
+	if cfg.Rules.Deck.Size() != 30 {
+		t.Errorf("deck = %+v", cfg.Rules.Deck)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		want    string
+	}{
+		{"未知字段", `{"adress": ":1"}`, nil, "adress"},
+		{"无效时长", `{"games": {"waitingTTL": "soon"}}`, nil, "soon"},
+		{"牌不够发", `{"games": {"maxPlayers": 6}}`, nil, "不够 6 名玩家"},
+		{"人数太少", `{"games": {"maxPlayers": 1}}`, nil, "maxPlayers"},
+		{"未知模式", `{"rules": {"defaults": {"mode": "roulette"}}}`, nil, "默认规则无效"},
+		{"环境变量无效", `{}`, map[string]string{"LIARS_BAR_MAX_GAMES": "many"}, "LIARS_BAR_MAX_GAMES"},
+		{"只有证书", `{"tls": {"certFile": "cert.pem"}}`, nil, "同时配置"},
+		{"没有证书时重定向", `{"tls": {"redirectAddr": ":80"}}`, nil, "重定向"},
+		{"限流突发为0", `{"limits": {"joinGame": {"rate": 1, "burst": 0}}}`, nil, "joinGame"},
+		{"重名处理", `{"names": {"duplicates": "ignore"}}`, nil, "ignore"},
+		{"代理地址", `{"limits": {"trustedProxies": ["10.0.0.0/8", "proxy"]}}`, nil, "proxy"},
+		{"日志格式", `{}`, map[string]string{"LIARS_BAR_LOG_FORMAT": "xml"}, "xml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.content), env(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("错误 = %v，应包含 %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowOrigin(t *testing.T) {
+	ws := WebSocket{AllowedOrigins: []string{"https://example.com"}}
+	for origin, want := range map[string]bool{
+		"":                    true,
+		"https://example.com": true,
+		"https://EXAMPLE.com": true,
+		"https://evil.com":    false,
+	} {
+		if got := ws.AllowOrigin(origin); got != want {
+			t.Errorf("AllowOrigin(%q) = %v，应为 %v", origin, got, want)
+		}
+	}
+	if !(WebSocket{AllowedOrigins: []string{"*"}}).AllowOrigin("https://evil.com") {
+		t.Error("* 应允许所有 Origin")
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cfg := Default()
+	cfg.AdminToken = "secret"
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "secret") || !strings.Contains(buf.String(), logging.Redacted) {
+		t.Errorf("输出中的管理员令牌没有隐去:\n%s", buf.String())
+	}
+
+	// 输出可以作为配置文件重新加载
+	cfg, err := Load(writeConfig(t, buf.String()), env(nil))
+	if err != nil {
+		t.Fatalf("重新加载输出的配置失败: %v", err)
+	}
+	if cfg.Games.DrainTimeout != Duration(time.Minute) {
+		t.Errorf("drainTimeout = %v", cfg.Games.DrainTimeout)
+	}
+}
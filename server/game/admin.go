@@ -0,0 +1,318 @@
+package game
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"server/logging"
+	"server/rules"
+)
+
+// 管理操作的错误
+var (
+	ErrGameNotFound   = errors.New("游戏不存在")
+	ErrPlayerNotFound = errors.New("玩家不存在")
+	ErrEmptyMessage   = errors.New("消息不能为空")
+)
+
+// AdminGame 管理员看到的游戏概要
+type AdminGame struct {
+	GameStatus
+	HostID string        `json:"hostId"`
+	Paused bool          `json:"paused"`
+	Round  int           `json:"round"`
+	Seats  []AdminPlayer `json:"seats"`
+}
+
+// AdminPlayer 管理员看到的玩家概要
+type AdminPlayer struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+	Ready     bool   `json:"ready"`
+	Alive     bool   `json:"alive"`
+	Lives     int    `json:"lives"`
+}
+
+// AdminGameState 管理员看到的完整游戏状态，包括所有手牌和子弹位置
+type AdminGameState struct {
+	AdminGame
+	Settings GameSettings  `json:"settings"`
+	Play     *rules.State  `json:"play"`   // 最近一局的完整状态，还没开过局时为nil
+	Events   []rules.Event `json:"events"` // 最近一局的事件日志
+}
+
+// adminSummary 返回游戏概要
+func (g *Game) adminSummary() AdminGame {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.adminSummaryLocked()
+}
+
+// adminSummaryLocked 返回游戏概要，调用方需持有锁
+func (g *Game) adminSummaryLocked() AdminGame {
+	summary := AdminGame{
+		GameStatus: GameStatus{
+			ID:           g.ID,
+			State:        g.State,
+			Players:      len(g.Players),
+			Connections:  len(g.Connections),
+			CreatedAt:    g.CreatedAt,
+			LastActivity: g.LastActivity,
+			FinishedAt:   g.currentPlay().FinishedAt,
+		},
+		HostID: g.HostID,
+		Paused: g.Paused,
+		Round:  g.currentPlay().RoundCount,
+		Seats:  make([]AdminPlayer, 0, len(g.PlayerOrder)),
+	}
+	for _, playerID := range g.PlayerOrder {
+		stats := g.playerStats(playerID)
+		_, connected := g.Connections[playerID]
+		summary.Seats = append(summary.Seats, AdminPlayer{
+			ID:        playerID,
+			Name:      g.Players[playerID].Name,
+			Connected: connected,
+			Ready:     g.Players[playerID].Ready,
+			Alive:     stats.Alive,
+			Lives:     stats.Lives,
+		})
+	}
+	return summary
+}
+
+// AdminState 返回完整的游戏状态
+func (g *Game) AdminState() AdminGameState {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	state := AdminGameState{
+		AdminGame: g.adminSummaryLocked(),
+		Settings:  g.Settings,
+		Events:    append([]rules.Event(nil), g.Events...),
+	}
+	if g.play != nil {
+		state.Play = g.play.Clone()
+	}
+	return state
+}
+
+// AdminKick 管理员踢出玩家，游戏进行中视为认输
+func (g *Game) AdminKick(playerID string) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	player, ok := g.Players[playerID]
+	if !ok {
+		return ErrPlayerNotFound
+	}
+
+	g.logger().Info("管理员踢出了玩家", "target_id", playerID, "target_name", player.Name)
+	g.LastActivity = time.Now()
+	g.kickPlayer(playerID, "你已被管理员移出游戏")
+	return nil
+}
+
+// SystemMessage 向游戏中所有连接的玩家发送系统消息
+func (g *Game) SystemMessage(text string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	message := map[string]interface{}{
+		"type":    "system_message",
+		"message": text,
+	}
+	for _, conn := range g.Connections {
+		writeMessage(conn, message)
+	}
+}
+
+// AdminGames 返回所有游戏的概要，按创建时间排列
+func (gm *GameManager) AdminGames() []AdminGame {
+	games := gm.Games()
+	summaries := make([]AdminGame, 0, len(games))
+	for _, game := range games {
+		summaries = append(summaries, game.adminSummary())
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if !summaries[i].CreatedAt.Equal(summaries[j].CreatedAt) {
+			return summaries[i].CreatedAt.Before(summaries[j].CreatedAt)
+		}
+		return summaries[i].ID < summaries[j].ID
+	})
+	return summaries
+}
+
+// EndGame 强制结束游戏：通知并断开所有玩家，归档未完成的记录后移除
+func (gm *GameManager) EndGame(gameID string) error {
+	game := gm.GetGame(gameID)
+	if game == nil {
+		return ErrGameNotFound
+	}
+
+	slog.Info("管理员结束了游戏", logging.KeyGameID, gameID)
+	gm.RemoveGame(gameID)
+	if record := game.Close("admin", "游戏已被管理员结束"); record != nil {
+		gm.archiveRecord(record)
+	}
+	return nil
+}
+
+// DeleteGame 直接移除游戏，不归档记录
+func (gm *GameManager) DeleteGame(gameID string) error {
+	game := gm.GetGame(gameID)
+	if game == nil {
+		return ErrGameNotFound
+	}
+
+	slog.Info("管理员移除了游戏", logging.KeyGameID, gameID)
+	gm.RemoveGame(gameID)
+	game.Close("admin", "游戏已被管理员移除")
+	return nil
+}
+
+// Broadcast 向指定游戏（gameID 为空时为所有游戏）发送系统消息，返回收到消息的游戏数
+func (gm *GameManager) Broadcast(gameID string, text string) (int, error) {
+	if text == "" {
+		return 0, ErrEmptyMessage
+	}
+
+	games := gm.Games()
+	if gameID != "" {
+		game := gm.GetGame(gameID)
+		if game == nil {
+			return 0, ErrGameNotFound
+		}
+		games = []*Game{game}
+	}
+
+	slog.Info("管理员广播系统消息", logging.KeyGameID, gameID, "games", len(games))
+	for _, game := range games {
+		game.SystemMessage(text)
+	}
+	return len(games), nil
+}
+
+// AdminHandler 返回 /api/admin 下的管理接口和 /admin 管理页面，token 为空时管理功能关闭
+// 管理接口只接受 Bearer 令牌，浏览器登录管理页面后缓存的 Basic 密码不能用于跨站调用接口；
+// 管理页面还接受 HTTP Basic 密码，表单提交另外检查来源
+func (gm *GameManager) AdminHandler(token string) http.Handler {
+	api := http.NewServeMux()
+	mux := http.NewServeMux()
+
+	api.HandleFunc("GET /api/admin/games", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, gm.AdminGames())
+	})
+	api.HandleFunc("GET /api/admin/games/{id}", func(w http.ResponseWriter, r *http.Request) {
+		game := gm.GetGame(r.PathValue("id"))
+		if game == nil {
+			http.Error(w, ErrGameNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, game.AdminState())
+	})
+	api.HandleFunc("POST /api/admin/games/{id}/end", func(w http.ResponseWriter, r *http.Request) {
+		respondAdmin(w, gm.EndGame(r.PathValue("id")), nil)
+	})
+	api.HandleFunc("DELETE /api/admin/games/{id}", func(w http.ResponseWriter, r *http.Request) {
+		respondAdmin(w, gm.DeleteGame(r.PathValue("id")), nil)
+	})
+	api.HandleFunc("POST /api/admin/games/{id}/kick", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			PlayerID string `json:"playerId"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "无效的请求格式", http.StatusBadRequest)
+			return
+		}
+		game := gm.GetGame(r.PathValue("id"))
+		if game == nil {
+			http.Error(w, ErrGameNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		respondAdmin(w, game.AdminKick(request.PlayerID), nil)
+	})
+	api.HandleFunc("POST /api/admin/broadcast", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			GameID  string `json:"gameId"` // 为空时发送给所有游戏
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "无效的请求格式", http.StatusBadRequest)
+			return
+		}
+		games, err := gm.Broadcast(request.GameID, request.Message)
+		respondAdmin(w, err, map[string]int{"games": games})
+	})
+
+	mux.Handle("/api/admin/", RequireAdminToken(token, api))
+	mux.Handle("GET /admin", RequireAdmin(token, http.HandlerFunc(gm.handleAdminPage)))
+	mux.Handle("POST /admin", RequireAdmin(token, http.HandlerFunc(gm.handleAdminAction)))
+
+	return mux
+}
+
+// RequireAdmin 校验以 Bearer 令牌或 HTTP Basic 密码提供的管理员令牌，用于浏览器访问的页面
+func RequireAdmin(token string, next http.Handler) http.Handler {
+	return requireAdmin(token, true, next)
+}
+
+// RequireAdminToken 只接受以 Bearer 令牌提供的管理员令牌，浏览器不会在跨站请求中自动带上它
+func RequireAdminToken(token string, next http.Handler) http.Handler {
+	return requireAdmin(token, false, next)
+}
+
+// requireAdmin 校验管理员令牌，allowBasic 表示是否接受 HTTP Basic 密码
+func requireAdmin(token string, allowBasic bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.Error(w, "管理功能未启用", http.StatusNotFound)
+			return
+		}
+
+		provided := ""
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			provided = bearer
+		} else if _, password, ok := r.BasicAuth(); ok && allowBasic {
+			provided = password
+		}
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			if allowBasic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			}
+			http.Error(w, "需要管理员身份", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// respondAdmin 返回管理操作的结果
+func respondAdmin(w http.ResponseWriter, err error, result interface{}) {
+	switch {
+	case errors.Is(err, ErrGameNotFound), errors.Is(err, ErrPlayerNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case result != nil:
+		writeJSON(w, result)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeJSON 以JSON格式返回响应
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
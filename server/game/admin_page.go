@@ -0,0 +1,164 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+)
+
+// adminPage 服务器渲染的管理页面，表单提交到 POST /admin 后重定向回来
+var adminPage = template.Must(template.New("admin").Funcs(template.FuncMap{
+	"time": func(t interface{ Format(string) string }) string { return t.Format("2006-01-02 15:04:05") },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="UTF-8">
+<title>骗子酒馆 - 管理</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+form { display: inline; }
+.notice { background: #ffe; border: 1px solid #cc9; padding: 8px; }
+.offline { color: #999; }
+pre { background: #f6f6f6; padding: 8px; max-height: 40em; overflow: auto; }
+</style>
+</head>
+<body>
+<h1>骗子酒馆 - 管理</h1>
+{{with .Notice}}<p class="notice">{{.}}</p>{{end}}
+
+<h2>广播系统消息</h2>
+<form method="post" action="/admin">
+<input type="hidden" name="action" value="broadcast">
+<select name="gameId">
+<option value="">所有游戏</option>
+{{range .Games}}<option value="{{.ID}}">{{.ID}}</option>{{end}}
+</select>
+<input type="text" name="message" size="50" required>
+<button type="submit">发送</button>
+</form>
+
+<h2>游戏（{{len .Games}}）</h2>
+<table>
+<tr><th>游戏</th><th>状态</th><th>轮数</th><th>玩家</th><th>创建时间</th><th>最近操作</th><th>操作</th></tr>
+{{range .Games}}
+<tr>
+<td><a href="/admin?game={{.ID}}">{{.ID}}</a></td>
+<td>{{.State}}{{if .Paused}}（暂停）{{end}}</td>
+<td>{{.Round}}</td>
+<td>{{range .Seats}}<span{{if not .Connected}} class="offline"{{end}}>{{.Name}}</span> {{end}}（在线 {{.Connections}}/{{.Players}}）</td>
+<td>{{time .CreatedAt}}</td>
+<td>{{time .LastActivity}}</td>
+<td>
+<form method="post" action="/admin"><input type="hidden" name="action" value="end"><input type="hidden" name="gameId" value="{{.ID}}"><button type="submit">结束</button></form>
+<form method="post" action="/admin"><input type="hidden" name="action" value="delete"><input type="hidden" name="gameId" value="{{.ID}}"><button type="submit">移除</button></form>
+</td>
+</tr>
+{{else}}
+<tr><td colspan="7">没有游戏</td></tr>
+{{end}}
+</table>
+
+{{with .Selected}}
+<h2>游戏 {{.ID}}</h2>
+<table>
+<tr><th>玩家</th><th>在线</th><th>准备</th><th>存活</th><th>命数</th><th>操作</th></tr>
+{{range .Seats}}
+<tr>
+<td>{{.Name}}{{if eq .ID $.Selected.HostID}}（房主）{{end}}</td>
+<td>{{if .Connected}}是{{else}}否{{end}}</td>
+<td>{{if .Ready}}是{{else}}否{{end}}</td>
+<td>{{if .Alive}}是{{else}}否{{end}}</td>
+<td>{{.Lives}}</td>
+<td><form method="post" action="/admin"><input type="hidden" name="action" value="kick"><input type="hidden" name="gameId" value="{{$.Selected.ID}}"><input type="hidden" name="playerId" value="{{.ID}}"><button type="submit">踢出</button></form></td>
+</tr>
+{{end}}
+</table>
+<h3>完整状态</h3>
+<pre>{{$.SelectedJSON}}</pre>
+{{end}}
+</body>
+</html>
+`))
+
+// handleAdminPage 渲染管理页面，带 game 参数时显示该游戏的完整状态
+func (gm *GameManager) handleAdminPage(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Notice       string
+		Games        []AdminGame
+		Selected     *AdminGameState
+		SelectedJSON string
+	}{
+		Notice: r.URL.Query().Get("notice"),
+		Games:  gm.AdminGames(),
+	}
+
+	if game := gm.GetGame(r.URL.Query().Get("game")); game != nil {
+		state := game.AdminState()
+		encoded, _ := json.MarshalIndent(state, "", "  ")
+		data.Selected = &state
+		data.SelectedJSON = string(encoded)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	adminPage.Execute(w, data)
+}
+
+// handleAdminAction 处理管理页面提交的表单，完成后重定向回管理页面
+func (gm *GameManager) handleAdminAction(w http.ResponseWriter, r *http.Request) {
+	// 浏览器会自动带上 Basic 认证，只接受来自本站页面的表单，防止跨站请求
+	if !sameOrigin(r) {
+		http.Error(w, "跨站请求被拒绝", http.StatusForbidden)
+		return
+	}
+
+	gameID := r.FormValue("gameId")
+	redirect := url.Values{}
+
+	var err error
+	switch r.FormValue("action") {
+	case "end":
+		err = gm.EndGame(gameID)
+		redirect.Set("notice", "已结束游戏 "+gameID)
+
+	case "delete":
+		err = gm.DeleteGame(gameID)
+		redirect.Set("notice", "已移除游戏 "+gameID)
+
+	case "kick":
+		err = ErrGameNotFound
+		if game := gm.GetGame(gameID); game != nil {
+			err = game.AdminKick(r.FormValue("playerId"))
+		}
+		redirect.Set("game", gameID)
+		redirect.Set("notice", "已踢出玩家")
+
+	case "broadcast":
+		var games int
+		games, err = gm.Broadcast(gameID, r.FormValue("message"))
+		redirect.Set("notice", fmt.Sprintf("已向 %d 个游戏发送系统消息", games))
+
+	default:
+		http.Error(w, "未知的操作", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		redirect.Set("notice", "操作失败: "+err.Error())
+	}
+	http.Redirect(w, r, "/admin?"+redirect.Encode(), http.StatusSeeOther)
+}
+
+// sameOrigin 检查请求的 Origin（没有时用 Referer）是否与本站一致
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	u, err := url.Parse(source)
+	return err == nil && source != "" && u.Host == r.Host
+}
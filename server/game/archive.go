@@ -0,0 +1,46 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RecordArchiver 保存游戏记录
+type RecordArchiver interface {
+	Archive(record *GameRecord) error
+}
+
+// FileArchiver 将游戏记录以JSON文件保存到目录中
+type FileArchiver struct {
+	Dir string
+}
+
+// NewFileArchiver 创建文件归档器，目录不存在时自动创建
+func NewFileArchiver(dir string) (*FileArchiver, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileArchiver{Dir: dir}, nil
+}
+
+// Archive 保存一局游戏记录，同一牌桌的多局按局数区分
+func (a *FileArchiver) Archive(record *GameRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%d.json", record.GameID, record.GameNumber)
+	return writeFileAtomic(filepath.Join(a.Dir, name), data)
+}
+
+// writeFileAtomic 先写临时文件再重命名，避免留下写了一半的文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
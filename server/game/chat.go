@@ -0,0 +1,220 @@
+package game
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 聊天频道
+// 服务器目前没有观战连接，每个连接都对应一名入座的玩家，所以还没有观众频道；
+// 以后加入观战时，观众应和出局的玩家一样使用出局频道，canReadChat 中按观众处理即可
+const (
+	ChatChannelTable = "table" // 桌上所有人都能看到
+	ChatChannelOut   = "out"   // 进行中的游戏里已出局的玩家只能在这里发言，仍在场的玩家看不到，游戏结束后公开
+)
+
+// 聊天限制
+const (
+	MaxChatLength    = 200 // 一条消息最多的字符数
+	ChatHistoryLimit = 100 // 保留的历史消息条数
+)
+
+// ErrChatRejected 过滤器拒绝了聊天内容
+var ErrChatRejected = errors.New("消息内容不允许发送")
+
+// ChatMessage 一条聊天消息
+type ChatMessage struct {
+	Channel    string    `json:"channel"`
+	PlayerID   string    `json:"playerId"`
+	PlayerName string    `json:"playerName"`
+	Text       string    `json:"text"`
+	Time       time.Time `json:"time"`
+}
+
+// ChatFilter 过滤聊天内容，返回替换后的文本，返回错误时拒绝发送
+type ChatFilter interface {
+	Filter(text string) (string, error)
+}
+
+// WordFilter 把屏蔽词替换为星号，比较时忽略大小写
+type WordFilter struct {
+	words [][]rune
+}
+
+// NewWordFilter 创建屏蔽词过滤器
+func NewWordFilter(words []string) *WordFilter {
+	f := &WordFilter{}
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			f.words = append(f.words, lowerRunes(word))
+		}
+	}
+	return f
+}
+
+// lowerRunes 逐个字符转为小写，保持字符数不变以便按位置替换
+func lowerRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+// Filter 实现 ChatFilter
+func (f *WordFilter) Filter(text string) (string, error) {
+	runes := []rune(text)
+	lower := lowerRunes(text)
+	for _, word := range f.words {
+		for i := 0; i+len(word) <= len(lower); i++ {
+			if string(lower[i:i+len(word)]) != string(word) {
+				continue
+			}
+			for j := i; j < i+len(word); j++ {
+				runes[j] = '*'
+				lower[j] = '*'
+			}
+		}
+	}
+	return string(runes), nil
+}
+
+// cleanChatText 去掉控制字符，换行和连续空白合并为一个空格
+func cleanChatText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// chatChannel 玩家当前发言所在的频道，调用方需持有锁
+func (g *Game) chatChannel(playerID string) string {
+	if g.State == GameStatePlaying && !g.playerStats(playerID).Alive {
+		return ChatChannelOut
+	}
+	return ChatChannelTable
+}
+
+// canReadChat 玩家能否看到这条消息：出局频道只对出局的玩家可见，游戏不在进行中时公开；屏蔽的玩家的消息不可见
+func (g *Game) canReadChat(viewerID string, message ChatMessage) bool {
+	if g.isMuted(viewerID, message.PlayerID) {
+		return false
+	}
+	return message.Channel == ChatChannelTable || g.State != GameStatePlaying || g.chatChannel(viewerID) == ChatChannelOut
+}
+
+// handleChat 处理玩家发送的聊天消息
+func (g *Game) handleChat(playerID string, text string) {
+	player, ok := g.Players[playerID]
+	if !ok {
+		return
+	}
+
+	text = cleanChatText(text)
+	if text == "" {
+		return
+	}
+	if utf8.RuneCountInString(text) > MaxChatLength {
+		g.sendError(playerID, "消息太长")
+		return
+	}
+
+	// 每个玩家单独限制发言频率
+	if !g.chatLimit.allow(playerID) {
+		rateLimited.Inc("chat", "player")
+		g.sendError(playerID, "发言太频繁，请稍后再说")
+		return
+	}
+
+	if g.chatFilter != nil {
+		filtered, err := g.chatFilter.Filter(text)
+		if err != nil {
+			g.sendError(playerID, ErrChatRejected.Error())
+			return
+		}
+		text = filtered
+	}
+
+	message := ChatMessage{
+		Channel:    g.chatChannel(playerID),
+		PlayerID:   playerID,
+		PlayerName: player.Name,
+		Text:       text,
+		Time:       time.Now(),
+	}
+	g.Chat = append(g.Chat, message)
+	if len(g.Chat) > ChatHistoryLimit {
+		g.Chat = g.Chat[len(g.Chat)-ChatHistoryLimit:]
+	}
+	g.playerLogger(playerID).Debug("聊天", "channel", message.Channel, "length", utf8.RuneCountInString(text))
+
+	for viewerID, conn := range g.Connections {
+		if g.canReadChat(viewerID, message) {
+			writeMessage(conn, map[string]interface{}{
+				"type":    "chat",
+				"message": message,
+			})
+		}
+	}
+}
+
+// handleMute 玩家屏蔽或取消屏蔽另一名玩家的聊天
+func (g *Game) handleMute(playerID string, targetID string, muted bool) {
+	player, ok := g.Players[playerID]
+	if !ok {
+		return
+	}
+	if _, ok := g.Players[targetID]; !ok || targetID == playerID {
+		g.sendError(playerID, "玩家不存在")
+		return
+	}
+
+	if muted {
+		if player.Muted == nil {
+			player.Muted = make(map[string]bool)
+		}
+		player.Muted[targetID] = true
+	} else {
+		delete(player.Muted, targetID)
+	}
+
+	if conn, ok := g.Connections[playerID]; ok {
+		writeMessage(conn, map[string]interface{}{
+			"type":     "mute_updated",
+			"playerId": targetID,
+			"muted":    muted,
+		})
+	}
+}
+
+// sendChatHistory 重连时补发玩家能看到的聊天记录，没有记录时不发送
+func (g *Game) sendChatHistory(playerID string) {
+	conn, ok := g.Connections[playerID]
+	if !ok {
+		return
+	}
+
+	history := make([]ChatMessage, 0, len(g.Chat))
+	for _, message := range g.Chat {
+		if g.canReadChat(playerID, message) {
+			history = append(history, message)
+		}
+	}
+	if len(history) == 0 {
+		return
+	}
+
+	writeMessage(conn, map[string]interface{}{
+		"type":     "chat_history",
+		"messages": history,
+	})
+}
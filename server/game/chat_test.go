@@ -0,0 +1,84 @@
+package game
+
+import (
+	"testing"
+
+	"server/rules"
+)
+
+func TestWordFilter(t *testing.T) {
+	filter := NewWordFilter([]string{"darn", "混蛋", " "})
+
+	for text, want := range map[string]string{
+		"hello":           "hello",
+		"DARN it, darnit": "**** it, ****it",
+		"你这个混蛋":           "你这个**",
+		"İ darn İ":        "İ **** İ",
+	} {
+		if got, err := filter.Filter(text); err != nil || got != want {
+			t.Errorf("Filter(%q) = %q, %v，应为 %q", text, got, err, want)
+		}
+	}
+}
+
+func TestCleanChatText(t *testing.T) {
+	for text, want := range map[string]string{
+		"  hi  ":            "hi",
+		"line1\nline2\r\n":  "line1 line2",
+		"a\x00b\u200bc":     "abc",
+		"tab\tand   spaces": "tab and spaces",
+	} {
+		if got := cleanChatText(text); got != want {
+			t.Errorf("cleanChatText(%q) = %q，应为 %q", text, got, want)
+		}
+	}
+}
+
+func TestChatChannels(t *testing.T) {
+	g := NewGame("g", GameSettings{})
+	alice, _ := g.AddPlayer("alice")
+	bob, _ := g.AddPlayer("bob")
+	carol, _ := g.AddPlayer("carol")
+
+	// 进行中的一局里 carol 已经出局
+	g.State = GameStatePlaying
+	g.play = rules.NewState()
+	for _, id := range []string{alice, bob, carol} {
+		g.play.Players[id] = &rules.Player{ID: id, Alive: id != carol}
+	}
+
+	g.handleChat(alice, "我有两张Q")
+	g.handleChat(carol, "她在骗人")
+	if len(g.Chat) != 2 || g.Chat[0].Channel != ChatChannelTable || g.Chat[1].Channel != ChatChannelOut {
+		t.Fatalf("聊天记录: %+v", g.Chat)
+	}
+
+	// 仍在场的玩家看不到出局频道，出局的玩家两个频道都能看到
+	if g.canReadChat(bob, g.Chat[1]) || !g.canReadChat(carol, g.Chat[0]) || !g.canReadChat(carol, g.Chat[1]) {
+		t.Error("出局频道的可见范围不正确")
+	}
+
+	// 屏蔽后看不到对方的消息
+	g.handleMute(bob, alice, true)
+	if g.canReadChat(bob, g.Chat[0]) {
+		t.Error("屏蔽后仍能看到消息")
+	}
+	g.handleMute(bob, alice, false)
+	if !g.canReadChat(bob, g.Chat[0]) {
+		t.Error("取消屏蔽后看不到消息")
+	}
+
+	// 游戏结束后出局频道公开
+	g.State = GameStateFinished
+	if !g.canReadChat(bob, g.Chat[1]) {
+		t.Error("游戏结束后出局频道没有公开")
+	}
+
+	// 历史记录只保留最近的消息
+	for i := 0; i < ChatHistoryLimit+10; i++ {
+		g.handleChat(alice, "刷屏")
+	}
+	if len(g.Chat) != ChatHistoryLimit {
+		t.Errorf("历史记录有 %d 条", len(g.Chat))
+	}
+}
@@ -0,0 +1,117 @@
+package game
+
+import (
+	"log/slog"
+	"time"
+
+	"server/logging"
+)
+
+// beginDrain 进入关闭模式：不再开始新的一轮，进行中的这一轮结束后暂停
+func (g *Game) beginDrain() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.draining = true
+
+	// 还没开局的倒计时直接取消
+	if g.State == GameStateStarting {
+		g.cancelCountdown("服务器即将关闭")
+	}
+}
+
+// pause 在两轮之间暂停游戏，调用方需持有锁
+func (g *Game) pause() {
+	g.Paused = true
+	g.logger().Info("游戏已暂停，等待服务器重启")
+
+	message := map[string]interface{}{
+		"type":    "game_paused",
+		"message": "服务器即将重启，游戏已暂停，重启后重新连接即可继续",
+	}
+	for _, conn := range g.Connections {
+		writeMessage(conn, message)
+	}
+
+	g.broadcastGameState()
+}
+
+// isIdle 检查游戏是否没有正在进行的一轮
+func (g *Game) isIdle() bool {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.State != GameStatePlaying || g.Paused
+}
+
+// broadcastShutdown 向所有连接的玩家广播服务器关闭倒计时
+func (g *Game) broadcastShutdown(remaining time.Duration) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	message := map[string]interface{}{
+		"type":    "server_shutdown",
+		"seconds": int(remaining.Round(time.Second).Seconds()),
+		"message": "服务器即将关闭，当前这一轮结束后游戏会暂停",
+	}
+	for _, conn := range g.Connections {
+		writeMessage(conn, message)
+	}
+}
+
+// IsDraining 检查服务器是否正在关闭
+func (gm *GameManager) IsDraining() bool {
+	return gm.draining.Load()
+}
+
+// Drain 平滑关闭：不再接受新游戏和新玩家，广播关闭倒计时，
+// 等待进行中的一轮结束（最多等到超时），然后保存快照或归档记录并断开所有连接
+func (gm *GameManager) Drain(timeout time.Duration) {
+	gm.draining.Store(true)
+	slog.Info("开始平滑关闭", "timeout", timeout)
+
+	for _, game := range gm.Games() {
+		game.beginDrain()
+	}
+
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		remaining := time.Until(deadline)
+		busy := 0
+		for _, game := range gm.Games() {
+			game.broadcastShutdown(remaining)
+			if !game.isIdle() {
+				busy++
+			}
+		}
+
+		if busy == 0 {
+			slog.Info("所有游戏都已暂停或结束")
+			break
+		}
+		if remaining <= 0 {
+			slog.Warn("等待超时，仍有游戏在进行中", "busy", busy)
+			break
+		}
+
+		<-ticker.C
+	}
+
+	// 保存快照，未配置快照时归档未完成的记录
+	snapshotted := gm.options.SnapshotDir != ""
+	if snapshotted {
+		if err := gm.SnapshotAll(); err != nil {
+			slog.Error("保存快照失败", logging.KeyError, err)
+		}
+	}
+
+	for _, game := range gm.Games() {
+		record := game.Close("server_shutdown", "服务器已关闭")
+		if record != nil && !snapshotted {
+			gm.archiveRecord(record)
+		}
+	}
+}
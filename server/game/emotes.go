@@ -0,0 +1,66 @@
+package game
+
+import "server/rules"
+
+// handleEmote 处理玩家发出的表情，targetID 为空表示对全桌
+// 牌局进行中的表情经规则引擎记入事件日志，回放时可以看到；其余时候直接广播
+func (g *Game) handleEmote(playerID string, targetID string, emote string) {
+	player, ok := g.Players[playerID]
+	if !ok {
+		return
+	}
+	if !rules.IsEmote(emote) {
+		g.sendError(playerID, rules.ErrUnknownEmote.Error())
+		return
+	}
+	target, ok := g.Players[targetID]
+	if targetID != "" && (!ok || targetID == playerID) {
+		g.sendError(playerID, "玩家不存在")
+		return
+	}
+
+	if !g.emoteLimit.allow(playerID) {
+		rateLimited.Inc("emote", "player")
+		g.sendError(playerID, "表情发得太频繁，请稍后再试")
+		return
+	}
+
+	if g.State == GameStatePlaying {
+		if err := g.act(rules.Emote{PlayerID: playerID, TargetID: targetID, Emote: emote}); err != nil {
+			g.sendError(playerID, err.Error())
+		}
+		return
+	}
+
+	targetName := ""
+	if target != nil {
+		targetName = target.Name
+	}
+	message := emoteMessage(playerID, player.Name, targetID, targetName, emote)
+	for viewerID, conn := range g.Connections {
+		if !g.isMuted(viewerID, playerID) {
+			writeMessage(conn, message)
+		}
+	}
+}
+
+// isMuted 观看者是否屏蔽了这名玩家
+func (g *Game) isMuted(viewerID string, playerID string) bool {
+	viewer, ok := g.Players[viewerID]
+	return ok && viewer.Muted[playerID]
+}
+
+// emoteMessage 推送给玩家的表情消息
+func emoteMessage(playerID, playerName, targetID, targetName, emote string) map[string]interface{} {
+	message := map[string]interface{}{
+		"type":       "emote",
+		"playerId":   playerID,
+		"playerName": playerName,
+		"emote":      emote,
+	}
+	if targetID != "" {
+		message["targetId"] = targetID
+		message["targetName"] = targetName
+	}
+	return message
+}
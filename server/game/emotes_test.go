@@ -0,0 +1,79 @@
+package game
+
+import (
+	"testing"
+
+	"server/rules"
+)
+
+func TestEmoteRecord(t *testing.T) {
+	g := NewGame("g", rules.DefaultSettings())
+	g.emoteLimit = newPlayerLimiter(RateLimit{Rate: 0.001, Burst: 2})
+	alice, _ := g.AddPlayer("alice")
+	bob, _ := g.AddPlayer("bob")
+
+	// 开局前的表情不进入日志
+	g.handleEmote(alice, "", rules.EmoteLaugh)
+	if len(g.Events) != 0 {
+		t.Fatalf("开局前的表情进入了日志: %+v", g.Events)
+	}
+
+	g.State = GameStateStarting
+	g.startGame()
+	if g.State != GameStatePlaying {
+		t.Fatalf("游戏状态为 %s", g.State)
+	}
+
+	// 不存在的表情和目标被拒绝
+	events := len(g.Events)
+	g.handleEmote(alice, "", "wink")
+	g.handleEmote(alice, alice, rules.EmoteLaugh)
+	g.handleEmote(alice, "nobody", rules.EmoteLaugh)
+	if len(g.Events) != events {
+		t.Fatal("不合法的表情进入了日志")
+	}
+
+	current := g.getCurrentPlayerID()
+	g.handleEmote(bob, alice, rules.EmoteSuspicious)
+	g.handlePlayCards(current, g.play.Players[current].Hand[:1])
+	g.handleEmote(bob, "", rules.EmoteSweat)
+
+	// 超过频率限制的表情被丢弃
+	g.handleEmote(bob, "", rules.EmoteCry)
+
+	record := g.record()
+	round := record.Rounds[len(record.Rounds)-1]
+	if len(round.Emotes) != 2 {
+		t.Fatalf("本轮的表情: %+v", round.Emotes)
+	}
+	first, second := round.Emotes[0], round.Emotes[1]
+	if first.PlayerName != "bob" || first.TargetID != alice || first.TargetName != "alice" || first.Emote != rules.EmoteSuspicious || first.AfterPlay != 0 {
+		t.Errorf("第一个表情: %+v", first)
+	}
+	if second.TargetID != "" || second.Emote != rules.EmoteSweat || second.AfterPlay != 1 || second.Time.IsZero() {
+		t.Errorf("第二个表情: %+v", second)
+	}
+}
+
+func TestEmoteWhilePaused(t *testing.T) {
+	g := NewGame("g", rules.DefaultSettings())
+	alice, _ := g.AddPlayer("alice")
+	g.AddPlayer("bob")
+	g.State = GameStateStarting
+	g.startGame()
+
+	// 关闭前在两轮之间暂停
+	paused := g.play.Clone()
+	paused.RoundOver = true
+	g.play = paused
+	g.Paused = true
+
+	events := len(g.Events)
+	g.handleEmote(alice, "", rules.EmoteThink)
+	if len(g.Events) != events+1 || g.Events[len(g.Events)-1].Type != rules.EventEmote {
+		t.Fatalf("暂停中的表情应只追加一个表情事件: %+v", g.Events[events:])
+	}
+	if !g.Paused || !g.play.RoundOver {
+		t.Error("表情推进了暂停中的游戏")
+	}
+}
@@ -0,0 +1,90 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"server/rules"
+)
+
+// 牌桌所处的阶段
+const (
+	fuzzWaiting = iota
+	fuzzPlaying
+	fuzzFinished
+	fuzzStages
+)
+
+// newFuzzGame 创建一个三人牌桌并推进到指定阶段，没有连接，也不等待
+func newFuzzGame(stage uint8, seed int64) *Game {
+	g := NewGame("fuzz", GameSettings{Mode: rules.GameModeLives, StartingLives: 2, BestOf: 3})
+	g.engine = rules.NewEngine(seed)
+	g.resultDelay = 0
+	g.countdownTick = time.Millisecond
+	seatPlayers(g)
+
+	switch stage % fuzzStages {
+	case fuzzPlaying:
+		beginPlay(g)
+
+	case fuzzFinished:
+		beginPlay(g)
+		g.mutex.Lock()
+		playToEnd(g)
+		g.mutex.Unlock()
+	}
+	return g
+}
+
+// FuzzHandleMessage 任意JSON消息都不能让消息处理崩溃
+func FuzzHandleMessage(f *testing.F) {
+	seeds := []string{
+		`{"type":"play_cards","cards":["Q","K"]}`,
+		`{"type":"play_cards","cards":[1,null,{"a":[]}]}`,
+		`{"type":"play_cards","cards":"Q"}`,
+		`{"type":"play_cards","cards":["Q","Q","Q","Q"]}`,
+		`{"type":"challenge","challenge":true,"reason":1}`,
+		`{"type":"challenge","challenge":"yes"}`,
+		`{"type":"ready","ready":"no"}`,
+		`{"type":"ready"}`,
+		`{"type":"start_game"}`,
+		`{"type":"rematch","accept":0}`,
+		`{"type":"update_settings","settings":{"mode":"lives","startingLives":-1}}`,
+		`{"type":"update_settings","settings":{"bestOf":"3"}}`,
+		`{"type":"update_settings","settings":[]}`,
+		`{"type":"kick_player","playerId":7}`,
+		`{"type":"transfer_host","playerId":"nobody"}`,
+		`{"type":"leave_game"}`,
+		`{"type":"chat","text":"hello"}`,
+		`{"type":"chat","text":"\u0000\u202e\n   "}`,
+		`{"type":"chat","text":["hi"]}`,
+		`{"type":"emote","emote":"laugh"}`,
+		`{"type":"emote","emote":"laugh","playerId":"nobody"}`,
+		`{"type":"emote","emote":"wink","playerId":3}`,
+		`{"type":"mute_player","playerId":"nobody","muted":false}`,
+		`{"type":"mute_player","playerId":null,"muted":"yes"}`,
+		`{"type":["play_cards"]}`,
+		`{}`,
+	}
+	for _, seed := range seeds {
+		for stage := uint8(0); stage < fuzzStages; stage++ {
+			f.Add(seed, stage, int64(1))
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data string, stage uint8, seed int64) {
+		var message map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &message); err != nil {
+			return
+		}
+
+		g := newFuzzGame(stage, seed)
+		players := append([]string{"nobody"}, g.PlayerOrder...)
+
+		// 每位玩家（以及不在座的人）都发送同一条消息，保证会轮到当前玩家
+		for _, playerID := range players {
+			g.handleMessage(playerID, message)
+		}
+	})
+}
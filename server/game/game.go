@@ -2,12 +2,16 @@ package game
 
 import (
 	_ "encoding/json"
+	"errors"
 	_ "fmt"
-	"log"
-	"math/rand"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"server/logging"
+	"server/rules"
+
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
@@ -20,39 +24,64 @@ const (
 	GameStateFinished = "finished" // 游戏已结束
 )
 
-// 卡牌类型
+// 玩家人数限制
 const (
-	CardQ     = "Q"
-	CardK     = "K"
-	CardA     = "A"
-	CardJoker = "Joker"
+	MinPlayers = rules.MinPlayers
+	MaxPlayers = rules.MaxPlayers
 )
 
-// Game 表示一个游戏实例
+// Game 表示一个游戏实例，牌局规则由 rules 包的引擎执行，
+// Game 负责座位、准备、房主、连接以及把事件推送给每位玩家
 type Game struct {
-	ID               string                     `json:"id"`
-	State            string                     `json:"state"`
-	Players          map[string]*Player         `json:"players"`
-	PlayerOrder      []string                   `json:"playerOrder"` // 玩家顺序
-	Connections      map[string]*websocket.Conn `json:"connections,omitempty"`
-	Deck             []string                   `json:"deck"`
-	TargetCard       string                     `json:"targetCard"`
-	CurrentPlayerIdx int                        `json:"currentPlayerIdx"`
-	LastShooterID    string                     `json:"lastShooterId"`
-	RoundCount       int                        `json:"roundCount"`
-	GameOver         bool                       `json:"gameOver"`
-	mutex            sync.RWMutex
+	ID            string                     `json:"id"`
+	State         string                     `json:"state"`
+	HostID        string                     `json:"hostId"` // 房主
+	Players       map[string]*Player         `json:"players"`
+	PlayerOrder   []string                   `json:"playerOrder"` // 玩家顺序
+	Connections   map[string]*websocket.Conn `json:"-"`
+	Settings      GameSettings               `json:"settings"`
+	Countdown     int                        `json:"countdown"` // 开局倒计时剩余秒数
+	Paused        bool                       `json:"paused"`    // 服务器关闭前在两轮之间暂停
+	CreatedAt     time.Time                  `json:"createdAt"`
+	LastActivity  time.Time                  `json:"lastActivity"`     // 最近一次玩家操作的时间
+	Events        []rules.Event              `json:"events"`           // 最近一局的事件日志
+	Chat          []ChatMessage              `json:"chat,omitempty"`   // 最近的聊天记录
+	Owners        []string                   `json:"owners,omitempty"` // 创建者的IP和用户，用于限制同时创建的游戏数
+	play          *rules.State               // 最近一局的状态，由事件日志折叠得到，还没开过局时为nil
+	engine        *rules.Engine              // 规则引擎
+	resultDelay   time.Duration              // 开枪和系统质疑后留给玩家查看结果的时间
+	countdownTick time.Duration              // 开局倒计时每一秒的实际间隔
+	maxPlayers    int                        // 每桌最多人数
+	messageLimit  RateLimit                  // 每个连接发送消息的频率
+	ownerCounted  atomic.Bool                // 是否仍计入创建者未结束的游戏数
+	names         NamePolicy                 // 玩家名字的规则
+	chatLimit     playerLimiter              // 每个玩家聊天的频率
+	chatFilter    ChatFilter                 // 聊天内容过滤，nil表示不过滤
+	emoteLimit    playerLimiter              // 每个玩家发表情的频率
+	archive       func(record *GameRecord)   // 一局结束时归档记录
+	finished      func(g *Game)              // 一局结束时通知管理器
+	draining      bool                       // 服务器正在关闭，不再开始新的一轮
+	countdownID   int                        // 当前倒计时的编号，用于取消过期的倒计时
+	rematching    bool                       // 当前倒计时是否由所有玩家同意再来一局触发
+	outbox        []rules.Event              // 等待推送的事件，展示结果期间产生的事件排在后面
+	outboxView    *rules.State               // 已推送事件折叠出的状态，用于生成后续消息
+	outboxAdvance bool                       // 推送完后是否需要结束这一局或开始下一轮
+	resultID      int                        // 当前结果展示计时器的编号，用于取消过期的计时器
+	resultPending bool                       // 是否正在等待玩家查看结果
+	stateDirty    bool                       // 展示结果期间有待广播的游戏状态
+	goroutines    atomic.Int64               // 仍在运行的连接读取、倒计时和结果计时goroutine数
+	mutex         sync.RWMutex
 }
 
-// Player 表示一个玩家
+// Player 表示一个入座的玩家，牌局中的手牌、命数等由 rules.Player 记录
 type Player struct {
-	ID                    string            `json:"id"`
-	Name                  string            `json:"name"`
-	Hand                  []string          `json:"hand,omitempty"` // 对其他玩家隐藏
-	Alive                 bool              `json:"alive"`
-	BulletPosition        int               `json:"bulletPosition,omitempty"`        // 对其他玩家隐藏
-	CurrentBulletPosition int               `json:"currentBulletPosition,omitempty"` // 对其他玩家隐藏
-	Opinions              map[string]string `json:"opinions"`                        // 对其他玩家的看法
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Ready     bool              `json:"ready"`               // 是否已准备
+	Opinions  map[string]string `json:"opinions"`            // 对其他玩家的看法
+	Muted     map[string]bool   `json:"muted,omitempty"`     // 屏蔽了聊天的玩家
+	ProfileID string            `json:"profileId,omitempty"` // 入座时令牌对应的匿名档案，用于统计战绩
+	Left      bool              `json:"left,omitempty"`      // 进行中离开或被踢出，本局结束时空出座位
 }
 
 // PlayerInitialState 记录玩家初始状态
@@ -77,6 +106,7 @@ type PlayAction struct {
 	WasChallenged   bool     `json:"wasChallenged"`
 	ChallengeReason string   `json:"challengeReason,omitempty"`
 	ChallengeResult *bool    `json:"challengeResult,omitempty"`
+	ChallengerID    string   `json:"challengerId,omitempty"` // 质疑的玩家，系统自动质疑时为空
 }
 
 // ShootingResult 记录一次开枪结果
@@ -84,6 +114,18 @@ type ShootingResult struct {
 	ShooterID   string `json:"shooterId"`
 	ShooterName string `json:"shooterName"`
 	BulletHit   bool   `json:"bulletHit"`
+	Eliminated  bool   `json:"eliminated,omitempty"` // 中弹后命数耗尽出局
+}
+
+// EmoteRecord 记录一次表情，AfterPlay 为发出时本轮已有的出牌次数，回放时据此插入时间线
+type EmoteRecord struct {
+	PlayerID   string    `json:"playerId"`
+	PlayerName string    `json:"playerName"`
+	TargetID   string    `json:"targetId,omitempty"`
+	TargetName string    `json:"targetName,omitempty"`
+	Emote      string    `json:"emote"`
+	AfterPlay  int       `json:"afterPlay"`
+	Time       time.Time `json:"time"`
 }
 
 // RoundRecord 记录一轮游戏
@@ -97,73 +139,133 @@ type RoundRecord struct {
 	PlayerOpinions      map[string]map[string]string `json:"playerOpinions"`
 	PlayHistory         []PlayAction                 `json:"playHistory"`
 	RoundResult         *ShootingResult              `json:"roundResult,omitempty"`
+	Forfeits            []string                     `json:"forfeits,omitempty"` // 本轮中途认输离开的玩家
+	Emotes              []EmoteRecord                `json:"emotes,omitempty"`   // 本轮玩家发出的表情
 }
 
 // GameRecord 完整游戏记录
 type GameRecord struct {
-	GameID      string        `json:"gameId"`
-	PlayerNames []string      `json:"playerNames"`
-	Rounds      []RoundRecord `json:"rounds"`
-	Winner      string        `json:"winner,omitempty"`
+	GameID      string             `json:"gameId"`
+	GameNumber  int                `json:"gameNumber"`
+	Settings    GameSettings       `json:"settings"`
+	PlayerNames []string           `json:"playerNames"`
+	Rounds      []RoundRecord      `json:"rounds"`
+	Scoreboard  []rules.ScoreEntry `json:"scoreboard,omitempty"`
+	Winner      string             `json:"winner,omitempty"`
+	WinnerID    string             `json:"winnerId,omitempty"`
+	Profiles    map[string]string  `json:"profiles,omitempty"` // 玩家ID到档案ID，只包含携带令牌入座的玩家
 }
 
 // NewGame 创建一个新的游戏实例
-func NewGame(id string) *Game {
-	rand.Seed(time.Now().UnixNano())
+func NewGame(id string, settings GameSettings) *Game {
+	now := time.Now()
 	return &Game{
-		ID:          id,
-		State:       GameStateWaiting,
-		Players:     make(map[string]*Player),
-		PlayerOrder: make([]string, 0),
-		Connections: make(map[string]*websocket.Conn),
-		Deck:        make([]string, 0),
-		GameOver:    false,
-		RoundCount:  0,
+		ID:            id,
+		CreatedAt:     now,
+		LastActivity:  now,
+		State:         GameStateWaiting,
+		Settings:      settings,
+		Players:       make(map[string]*Player),
+		PlayerOrder:   make([]string, 0),
+		Connections:   make(map[string]*websocket.Conn),
+		Events:        make([]rules.Event, 0),
+		engine:        rules.NewEngine(now.UnixNano()),
+		resultDelay:   DefaultResultDelay,
+		countdownTick: DefaultCountdownTick,
+		maxPlayers:    MaxPlayers,
 	}
 }
 
-// IsFull 检查游戏是否已满（最多4名玩家）
+// IsFull 检查游戏是否已满
 func (g *Game) IsFull() bool {
 	g.mutex.RLock()
 	defer g.mutex.RUnlock()
-	return len(g.Players) >= 4
+	return len(g.Players) >= g.maxPlayers
+}
+
+// IsWaiting 检查游戏是否仍在等待玩家加入
+func (g *Game) IsWaiting() bool {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	return g.State == GameStateWaiting
 }
 
-// AddPlayer 添加一个新玩家到游戏
-func (g *Game) AddPlayer(name string) string {
+// 不能加入游戏的原因
+var (
+	ErrGameStarted = errors.New("游戏已开始")
+	ErrGameFull    = errors.New("游戏已满")
+)
+
+// AddPlayer 添加一个新玩家到游戏，名字不合法时返回 *NameError，重名时按规则拒绝或加上编号
+func (g *Game) AddPlayer(name string) (string, error) {
+	return g.addPlayer(name, "")
+}
+
+// addPlayer 添加玩家并记下其档案ID，profileID 为空表示不统计战绩
+// 状态和人数在持有锁时检查，并发加入不会超员或在开局后入座
+func (g *Game) addPlayer(name string, profileID string) (string, error) {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
+	if g.State != GameStateWaiting {
+		return "", ErrGameStarted
+	}
+	if len(g.Players) >= g.maxPlayers {
+		return "", ErrGameFull
+	}
+
+	name, err := g.names.Normalize(name)
+	if err == nil {
+		name, err = g.uniqueName(name)
+	}
+	if err != nil {
+		return "", err
+	}
+
 	// 生成玩家ID
 	playerID := uuid.New().String()
 
 	// 创建玩家
 	player := &Player{
-		ID:                    playerID,
-		Name:                  name,
-		Hand:                  make([]string, 0),
-		Alive:                 true,
-		BulletPosition:        rand.Intn(6),
-		CurrentBulletPosition: 0,
-		Opinions:              make(map[string]string),
+		ID:        playerID,
+		Name:      name,
+		Opinions:  make(map[string]string),
+		ProfileID: profileID,
 	}
 
 	// 添加到游戏
 	g.Players[playerID] = player
 	g.PlayerOrder = append(g.PlayerOrder, playerID)
 
+	// 第一个入座的玩家成为房主
+	if g.HostID == "" {
+		g.HostID = playerID
+	}
+
 	// 广播玩家加入消息
 	g.broadcastGameState()
 
-	return playerID
+	return playerID, nil
 }
 
 // ConnectPlayer 将玩家的WebSocket连接添加到游戏
 func (g *Game) ConnectPlayer(playerID string, conn *websocket.Conn) {
 	g.mutex.Lock()
 
+	// 只接受在座玩家的连接（离开或被踢出的玩家不能再连回来）
+	if player, ok := g.Players[playerID]; !ok || player.Left {
+		g.mutex.Unlock()
+		writeMessage(conn, map[string]interface{}{
+			"type":    "error",
+			"message": "你不在这个游戏中",
+		})
+		conn.Close()
+		return
+	}
+
 	// 添加连接
 	g.Connections[playerID] = conn
+	g.LastActivity = time.Now()
 
 	// 设置关闭处理函数
 	conn.SetCloseHandler(func(code int, text string) error {
@@ -173,29 +275,62 @@ func (g *Game) ConnectPlayer(playerID string, conn *websocket.Conn) {
 		return nil
 	})
 
-	// 发送当前游戏状态给新连接的玩家
+	// 重连时补发待处理的出牌或质疑请求，和游戏中一样先发请求再发状态
+	if g.getCurrentPlayerID() == playerID {
+		g.notifyCurrentPlayer()
+	}
+
+	// 发送当前游戏状态和聊天记录给新连接的玩家
 	g.sendGameStateToPlayer(playerID)
+	g.sendChatHistory(playerID)
+
+	// 关闭前暂停的游戏在有玩家重连后开始下一轮
+	if g.State == GameStatePlaying && g.Paused && !g.draining {
+		g.Paused = false
+		g.nextRound()
+		g.broadcastGameState()
+	}
 
 	g.mutex.Unlock()
 
 	// 启动消息处理循环
+	g.goroutines.Add(1)
 	go g.handlePlayerMessages(playerID, conn)
 }
 
 // handlePlayerMessages 处理来自玩家的WebSocket消息
 func (g *Game) handlePlayerMessages(playerID string, conn *websocket.Conn) {
+	defer g.goroutines.Add(-1)
+
+	limiter := newMessageLimiter(g.messageLimit)
 	for {
 		// 读取消息
 		var message map[string]interface{}
 		err := conn.ReadJSON(&message)
 		if err != nil {
-			log.Printf("读取消息错误: %v", err)
+			slog.Info("连接断开", logging.KeyGameID, g.ID, logging.KeyPlayerID, playerID, logging.KeyError, err)
 			break
 		}
 
+		// 超过频率的消息直接丢弃，持续滥用时断开连接
+		if !limiter.allow() {
+			if g.rejectMessage(playerID, conn, limiter) {
+				break
+			}
+			continue
+		}
+
 		// 处理消息
 		g.handleMessage(playerID, message)
 	}
+
+	// 连接断开后移除，除非玩家已经用新连接重连
+	g.mutex.Lock()
+	if g.Connections[playerID] == conn {
+		delete(g.Connections, playerID)
+		g.LastActivity = time.Now()
+	}
+	g.mutex.Unlock()
 }
 
 // handleMessage 处理玩家发送的消息
@@ -203,34 +338,83 @@ func (g *Game) handleMessage(playerID string, message map[string]interface{}) {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
+	g.LastActivity = time.Now()
+	countReceived(message)
+
 	// 获取消息类型
 	msgType, ok := message["type"].(string)
 	if !ok {
-		log.Printf("无效的消息格式: 缺少type字段")
+		g.playerLogger(playerID).Warn("无效的消息格式: 缺少type字段")
 		return
 	}
 
 	// 根据消息类型处理
 	switch msgType {
+	case "ready":
+		// 切换准备状态，不带ready字段时取反
+		if g.State == GameStateWaiting || g.State == GameStateStarting {
+			player, ok := g.Players[playerID]
+			if !ok {
+				return
+			}
+			ready, ok := message["ready"].(bool)
+			if !ok {
+				ready = !player.Ready
+			}
+			g.handleReady(playerID, ready)
+		}
+
 	case "start_game":
-		// 只有当游戏处于等待状态且有足够的玩家时才能开始
-		if g.State == GameStateWaiting && len(g.Players) >= 2 {
-			g.startGame()
+		// 房主在所有玩家准备后开始倒计时
+		g.handleStartRequest(playerID)
+
+	case "update_settings":
+		// 房主在开始前修改规则
+		settingsData, ok := message["settings"].(map[string]interface{})
+		if !ok {
+			g.playerLogger(playerID).Warn("无效的规则格式")
+			return
+		}
+		g.handleUpdateSettings(playerID, settingsData)
+
+	case "kick_player":
+		// 房主踢出玩家
+		targetID, ok := message["playerId"].(string)
+		if !ok {
+			g.playerLogger(playerID).Warn("无效的踢人格式")
+			return
 		}
+		g.handleKickPlayer(playerID, targetID)
+
+	case "transfer_host":
+		// 房主转让房主身份
+		targetID, ok := message["playerId"].(string)
+		if !ok {
+			g.playerLogger(playerID).Warn("无效的转让格式")
+			return
+		}
+		g.handleTransferHost(playerID, targetID)
+
+	case "leave_game":
+		// 离开游戏，进行中则视为认输
+		g.handleLeave(playerID)
 
 	case "play_cards":
 		// 处理出牌
 		if g.State == GameStatePlaying && g.getCurrentPlayerID() == playerID {
 			cardsData, ok := message["cards"].([]interface{})
 			if !ok {
-				log.Printf("无效的出牌格式")
+				g.playerLogger(playerID).Warn("无效的出牌格式")
 				return
 			}
 
 			// 转换卡牌数据
 			cards := make([]string, len(cardsData))
 			for i, card := range cardsData {
-				cards[i] = card.(string)
+				if cards[i], ok = card.(string); !ok {
+					g.sendError(playerID, "无效的出牌格式")
+					return
+				}
 			}
 
 			// 处理出牌逻辑
@@ -242,18 +426,67 @@ func (g *Game) handleMessage(playerID string, message map[string]interface{}) {
 		if g.State == GameStatePlaying {
 			challenge, ok := message["challenge"].(bool)
 			if !ok {
-				log.Printf("无效的质疑格式")
+				g.playerLogger(playerID).Warn("无效的质疑格式")
 				return
 			}
 
 			reason, _ := message["reason"].(string)
 			g.handleChallenge(playerID, challenge, reason)
 		}
+
+	case "chat":
+		// 聊天，出局的玩家在出局频道发言
+		text, ok := message["text"].(string)
+		if !ok {
+			g.playerLogger(playerID).Warn("无效的聊天格式")
+			return
+		}
+		g.handleChat(playerID, text)
+
+	case "emote":
+		// 表情，带playerId时对某位玩家，否则对全桌
+		emote, ok := message["emote"].(string)
+		if !ok {
+			g.playerLogger(playerID).Warn("无效的表情格式")
+			return
+		}
+		targetID, _ := message["playerId"].(string)
+		g.handleEmote(playerID, targetID, emote)
+
+	case "mute_player":
+		// 屏蔽或取消屏蔽另一名玩家的聊天，不带muted字段时视为屏蔽
+		targetID, ok := message["playerId"].(string)
+		if !ok {
+			g.playerLogger(playerID).Warn("无效的屏蔽格式")
+			return
+		}
+		muted, ok := message["muted"].(bool)
+		if !ok {
+			muted = true
+		}
+		g.handleMute(playerID, targetID, muted)
+
+	case "rematch":
+		// 处理再来一局，不带accept字段时视为同意
+		// 第一局的开局倒计时不接受再来一局的表态
+		if g.State == GameStateFinished || (g.State == GameStateStarting && g.rematching) {
+			accept, ok := message["accept"].(bool)
+			if !ok {
+				accept = true
+			}
+			g.handleRematch(playerID, accept)
+		}
 	}
 }
 
 // broadcastGameState 向所有连接的玩家广播游戏状态
 func (g *Game) broadcastGameState() {
+	// 结果还在展示时推迟广播，避免状态跑在事件消息前面
+	if g.resultPending {
+		g.stateDirty = true
+		return
+	}
+
 	for playerID := range g.Connections {
 		g.sendGameStateToPlayer(playerID)
 	}
@@ -270,7 +503,7 @@ func (g *Game) sendGameStateToPlayer(playerID string) {
 	gameState := g.createGameStateForPlayer(playerID)
 
 	// 发送游戏状态
-	conn.WriteJSON(map[string]interface{}{
+	writeMessage(conn, map[string]interface{}{
 		"type":  "game_state",
 		"state": gameState,
 	})
@@ -278,33 +511,46 @@ func (g *Game) sendGameStateToPlayer(playerID string) {
 
 // createGameStateForPlayer 创建针对特定玩家的游戏状态视图
 func (g *Game) createGameStateForPlayer(playerID string) map[string]interface{} {
+	play := g.currentPlay()
+
 	// 基本游戏信息
 	gameState := map[string]interface{}{
 		"id":               g.ID,
 		"state":            g.State,
-		"currentPlayerIdx": g.CurrentPlayerIdx,
-		"roundCount":       g.RoundCount,
-		"gameOver":         g.GameOver,
-		"targetCard":       g.TargetCard,
+		"currentPlayerIdx": g.seatIndex(play.CurrentPlayerID()),
+		"roundCount":       play.RoundCount,
+		"gameOver":         play.GameOver,
+		"targetCard":       play.TargetCard,
+		"settings":         g.Settings,
+		"scoreboard":       g.scoreboard(),
+		"gameNumber":       play.GameNumber,
+		"matchWins":        play.MatchWins,
+		"countdown":        g.Countdown,
+		"paused":           g.Paused,
+		"hostId":           g.HostID,
 	}
 
 	// 玩家信息（隐藏其他玩家的手牌和子弹位置）
 	players := make(map[string]interface{})
 	for id, player := range g.Players {
+		stats := g.playerStats(id)
 		playerView := map[string]interface{}{
 			"id":    player.ID,
 			"name":  player.Name,
-			"alive": player.Alive,
+			"alive": stats.Alive,
+			"ready": player.Ready,
+			"lives": stats.Lives,
+			"score": stats.Score,
 		}
 
 		// 只向当前玩家展示自己的手牌和子弹位置
 		if id == playerID {
-			playerView["hand"] = player.Hand
-			playerView["bulletPosition"] = player.BulletPosition
-			playerView["currentBulletPosition"] = player.CurrentBulletPosition
+			playerView["hand"] = stats.Hand
+			playerView["bulletPosition"] = stats.BulletPosition
+			playerView["currentBulletPosition"] = stats.CurrentBulletPosition
 		} else {
 			// 对其他玩家只显示手牌数量
-			playerView["handCount"] = len(player.Hand)
+			playerView["handCount"] = len(stats.Hand)
 		}
 
 		// 添加到玩家列表
@@ -318,395 +564,14 @@ func (g *Game) createGameStateForPlayer(playerID string) map[string]interface{}
 	gameState["playerOrder"] = g.PlayerOrder
 
 	// 如果游戏已结束，添加胜利者信息
-	if g.GameOver {
-		for _, player := range g.Players {
-			if player.Alive {
-				gameState["winner"] = player.Name
-				break
-			}
-		}
-	}
-
-	return gameState
-}
-
-// broadcastPlayAction 广播出牌行为
-func (g *Game) broadcastPlayAction(action PlayAction) {
-	// 创建广播消息
-	message := map[string]interface{}{
-		"type":       "play_action",
-		"playerName": action.PlayerName,
-		"cardCount":  len(action.PlayedCards),
-		"targetCard": g.TargetCard,
-		"nextPlayer": action.NextPlayerName,
-	}
-
-	// 广播给所有玩家
-	for playerID, conn := range g.Connections {
-		// 对出牌玩家显示实际打出的牌
-		if playerID == action.PlayerID {
-			message["playedCards"] = action.PlayedCards
-		}
-		conn.WriteJSON(message)
-	}
-}
-
-// waitForChallenge 等待下一个玩家决定是否质疑
-func (g *Game) waitForChallenge(nextPlayerID string, playAction PlayAction) {
-	// 通知下一个玩家需要决定是否质疑
-	conn, ok := g.Connections[nextPlayerID]
-	if !ok {
-		return
-	}
-
-	// 发送质疑请求
-	conn.WriteJSON(map[string]interface{}{
-		"type":       "challenge_request",
-		"playerName": playAction.PlayerName,
-		"cardCount":  len(playAction.PlayedCards),
-		"targetCard": g.TargetCard,
-	})
-}
-
-// handleChallenge 处理玩家质疑
-func (g *Game) handleChallenge(playerID string, challenge bool, reason string) {
-	// 获取当前玩家和上一个玩家
-	currentPlayerIdx := -1
-	for i, id := range g.PlayerOrder {
-		if id == playerID {
-			currentPlayerIdx = i
-			break
-		}
-	}
-
-	if currentPlayerIdx == -1 {
-		return
-	}
-
-	// 找到上一个玩家（出牌者）
-	prevPlayerIdx := (currentPlayerIdx - 1 + len(g.PlayerOrder)) % len(g.PlayerOrder)
-	for !g.Players[g.PlayerOrder[prevPlayerIdx]].Alive || len(g.Players[g.PlayerOrder[prevPlayerIdx]].Hand) == 0 {
-		prevPlayerIdx = (prevPlayerIdx - 1 + len(g.PlayerOrder)) % len(g.PlayerOrder)
-		if prevPlayerIdx == currentPlayerIdx {
-			return // 没有找到有效的上一个玩家
-		}
-	}
-
-	prevPlayerID := g.PlayerOrder[prevPlayerIdx]
-	//prevPlayer := g.Players[prevPlayerID]
-
-	// 如果玩家选择不质疑
-	if !challenge {
-		// 广播不质疑的消息
-		g.broadcastChallengeResult(playerID, false, false, reason)
-
-		// 切换到下一个玩家
-		g.CurrentPlayerIdx = currentPlayerIdx
-		g.moveToNextPlayer()
-		return
-	}
-
-	// 玩家选择质疑，验证上一个玩家的出牌是否合法
-	// 这里需要获取上一次出牌的信息
-	// 简化处理，假设我们能从某处获取到上一次出牌信息
-	lastPlayedCards := make([]string, 0) // 这里应该从游戏记录中获取
-
-	// 验证出牌是否合法
-	isValid := g.isValidPlay(lastPlayedCards)
-
-	// 广播质疑结果
-	g.broadcastChallengeResult(playerID, true, isValid, reason)
-
-	// 根据质疑结果确定受罚玩家
-	penaltyPlayerID := ""
-	if isValid {
-		// 质疑失败，质疑者受罚
-		penaltyPlayerID = playerID
-	} else {
-		// 质疑成功，出牌者受罚
-		penaltyPlayerID = prevPlayerID
-	}
-
-	// 记录最后射击者
-	g.LastShooterID = penaltyPlayerID
-
-	// 执行惩罚
-	g.performPenalty(penaltyPlayerID)
-}
-
-// isValidPlay 判断出牌是否符合规则
-func (g *Game) isValidPlay(cards []string) bool {
-	for _, card := range cards {
-		if card != g.TargetCard && card != CardJoker {
-			return false
-		}
-	}
-	return true
-}
-
-// broadcastChallengeResult 广播质疑结果
-func (g *Game) broadcastChallengeResult(challengerID string, challenged bool, challengeSuccess bool, reason string) {
-	challenger := g.Players[challengerID]
-
-	// 创建广播消息
-	message := map[string]interface{}{
-		"type":            "challenge_result",
-		"challengerName":  challenger.Name,
-		"wasChallenged":   challenged,
-		"challengeReason": reason,
-	}
-
-	if challenged {
-		message["challengeSuccess"] = challengeSuccess
-	}
-
-	// 广播给所有玩家
-	for _, conn := range g.Connections {
-		conn.WriteJSON(message)
-	}
-}
-
-// moveToNextPlayer 切换到下一个玩家
-func (g *Game) moveToNextPlayer() {
-	// 找到下一个有手牌的玩家
-	g.CurrentPlayerIdx = g.findNextPlayerWithCards(g.CurrentPlayerIdx)
-
-	// 广播游戏状态
-	g.broadcastGameState()
-
-	// 通知当前玩家轮到他出牌
-	g.notifyCurrentPlayer()
-}
-
-// findNextPlayerWithCards 找到下一个有手牌的玩家
-func (g *Game) findNextPlayerWithCards(startIdx int) int {
-	idx := startIdx
-	for i := 0; i < len(g.PlayerOrder); i++ {
-		idx = (idx + 1) % len(g.PlayerOrder)
-		playerID := g.PlayerOrder[idx]
-		player := g.Players[playerID]
-		if player.Alive && len(player.Hand) > 0 {
-			return idx
-		}
-	}
-	return startIdx // 如果没有其他玩家有手牌，返回当前玩家
-}
-
-// performPenalty 执行惩罚
-func (g *Game) performPenalty(playerID string) {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
-
-	// 获取玩家
-	player := g.Players[playerID]
-	if player == nil {
-		return
-	}
-
-	// 执行射击
-	log.Printf("玩家 %s 开枪！", player.Name)
-
-	// 增加当前子弹位置
-	player.CurrentBulletPosition = (player.CurrentBulletPosition + 1) % 6
-
-	// 检查是否命中
-	bulletHit := player.CurrentBulletPosition == player.BulletPosition
-
-	// 记录射击结果
-	shootingResult := ShootingResult{
-		ShooterID:   playerID,
-		ShooterName: player.Name,
-		BulletHit:   bulletHit,
-	}
-
-	// 广播射击结果
-	g.broadcastShootingResult(shootingResult)
-
-	// 如果子弹命中，玩家死亡
-	if bulletHit {
-		player.Alive = false
-		log.Printf("%s 已死亡！", player.Name)
-
-		// 检查胜利条件
-		if !g.checkVictory() {
-			// 重置回合
-			g.resetRound(true)
-		}
-	} else {
-		// 子弹未命中，重置回合
-		g.resetRound(true)
-	}
-}
-
-// broadcastShootingResult 广播射击结果
-func (g *Game) broadcastShootingResult(result ShootingResult) {
-	// 创建广播消息
-	message := map[string]interface{}{
-		"type":        "shooting_result",
-		"shooterName": result.ShooterName,
-		"bulletHit":   result.BulletHit,
-	}
-
-	// 广播给所有玩家
-	for _, conn := range g.Connections {
-		conn.WriteJSON(message)
-	}
-
-	// 给玩家一些时间查看结果
-	time.Sleep(2 * time.Second)
-}
-
-// resetRound 重置回合
-func (g *Game) resetRound(recordShooter bool) {
-	log.Println("小局游戏重置，开始新的一局！")
-
-	// 重新发牌
-	g.dealCards()
-	g.chooseTargetCard()
-
-	if recordShooter && g.LastShooterID != "" {
-		// 从上一个射击者开始
-		shooterIdx := -1
-		for i, id := range g.PlayerOrder {
-			if id == g.LastShooterID {
-				shooterIdx = i
-				break
-			}
+	if play.GameOver {
+		if winner, ok := play.Players[play.WinnerID]; ok {
+			gameState["winner"] = winner.Name
 		}
-
-		if shooterIdx >= 0 && g.Players[g.LastShooterID].Alive {
-			g.CurrentPlayerIdx = shooterIdx
-		} else {
-			// 射击者已死亡，顺延至下一个存活且有手牌的玩家
-			g.CurrentPlayerIdx = g.findNextPlayerWithCards(shooterIdx)
-		}
-	} else {
-		// 随机选择一个存活的玩家
-		alivePlayers := make([]string, 0)
-		for _, id := range g.PlayerOrder {
-			if g.Players[id].Alive {
-				alivePlayers = append(alivePlayers, id)
-			}
-		}
-
-		if len(alivePlayers) > 0 {
-			randomIdx := rand.Intn(len(alivePlayers))
-			playerID := alivePlayers[randomIdx]
-
-			// 找到这个玩家在PlayerOrder中的索引
-			for i, id := range g.PlayerOrder {
-				if id == playerID {
-					g.CurrentPlayerIdx = i
-					break
-				}
-			}
-		}
-	}
-
-	// 开始新回合
-	g.startRound()
-
-	// 广播游戏状态
-	g.broadcastGameState()
-
-	// 通知当前玩家轮到他出牌
-	g.notifyCurrentPlayer()
-}
-
-// checkVictory 检查胜利条件
-func (g *Game) checkVictory() bool {
-	// 统计存活玩家
-	alivePlayers := make([]string, 0)
-	for _, id := range g.PlayerOrder {
-		if g.Players[id].Alive {
-			alivePlayers = append(alivePlayers, id)
+		if seriesWinner, ok := play.Players[play.SeriesWinnerID]; ok {
+			gameState["seriesWinner"] = seriesWinner.Name
 		}
 	}
 
-	// 如果只剩一名玩家，游戏结束
-	if len(alivePlayers) == 1 {
-		winnerID := alivePlayers[0]
-		winner := g.Players[winnerID]
-
-		log.Printf("\n%s 获胜！", winner.Name)
-
-		// 更新游戏状态
-		g.State = GameStateFinished
-		g.GameOver = true
-
-		// 广播胜利消息
-		g.broadcastVictory(winnerID)
-
-		return true
-	}
-
-	return false
-}
-
-// broadcastVictory 广播胜利消息
-func (g *Game) broadcastVictory(winnerID string) {
-	winner := g.Players[winnerID]
-
-	// 创建广播消息
-	message := map[string]interface{}{
-		"type":       "game_over",
-		"winnerName": winner.Name,
-	}
-
-	// 广播给所有玩家
-	for _, conn := range g.Connections {
-		conn.WriteJSON(message)
-	}
-}
-
-// handleSystemChallenge 处理系统自动质疑
-func (g *Game) handleSystemChallenge(playerID string, cards []string) {
-	log.Printf("系统自动质疑 %s 的手牌！", g.Players[playerID].Name)
-
-	// 验证出牌是否合法
-	isValid := g.isValidPlay(cards)
-
-	// 广播系统质疑结果
-	g.broadcastSystemChallengeResult(playerID, isValid, cards)
-
-	if isValid {
-		log.Printf("系统质疑失败！%s 的手牌符合规则。", g.Players[playerID].Name)
-		// 重置回合
-		g.resetRound(false)
-	} else {
-		log.Printf("系统质疑成功！%s 的手牌违规，将执行射击惩罚。", g.Players[playerID].Name)
-		// 记录最后射击者
-		g.LastShooterID = playerID
-		// 执行惩罚
-		g.performPenalty(playerID)
-	}
-}
-
-// broadcastSystemChallengeResult 广播系统质疑结果
-func (g *Game) broadcastSystemChallengeResult(playerID string, isValid bool, cards []string) {
-	// 创建广播消息
-	message := map[string]interface{}{
-		"type":           "system_challenge",
-		"playerName":     g.Players[playerID].Name,
-		"challengeValid": !isValid, // 质疑成功意味着出牌不合法
-		"playedCards":    cards,
-	}
-
-	// 广播给所有玩家
-	for _, conn := range g.Connections {
-		conn.WriteJSON(message)
-	}
-
-	// 给玩家一些时间查看结果
-	time.Sleep(2 * time.Second)
-}
-
-// checkOtherPlayersNoCards 检查是否所有其他存活玩家都没有手牌
-func (g *Game) checkOtherPlayersNoCards(playerID string) bool {
-	for id, player := range g.Players {
-		if id != playerID && player.Alive && len(player.Hand) > 0 {
-			return false
-		}
-	}
-	return true
+	return gameState
 }
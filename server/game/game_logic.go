@@ -1,169 +1,272 @@
 package game
 
 import (
-	"log"
-	"math/rand"
 	"time"
+
+	"server/logging"
+	"server/rules"
 )
 
-// startGame 开始游戏
+// startGame 开始游戏，调用方需持有锁
 func (g *Game) startGame() {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	seats := make([]rules.Seat, 0, len(g.PlayerOrder))
+	for _, playerID := range g.PlayerOrder {
+		seats = append(seats, rules.Seat{ID: playerID, Name: g.Players[playerID].Name})
+	}
+
+	if err := g.act(rules.StartGame{Seats: seats, Settings: g.Settings}); err != nil {
+		g.logger().Warn("无法开始游戏", logging.KeyError, err)
+		g.cancelCountdown(err.Error())
+		return
+	}
 
 	// 更新游戏状态
-	g.State = GameStatePlaying
-	g.GameOver = false
-	g.RoundCount = 0
+	if err := g.setState(GameStatePlaying); err != nil {
+		g.logger().Error("无法开始游戏", logging.KeyError, err)
+	}
+	g.Countdown = 0
+	g.rematching = false
+	for _, player := range g.Players {
+		player.Ready = false
+	}
 
-	// 随机选择起始玩家
-	g.CurrentPlayerIdx = rand.Intn(len(g.PlayerOrder))
+	// 广播游戏状态
+	g.broadcastGameState()
+}
 
-	// 发牌并选择目标牌
-	g.dealCards()
-	g.chooseTargetCard()
+// act 将动作交给规则引擎执行，记录并推送产生的事件，然后结束这一局或开始下一轮
+func (g *Game) act(action rules.Action) error {
+	next, events, err := g.engine.Apply(g.play, action)
+	if err != nil {
+		return err
+	}
 
-	// 开始第一轮
-	g.startRound()
+	// 事件立即记入日志，推送则按顺序排队，让每条消息都基于事件发生时的状态
+	if !g.resultPending {
+		g.outboxView = g.currentPlay().Clone()
+	}
+	for _, ev := range events {
+		// 每局开始新的事件日志
+		if ev.Type == rules.EventGameStarted {
+			g.Events = make([]rules.Event, 0)
+		}
+		g.Events = append(g.Events, ev)
+		countEvent(ev)
+	}
+	g.play = next
+	g.outbox = append(g.outbox, events...)
 
-	// 广播游戏状态
-	g.broadcastGameState()
+	// 表情只记入日志，不推进牌局，暂停中的游戏也不会因此开始下一轮或重复通知暂停
+	if _, ok := action.(rules.Emote); !ok {
+		g.outboxAdvance = true
+	}
 
-	// 通知当前玩家轮到他出牌
-	g.notifyCurrentPlayer()
+	// 正在展示结果时，新事件等计时器到期后再推送
+	if !g.resultPending {
+		g.flush()
+	}
+	return nil
 }
 
-// dealCards 发牌
-func (g *Game) dealCards() {
-	// 创建并洗牌
-	g.Deck = g.createDeck()
+// flush 按顺序推送排队的事件，遇到开枪或系统质疑时先给玩家时间查看结果，调用方需持有锁
+func (g *Game) flush() {
+	for len(g.outbox) > 0 {
+		ev := g.outbox[0]
+		g.outbox = g.outbox[1:]
+		g.outboxView.Apply(ev)
+		g.publish(g.outboxView, ev)
 
-	// 清空所有玩家手牌
-	for _, player := range g.Players {
-		if player.Alive {
-			player.Hand = make([]string, 0)
+		// 给玩家一些时间查看结果，计时期间释放锁，和倒计时一样由计时器继续
+		if g.resultDelay > 0 && len(g.Connections) > 0 && (ev.Type == rules.EventShotFired || (ev.Type == rules.EventChallengeResolved && ev.System)) {
+			g.resultID++
+			g.resultPending = true
+			g.goroutines.Add(1)
+			resultID := g.resultID
+			time.AfterFunc(g.resultDelay, func() { g.resumeFlush(resultID) })
+			return
 		}
 	}
 
-	// 每位玩家发5张牌
-	for i := 0; i < 5; i++ {
-		for _, playerID := range g.PlayerOrder {
-			player := g.Players[playerID]
-			if player.Alive && len(g.Deck) > 0 {
-				// 从牌堆顶部抽一张牌
-				card := g.Deck[0]
-				g.Deck = g.Deck[1:]
-				player.Hand = append(player.Hand, card)
-			}
+	if g.outboxAdvance {
+		g.outboxAdvance = false
+		if g.State == GameStatePlaying && g.play.GameOver {
+			g.finish()
+		} else if g.State == GameStatePlaying && g.play.RoundOver {
+			g.nextRound()
 		}
 	}
+
+	// 补发展示结果期间推迟的游戏状态
+	if g.stateDirty && !g.resultPending {
+		g.stateDirty = false
+		g.broadcastGameState()
+	}
 }
 
-// createDeck 创建并洗牌牌组
-func (g *Game) createDeck() []string {
-	deck := make([]string, 0)
+// resumeFlush 结果展示结束后继续推送，计时器已被取消或取代时直接返回
+func (g *Game) resumeFlush(resultID int) {
+	defer g.goroutines.Add(-1)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
 
-	// 添加牌
-	for i := 0; i < 6; i++ {
-		deck = append(deck, CardQ)
+	if !g.resultPending || g.resultID != resultID {
+		return
 	}
-	for i := 0; i < 6; i++ {
-		deck = append(deck, CardK)
+	g.resultPending = false
+	g.flush()
+}
+
+// publish 向每位玩家推送事件对应的消息
+func (g *Game) publish(view *rules.State, ev rules.Event) {
+	g.logEvent(view, ev)
+	if ev.Type == rules.EventTargetChosen {
+		gameLogger(g.ID, view).Info("开始新的一轮", logging.KeyPlayerID, ev.PlayerID, logging.KeyTargetCard, ev.Card)
 	}
-	for i := 0; i < 6; i++ {
-		deck = append(deck, CardA)
+
+	for viewerID, conn := range g.Connections {
+		if ev.Type == rules.EventEmote && g.isMuted(viewerID, ev.PlayerID) {
+			continue
+		}
+		for _, message := range project(view, ev, viewerID) {
+			writeMessage(conn, message)
+		}
 	}
-	for i := 0; i < 2; i++ {
-		deck = append(deck, CardJoker)
+}
+
+// nextRound 一轮结束后开始下一轮，服务器正在关闭时暂停，等重启后继续
+func (g *Game) nextRound() {
+	if g.draining {
+		g.pause()
+		return
 	}
 
-	// 洗牌
-	rand.Seed(time.Now().UnixNano())
-	rand.Shuffle(len(deck), func(i, j int) {
-		deck[i], deck[j] = deck[j], deck[i]
-	})
+	if err := g.act(rules.NextRound{}); err != nil {
+		g.logger().Error("无法开始下一轮", logging.KeyError, err)
+	}
+}
 
-	return deck
+// finish 一局结束：切换到结束状态并归档记录
+func (g *Game) finish() {
+	if err := g.setState(GameStateFinished); err != nil {
+		g.logger().Error("无法结束游戏", logging.KeyError, err)
+	}
+
+	g.observeGameDuration()
+	g.logger().Info("游戏结束", "winner_id", g.play.WinnerID, "series_winner_id", g.play.SeriesWinnerID)
+
+	// 归档本局记录，记录中仍包含中途离开的玩家
+	if g.archive != nil {
+		g.archive(g.record())
+	}
+	g.removeLeftSeats()
+
+	if g.finished != nil {
+		g.finished(g)
+	}
 }
 
-// chooseTargetCard 随机选择目标牌
-func (g *Game) chooseTargetCard() {
-	targetCards := []string{CardQ, CardK, CardA}
-	g.TargetCard = targetCards[rand.Intn(len(targetCards))]
-	log.Printf("目标牌是: %s", g.TargetCard)
+// currentPlay 返回最近一局的状态，还没开过局时返回空状态
+func (g *Game) currentPlay() *rules.State {
+	if g.play == nil {
+		return rules.NewState()
+	}
+	return g.play
 }
 
-// startRound 开始新的回合
-func (g *Game) startRound() {
-	g.RoundCount++
-	log.Printf("开始第 %d 轮", g.RoundCount)
+// playerStats 返回玩家在牌局中的状态，开局前按规则显示初始状态
+func (g *Game) playerStats(playerID string) rules.Player {
+	if g.State == GameStatePlaying || g.State == GameStateFinished {
+		if stats, ok := g.currentPlay().Players[playerID]; ok {
+			return *stats
+		}
+	}
+	return rules.Player{
+		ID:    playerID,
+		Hand:  make([]string, 0),
+		Alive: true,
+		Lives: g.Settings.StartingLives,
+	}
+}
 
-	// 获取当前玩家
-	currentPlayerID := g.PlayerOrder[g.CurrentPlayerIdx]
-	currentPlayer := g.Players[currentPlayerID]
+// scoreboard 生成在座玩家的积分榜
+func (g *Game) scoreboard() []rules.ScoreEntry {
+	entries := make([]rules.ScoreEntry, 0, len(g.PlayerOrder))
+	for _, playerID := range g.PlayerOrder {
+		stats := g.playerStats(playerID)
+		entries = append(entries, rules.ScoreEntry{
+			PlayerID:   playerID,
+			PlayerName: g.Players[playerID].Name,
+			Lives:      stats.Lives,
+			Score:      stats.Score,
+			Alive:      stats.Alive,
+			ScoredSeq:  stats.ScoredSeq,
+		})
+	}
+	rules.SortScores(entries, g.Settings.MaxRounds > 0)
+	return entries
+}
 
-	// 记录回合开始信息
-	log.Printf("从玩家 %s 开始", currentPlayer.Name)
+// seatIndex 返回玩家在座位顺序中的位置
+func (g *Game) seatIndex(playerID string) int {
+	for i, id := range g.PlayerOrder {
+		if id == playerID {
+			return i
+		}
+	}
+	return -1
 }
 
 // getCurrentPlayerID 获取当前玩家ID
 func (g *Game) getCurrentPlayerID() string {
-	if g.CurrentPlayerIdx >= 0 && g.CurrentPlayerIdx < len(g.PlayerOrder) {
-		return g.PlayerOrder[g.CurrentPlayerIdx]
+	if g.State != GameStatePlaying {
+		return ""
 	}
-	return ""
+	return g.currentPlay().CurrentPlayerID()
 }
 
-// notifyCurrentPlayer 通知当前玩家轮到他出牌
-func (g *Game) notifyCurrentPlayer() {
-	currentPlayerID := g.getCurrentPlayerID()
-	if currentPlayerID == "" {
+// handlePlayCards 处理玩家出牌
+func (g *Game) handlePlayCards(playerID string, cards []string) {
+	if err := g.act(rules.PlayCards{PlayerID: playerID, Cards: cards}); err != nil {
+		g.sendError(playerID, err.Error())
+		return
+	}
+	g.broadcastGameState()
+}
+
+// handleChallenge 处理玩家质疑
+func (g *Game) handleChallenge(playerID string, challenge bool, reason string) {
+	if err := g.act(rules.Challenge{PlayerID: playerID, Challenge: challenge, Reason: reason}); err != nil {
+		g.sendError(playerID, err.Error())
 		return
 	}
+	g.broadcastGameState()
+}
 
+// notifyCurrentPlayer 重新提醒当前玩家需要出牌或决定是否质疑
+func (g *Game) notifyCurrentPlayer() {
+	currentPlayerID := g.getCurrentPlayerID()
 	conn, ok := g.Connections[currentPlayerID]
-	if !ok {
+	if !ok || g.Paused || g.play.RoundOver {
 		return
 	}
 
-	// 发送通知
-	conn.WriteJSON(map[string]interface{}{
-		"type":    "your_turn",
-		"message": "轮到你出牌了",
-	})
+	if g.play.AwaitingChallenge && g.play.LastPlay != nil {
+		writeMessage(conn, challengeRequestMessage(g.play))
+		return
+	}
+	writeMessage(conn, yourTurnMessage())
 }
 
-// handlePlayCards 处理玩家出牌
-func (g *Game) handlePlayCards(playerID string, cards []string) {
-	// 验证是否是当前玩家
-	if g.getCurrentPlayerID() != playerID {
+// sendError 向玩家发送错误消息
+func (g *Game) sendError(playerID string, message string) {
+	conn, ok := g.Connections[playerID]
+	if !ok {
 		return
 	}
 
-	// 获取玩家
-	player := g.Players[playerID]
-
-	// 验证玩家手牌中是否有这些牌
-	for _, card := range cards {
-		found := false
-		for i, handCard := range player.Hand {
-			if handCard == card {
-				// 从手牌中移除
-				player.Hand = append(player.Hand[:i], player.Hand[i+1:]...)
-				found = true
-				break
-			}
-		}
-		if !found {
-			// 玩家没有这张牌，发送错误消息
-			conn, ok := g.Connections[playerID]
-			if ok {
-				conn.WriteJSON(map[string]interface{}{
-					"type":    "error",
-					"message": "你没有这张牌",
-				})
-			}
-			return
-		}
-	}
+	writeMessage(conn, map[string]interface{}{
+		"type":    "error",
+		"message": message,
+	})
 }
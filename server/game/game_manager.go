@@ -2,34 +2,244 @@ package game
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"server/rules"
 
 	"github.com/google/uuid"
 )
 
+// ManagerOptions 游戏管理器的配置
+type ManagerOptions struct {
+	WaitingTTL       time.Duration  // 等待中的牌桌无人操作多久后回收
+	AbandonedTTL     time.Duration  // 进行中的游戏所有玩家断开多久后回收
+	FinishedTTL      time.Duration  // 已结束的游戏保留多久
+	JanitorInterval  time.Duration  // 回收检查间隔，0表示不回收
+	Archiver         RecordArchiver // 游戏记录归档，nil表示不归档
+	Profiles         *ProfileStore  // 按匿名浏览器档案统计的战绩，nil表示不统计
+	Identities       *IdentityKey   // 签发和校验身份令牌的密钥，nil表示使用随机密钥
+	SnapshotDir      string         // 游戏快照目录，为空表示不保存快照
+	SnapshotInterval time.Duration  // 定期保存快照的间隔，0表示只在关闭时保存
+	ResultDelay      time.Duration  // 开枪和系统质疑后留给玩家查看结果的时间
+	CountdownTick    time.Duration  // 开局倒计时每一秒的实际间隔
+	Seed             int64          // 规则引擎的随机种子，0表示使用当前时间
+	MaxGames         int            // 同时存在的游戏数上限，0表示不限
+	MaxPlayers       int            // 每桌最多人数，0表示使用 MaxPlayers
+	Deck             rules.Deck     // 牌组构成，为零值时使用默认牌组
+	DefaultSettings  GameSettings   // 创建游戏时请求中没有给出的规则取这里的值
+	CreateLimit      RateLimit      // 每个IP和每个用户创建游戏的频率
+	JoinLimit        RateLimit      // 每个IP和每个用户加入游戏的频率
+	MessageLimit     RateLimit      // 每个WebSocket连接发送消息的频率
+	MaxGamesPerUser  int            // 每个用户令牌同时创建的未结束游戏数上限，0表示不限
+	MaxGamesPerIP    int            // 每个IP（不论是否带令牌）同时创建的未结束游戏数上限，0表示不限
+	TrustedProxies   TrustedProxies // 可信的反向代理，为空时只按连接地址识别来源IP
+	Names            NamePolicy     // 玩家名字的规则
+	ChatLimit        RateLimit      // 每个玩家聊天的频率
+	ChatFilter       ChatFilter     // 聊天内容过滤，nil表示不过滤
+	EmoteLimit       RateLimit      // 每个玩家发表情的频率
+}
+
+// DefaultManagerOptions 返回默认的管理器配置
+func DefaultManagerOptions() ManagerOptions {
+	return ManagerOptions{
+		WaitingTTL:       30 * time.Minute,
+		AbandonedTTL:     10 * time.Minute,
+		FinishedTTL:      5 * time.Minute,
+		JanitorInterval:  time.Minute,
+		SnapshotDir:      "snapshots",
+		SnapshotInterval: 30 * time.Second,
+		ResultDelay:      DefaultResultDelay,
+		CountdownTick:    DefaultCountdownTick,
+		CreateLimit:      RateLimit{Rate: 0.2, Burst: 5},
+		JoinLimit:        RateLimit{Rate: 1, Burst: 10},
+		MessageLimit:     RateLimit{Rate: 10, Burst: 30},
+		MaxGamesPerUser:  5,
+		MaxGamesPerIP:    20,
+		ChatLimit:        RateLimit{Rate: 0.5, Burst: 5},
+		EmoteLimit:       RateLimit{Rate: 1, Burst: 3},
+	}
+}
+
 // GameManager 管理所有游戏实例
 type GameManager struct {
 	games      map[string]*Game
 	gamesMutex sync.RWMutex
+	options    ManagerOptions
+	seeds      *rand.Rand // 为每局游戏生成规则引擎的随机种子
+
+	// 创建和加入游戏的限流
+	createLimiter *keyedLimiter
+	joinLimiter   *keyedLimiter
+
+	// 签发和校验身份令牌
+	identities *IdentityKey
+
+	// 每个创建者未结束的游戏数，不在 gamesMutex 下统计，以免等待各个游戏的锁
+	ownedMutex sync.Mutex
+	owned      map[string]int
+
+	// 服务器正在关闭
+	draining atomic.Bool
+
+	// 后台任务
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// 统计数据
+	statsMutex    sync.Mutex
+	reaped        map[string]int64
+	archived      int64
+	archiveErrors int64
 }
 
-// NewGameManager 创建新的游戏管理器
-func NewGameManager() *GameManager {
-	return &GameManager{
-		games: make(map[string]*Game),
+// NewGameManager 创建新的游戏管理器，配置了快照目录时恢复上次保存的游戏
+func NewGameManager(options ManagerOptions) *GameManager {
+	gm := &GameManager{
+		games:   make(map[string]*Game),
+		options: options,
+		stop:    make(chan struct{}),
+		reaped:  make(map[string]int64),
+		owned:   make(map[string]int),
+
+		createLimiter: newKeyedLimiter(options.CreateLimit),
+		joinLimiter:   newKeyedLimiter(options.JoinLimit),
+	}
+
+	seed := options.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
 	}
+	gm.seeds = rand.New(rand.NewSource(seed))
+
+	gm.identities = options.Identities
+	if gm.identities == nil {
+		gm.identities = NewIdentityKey("")
+	}
+
+	if options.SnapshotDir != "" {
+		gm.loadSnapshots()
+	}
+
+	return gm
+}
+
+// CreateGame 为 owners 按给定规则创建新游戏，没有 owners 表示不限制创建者的游戏数
+// 以 "ip:" 开头的创建者受 MaxGamesPerIP 限制，其余的受 MaxGamesPerUser 限制
+// 游戏数达到上限时返回 ErrAtCapacity，任一创建者未结束的游戏数达到上限时返回 ErrTooManyGames
+func (gm *GameManager) CreateGame(settings GameSettings, owners ...string) (string, error) {
+	return gm.createGame(settings, owners)
 }
 
-// CreateGame 创建新游戏
-func (gm *GameManager) CreateGame() string {
-	gameID := uuid.New().String()
+// createGame 创建新游戏并加入管理器
+func (gm *GameManager) createGame(settings GameSettings, owners []string) (string, error) {
+	game := NewGame(uuid.New().String(), settings)
+	if err := gm.addGame(game, owners); err != nil {
+		return "", err
+	}
+	return game.ID, nil
+}
+
+// addGame 先为 owners 占名额，再在 gamesMutex 下检查总数并加入
+// 游戏数达到上限时返回 ErrAtCapacity，任一创建者未结束的游戏数达到上限时返回 ErrTooManyGames
+func (gm *GameManager) addGame(game *Game, owners []string) error {
+	if !gm.reserveOwners(game, owners) {
+		return ErrTooManyGames
+	}
 
 	gm.gamesMutex.Lock()
-	gm.games[gameID] = NewGame(gameID)
+	if gm.options.MaxGames > 0 && len(gm.games) >= gm.options.MaxGames {
+		gm.gamesMutex.Unlock()
+		gm.releaseOwner(game)
+		return ErrAtCapacity
+	}
+	gm.attach(game)
+	gm.games[game.ID] = game
 	gm.gamesMutex.Unlock()
 
-	return gameID
+	return nil
+}
+
+// ownerLimit 返回创建者同时进行的游戏数上限，0表示不限
+func (gm *GameManager) ownerLimit(owner string) int {
+	if strings.HasPrefix(owner, "ip:") {
+		return gm.options.MaxGamesPerIP
+	}
+	return gm.options.MaxGamesPerUser
+}
+
+// reserveOwners 为游戏的每个创建者各占一个名额，任一创建者已达上限时都不占用并返回 false
+func (gm *GameManager) reserveOwners(game *Game, owners []string) bool {
+	gm.ownedMutex.Lock()
+	defer gm.ownedMutex.Unlock()
+
+	counted := make([]string, 0, len(owners))
+	for _, owner := range owners {
+		if owner == "" {
+			continue
+		}
+		if limit := gm.ownerLimit(owner); limit > 0 && gm.owned[owner] >= limit {
+			return false
+		}
+		counted = append(counted, owner)
+	}
+	game.Owners = counted
+	if len(counted) == 0 {
+		return true
+	}
+
+	for _, owner := range counted {
+		gm.owned[owner]++
+	}
+	game.ownerCounted.Store(true)
+	return true
+}
+
+// releaseOwner 游戏结束或移除时归还创建者的名额，每个游戏只归还一次
+func (gm *GameManager) releaseOwner(game *Game) {
+	if !game.ownerCounted.CompareAndSwap(true, false) {
+		return
+	}
+
+	gm.ownedMutex.Lock()
+	defer gm.ownedMutex.Unlock()
+
+	for _, owner := range game.Owners {
+		if gm.owned[owner]--; gm.owned[owner] <= 0 {
+			delete(gm.owned, owner)
+		}
+	}
+}
+
+// attach 按管理器的配置设置游戏的归档、节奏和随机种子，调用方需持有 gamesMutex
+func (gm *GameManager) attach(game *Game) {
+	game.archive = gm.archiveRecord
+	game.finished = gm.releaseOwner
+	game.engine = rules.NewEngine(gm.seeds.Int63())
+	game.resultDelay = gm.options.ResultDelay
+	game.messageLimit = gm.options.MessageLimit
+	game.names = gm.options.Names
+	game.chatLimit = newPlayerLimiter(gm.options.ChatLimit)
+	game.chatFilter = gm.options.ChatFilter
+	game.emoteLimit = newPlayerLimiter(gm.options.EmoteLimit)
+	if gm.options.CountdownTick > 0 {
+		game.countdownTick = gm.options.CountdownTick
+	}
+	if gm.options.MaxPlayers > 0 {
+		game.maxPlayers = gm.options.MaxPlayers
+		game.engine.SetMaxPlayers(gm.options.MaxPlayers)
+	}
+	if gm.options.Deck != (rules.Deck{}) {
+		game.engine.SetDeck(gm.options.Deck)
+	}
 }
 
 // GetGame 获取游戏实例
@@ -40,34 +250,130 @@ func (gm *GameManager) GetGame(gameID string) *Game {
 	return gm.games[gameID]
 }
 
-// RemoveGame 移除游戏
+// Games 返回所有游戏实例
+func (gm *GameManager) Games() []*Game {
+	gm.gamesMutex.RLock()
+	defer gm.gamesMutex.RUnlock()
+
+	games := make([]*Game, 0, len(gm.games))
+	for _, game := range gm.games {
+		games = append(games, game)
+	}
+	return games
+}
+
+// RemoveGame 移除游戏及其快照
 func (gm *GameManager) RemoveGame(gameID string) {
 	gm.gamesMutex.Lock()
+	game := gm.games[gameID]
 	delete(gm.games, gameID)
 	gm.gamesMutex.Unlock()
+
+	if game != nil {
+		gm.releaseOwner(game)
+	}
+
+	if gm.options.SnapshotDir != "" {
+		os.Remove(gm.snapshotPath(gameID))
+	}
 }
 
 // handleCreateGame 处理创建游戏的HTTP请求
 func (gm *GameManager) HandleCreateGame(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "只支持POST方法", http.StatusMethodNotAllowed)
+		respondError(w, http.StatusMethodNotAllowed, ErrorMethodNotAllowed, "只支持POST方法")
+		return
+	}
+
+	// 关闭中不再接受新游戏和新玩家
+	if gm.IsDraining() {
+		respondError(w, http.StatusServiceUnavailable, ErrorDraining, "服务器即将关闭")
+		return
+	}
+
+	// 游戏数达到上限
+	if gm.AtCapacity() {
+		respondAtCapacity(w)
+		return
+	}
+
+	if !gm.limitRequest(w, r, gm.createLimiter, "create_game") {
+		return
+	}
+
+	// 解析规则设置和创建者名字，请求体为空时使用默认规则
+	var request struct {
+		GameSettings
+		PlayerName string `json:"playerName"`
+	}
+	request.GameSettings = gm.options.DefaultSettings
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, ErrorInvalidRequest, "无效的请求格式")
 		return
 	}
+	settings := request.GameSettings
+	if err := settings.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, ErrorInvalidSettings, err.Error())
+		return
+	}
+
+	// 先检查名字，以免留下没有房主的空桌
+	if request.PlayerName != "" {
+		if _, err := gm.options.Names.Normalize(request.PlayerName); err != nil {
+			respondNameError(w, err)
+			return
+		}
+	}
 
 	// 创建新游戏
-	gameID := gm.CreateGame()
+	gameID, err := gm.createGame(settings, gm.requestOwners(r))
+	if errors.Is(err, ErrAtCapacity) {
+		respondAtCapacity(w)
+		return
+	}
+	if err != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(TooManyGamesRetryAfter.Seconds())))
+		respondError(w, http.StatusTooManyRequests, ErrorTooManyGames, err.Error())
+		return
+	}
+	response := map[string]string{
+		"gameId": gameID,
+	}
+
+	// 提供了名字时创建者直接入座并成为房主
+	if request.PlayerName != "" {
+		profileID := gm.requestProfileID(r)
+		playerID, err := gm.GetGame(gameID).addPlayer(request.PlayerName, profileID)
+		if err != nil {
+			gm.RemoveGame(gameID)
+			respondNameError(w, err)
+			return
+		}
+		response["playerId"] = playerID
+		if profileID != "" {
+			response["profileId"] = profileID
+		}
+	}
 
 	// 返回游戏ID
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"gameId": gameID,
-	})
+	json.NewEncoder(w).Encode(response)
 }
 
 // handleJoinGame 处理加入游戏的HTTP请求
 func (gm *GameManager) HandleJoinGame(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "只支持POST方法", http.StatusMethodNotAllowed)
+		respondError(w, http.StatusMethodNotAllowed, ErrorMethodNotAllowed, "只支持POST方法")
+		return
+	}
+
+	// 关闭中不再接受新游戏和新玩家
+	if gm.IsDraining() {
+		respondError(w, http.StatusServiceUnavailable, ErrorDraining, "服务器即将关闭")
+		return
+	}
+
+	if !gm.limitRequest(w, r, gm.joinLimiter, "join_game") {
 		return
 	}
 
@@ -78,29 +384,82 @@ func (gm *GameManager) HandleJoinGame(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "无效的请求格式", http.StatusBadRequest)
+		respondError(w, http.StatusBadRequest, ErrorInvalidRequest, "无效的请求格式")
 		return
 	}
 
 	// 获取游戏
 	game := gm.GetGame(request.GameID)
 	if game == nil {
-		http.Error(w, "游戏不存在", http.StatusNotFound)
+		respondError(w, http.StatusNotFound, ErrorGameNotFound, "游戏不存在")
 		return
 	}
 
-	// 检查游戏是否已满
-	if game.IsFull() {
-		http.Error(w, "游戏已满", http.StatusBadRequest)
+	// 添加玩家，只能在等待阶段且没有满员时加入
+	profileID := gm.requestProfileID(r)
+	playerID, err := game.addPlayer(request.PlayerName, profileID)
+	if errors.Is(err, ErrGameStarted) {
+		respondError(w, http.StatusBadRequest, ErrorGameStarted, err.Error())
+		return
+	}
+	if errors.Is(err, ErrGameFull) {
+		respondError(w, http.StatusBadRequest, ErrorGameFull, err.Error())
+		return
+	}
+	if err != nil {
+		respondNameError(w, err)
 		return
 	}
-
-	// 添加玩家
-	playerID := game.AddPlayer(request.PlayerName)
 
 	// 返回玩家ID
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	response := map[string]string{
 		"playerId": playerID,
-	})
+	}
+	if profileID != "" {
+		response["profileId"] = profileID
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// 创建和加入游戏失败时返回的错误代码，名字不合法时的代码见 NameEmpty 等
+const (
+	ErrorMethodNotAllowed = "method_not_allowed" // 请求方法不对
+	ErrorDraining         = "draining"           // 服务器即将关闭
+	ErrorAtCapacity       = "at_capacity"        // 游戏数已达上限
+	ErrorRateLimited      = "rate_limited"       // 请求过于频繁
+	ErrorInvalidRequest   = "invalid_request"    // 请求格式无效
+	ErrorInvalidSettings  = "invalid_settings"   // 规则设置无效
+	ErrorTooManyGames     = "too_many_games"     // 创建的未结束游戏太多
+	ErrorGameNotFound     = "game_not_found"     // 游戏不存在
+	ErrorGameStarted      = "game_started"       // 游戏已开始
+	ErrorGameFull         = "game_full"          // 游戏已满
+)
+
+// APIError 创建和加入游戏失败时以JSON返回的错误，格式与 NameError 相同
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// respondError 以JSON返回错误代码和提示
+func respondError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(APIError{Code: code, Message: message})
+}
+
+// respondNameError 以JSON返回名字不合法的原因，重名返回409，其余返回400
+func respondNameError(w http.ResponseWriter, err error) {
+	var nameErr *NameError
+	if !errors.As(err, &nameErr) {
+		respondError(w, http.StatusBadRequest, ErrorInvalidRequest, err.Error())
+		return
+	}
+
+	status := http.StatusBadRequest
+	if nameErr.Code == NameTaken {
+		status = http.StatusConflict
+	}
+	respondError(w, status, nameErr.Code, nameErr.Message)
 }
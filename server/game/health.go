@@ -0,0 +1,93 @@
+package game
+
+import (
+	"errors"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// 服务器不能接受新游戏的原因
+var (
+	ErrDraining   = errors.New("服务器即将关闭")
+	ErrAtCapacity = errors.New("游戏数已达上限")
+)
+
+// AtCapacityRetryAfter 游戏数达到上限时建议客户端等待的时间
+const AtCapacityRetryAfter = 30 * time.Second
+
+// respondAtCapacity 游戏数达到上限时返回503和 Retry-After
+func respondAtCapacity(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(AtCapacityRetryAfter.Seconds())))
+	respondError(w, http.StatusServiceUnavailable, ErrorAtCapacity, "服务器已满，请稍后再试")
+}
+
+// AtCapacity 检查游戏数是否已达上限
+func (gm *GameManager) AtCapacity() bool {
+	if gm.options.MaxGames <= 0 {
+		return false
+	}
+
+	gm.gamesMutex.RLock()
+	defer gm.gamesMutex.RUnlock()
+
+	return len(gm.games) >= gm.options.MaxGames
+}
+
+// Ready 检查是否可以接受新游戏，关闭中或游戏数已达上限时返回原因
+func (gm *GameManager) Ready() error {
+	if gm.IsDraining() {
+		return ErrDraining
+	}
+	if gm.AtCapacity() {
+		return ErrAtCapacity
+	}
+	return nil
+}
+
+// HandleHealthz 存活检查，进程能处理请求即返回200
+func (gm *GameManager) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// HandleReadyz 就绪检查，关闭中或游戏数已达上限时返回503，让负载均衡不再分配新玩家
+func (gm *GameManager) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	if err := gm.Ready(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ready\n"))
+}
+
+// DebugInfo 调试信息：游戏数、goroutine 总数和每个游戏的 goroutine 数
+type DebugInfo struct {
+	Games          int              `json:"games"`
+	MaxGames       int              `json:"maxGames"` // 0表示不限
+	Draining       bool             `json:"draining"`
+	Goroutines     int              `json:"goroutines"`
+	GameGoroutines map[string]int64 `json:"gameGoroutines"` // 每个游戏的连接读取和倒计时goroutine数
+}
+
+// DebugInfo 返回当前的调试信息
+func (gm *GameManager) DebugInfo() DebugInfo {
+	games := gm.Games()
+	info := DebugInfo{
+		Games:          len(games),
+		MaxGames:       gm.options.MaxGames,
+		Draining:       gm.IsDraining(),
+		Goroutines:     runtime.NumGoroutine(),
+		GameGoroutines: make(map[string]int64, len(games)),
+	}
+	for _, game := range games {
+		info.GameGoroutines[game.ID] = game.goroutines.Load()
+	}
+	return info
+}
+
+// HandleDebugGames 以JSON格式返回调试信息
+func (gm *GameManager) HandleDebugGames(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, gm.DebugInfo())
+}
@@ -0,0 +1,220 @@
+package game
+
+import (
+	"encoding/json"
+)
+
+// handleUpdateSettings 处理房主在开始前修改规则
+func (g *Game) handleUpdateSettings(playerID string, settingsData map[string]interface{}) {
+	if playerID != g.HostID {
+		g.sendError(playerID, "只有房主可以修改规则")
+		return
+	}
+
+	if g.State != GameStateWaiting {
+		g.sendError(playerID, "游戏开始后不能修改规则")
+		return
+	}
+
+	// 在当前规则的基础上覆盖修改的字段
+	settings := g.Settings
+	data, err := json.Marshal(settingsData)
+	if err == nil {
+		err = json.Unmarshal(data, &settings)
+	}
+	if err != nil {
+		g.sendError(playerID, "无效的规则格式")
+		return
+	}
+	if err := settings.Validate(); err != nil {
+		g.sendError(playerID, err.Error())
+		return
+	}
+
+	g.Settings = settings
+	g.playerLogger(playerID).Info("房主修改了规则", "mode", settings.Mode, "starting_lives", settings.StartingLives, "max_rounds", settings.MaxRounds, "best_of", settings.BestOf)
+
+	// 规则变化后所有玩家需要重新准备
+	for _, player := range g.Players {
+		player.Ready = false
+	}
+
+	message := map[string]interface{}{
+		"type":     "settings_updated",
+		"settings": g.Settings,
+	}
+	for _, conn := range g.Connections {
+		writeMessage(conn, message)
+	}
+
+	g.broadcastGameState()
+}
+
+// handleKickPlayer 处理房主踢出玩家
+func (g *Game) handleKickPlayer(playerID string, targetID string) {
+	if playerID != g.HostID {
+		g.sendError(playerID, "只有房主可以踢出玩家")
+		return
+	}
+
+	if targetID == playerID {
+		g.sendError(playerID, "不能踢出自己")
+		return
+	}
+
+	target, ok := g.Players[targetID]
+	if !ok {
+		g.sendError(playerID, "玩家不存在")
+		return
+	}
+
+	if g.State == GameStatePlaying {
+		g.sendError(playerID, "游戏进行中不能踢出玩家")
+		return
+	}
+
+	g.playerLogger(playerID).Info("房主踢出了玩家", "target_id", targetID, "target_name", target.Name)
+	g.kickPlayer(targetID, "你已被房主移出游戏")
+}
+
+// kickPlayer 通知并断开被踢出的玩家，调用方需持有锁
+// 开始前踢出会空出座位；进行中（只有管理员可以）踢出视为认输，玩家留在座位上
+func (g *Game) kickPlayer(targetID string, notice string) {
+	target := g.Players[targetID]
+
+	// 通知被踢出的玩家并断开连接
+	if conn, ok := g.Connections[targetID]; ok {
+		writeMessage(conn, map[string]interface{}{
+			"type":    "kicked",
+			"message": notice,
+		})
+		conn.Close()
+	}
+
+	forfeit := g.State == GameStatePlaying && g.playerStats(targetID).Alive
+	if g.State == GameStatePlaying {
+		delete(g.Connections, targetID)
+		g.leaveSeat(targetID)
+	} else {
+		g.removePlayer(targetID)
+	}
+
+	// 广播玩家被踢出的消息
+	message := map[string]interface{}{
+		"type":       "player_kicked",
+		"playerName": target.Name,
+	}
+	for _, conn := range g.Connections {
+		writeMessage(conn, message)
+	}
+
+	switch {
+	case g.State == GameStateStarting:
+		// 倒计时中人数变化，回到等待状态
+		g.cancelCountdown(target.Name + " 被移出游戏")
+	case forfeit:
+		g.forfeitPlayer(targetID)
+	default:
+		g.broadcastGameState()
+	}
+}
+
+// handleTransferHost 处理房主转让
+func (g *Game) handleTransferHost(playerID string, targetID string) {
+	if playerID != g.HostID {
+		g.sendError(playerID, "只有房主可以转让房主")
+		return
+	}
+
+	target, ok := g.Players[targetID]
+	if !ok {
+		g.sendError(playerID, "玩家不存在")
+		return
+	}
+
+	// 只能转让给仍在座且在线的玩家，否则牌桌会没有能操作的房主
+	if target.Left {
+		g.sendError(playerID, "玩家已经离开")
+		return
+	}
+	if _, online := g.Connections[targetID]; !online {
+		g.sendError(playerID, "玩家不在线")
+		return
+	}
+
+	g.setHost(targetID)
+	g.broadcastGameState()
+}
+
+// setHost 更换房主并广播
+func (g *Game) setHost(playerID string) {
+	g.HostID = playerID
+	if playerID == "" {
+		return
+	}
+
+	g.playerLogger(playerID).Info("成为房主")
+
+	message := map[string]interface{}{
+		"type":       "host_changed",
+		"hostId":     playerID,
+		"playerName": g.Players[playerID].Name,
+	}
+	for _, conn := range g.Connections {
+		writeMessage(conn, message)
+	}
+}
+
+// leaveSeat 进行中的游戏里玩家离开或被踢出：座位保留到本局结束，房主转让给下一位仍在座的玩家
+func (g *Game) leaveSeat(playerID string) {
+	g.Players[playerID].Left = true
+	if g.HostID != playerID {
+		return
+	}
+
+	idx := g.seatIndex(playerID)
+	for i := 1; i < len(g.PlayerOrder); i++ {
+		nextID := g.PlayerOrder[(idx+i)%len(g.PlayerOrder)]
+		if !g.Players[nextID].Left {
+			g.setHost(nextID)
+			return
+		}
+	}
+	g.setHost("")
+}
+
+// removeLeftSeats 一局结束后空出进行中离开的玩家的座位，以便剩下的玩家再来一局
+func (g *Game) removeLeftSeats() {
+	for _, playerID := range append([]string(nil), g.PlayerOrder...) {
+		if g.Players[playerID].Left {
+			g.removePlayer(playerID)
+		}
+	}
+}
+
+// removePlayer 将玩家从座位、出牌顺序和连接中移除，房主离开时转让给下一位玩家
+func (g *Game) removePlayer(playerID string) {
+	idx := -1
+	for i, id := range g.PlayerOrder {
+		if id == playerID {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return
+	}
+
+	delete(g.Players, playerID)
+	delete(g.Connections, playerID)
+	g.PlayerOrder = append(g.PlayerOrder[:idx], g.PlayerOrder[idx+1:]...)
+
+	// 房主离开时转让给下一位入座的玩家
+	if g.HostID == playerID {
+		nextHostID := ""
+		if len(g.PlayerOrder) > 0 {
+			nextHostID = g.PlayerOrder[idx%len(g.PlayerOrder)]
+		}
+		g.setHost(nextHostID)
+	}
+}
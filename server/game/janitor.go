@@ -0,0 +1,204 @@
+package game
+
+import (
+	"log/slog"
+	"time"
+
+	"server/logging"
+
+	"github.com/gorilla/websocket"
+)
+
+// 回收原因
+const (
+	ReapIdleWaiting = "idle_waiting" // 等待中的牌桌长时间无人操作
+	ReapAbandoned   = "abandoned"    // 进行中的游戏所有玩家都已断开
+	ReapFinished    = "finished"     // 已结束的游戏超过保留时间
+)
+
+// GameStatus 游戏的概要状态
+type GameStatus struct {
+	ID           string    `json:"id"`
+	State        string    `json:"state"`
+	Players      int       `json:"players"`
+	Connections  int       `json:"connections"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastActivity time.Time `json:"lastActivity"`
+	FinishedAt   time.Time `json:"finishedAt,omitempty"`
+}
+
+// Status 返回游戏的概要状态
+func (g *Game) Status() GameStatus {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return GameStatus{
+		ID:           g.ID,
+		State:        g.State,
+		Players:      len(g.Players),
+		Connections:  len(g.Connections),
+		CreatedAt:    g.CreatedAt,
+		LastActivity: g.LastActivity,
+		FinishedAt:   g.currentPlay().FinishedAt,
+	}
+}
+
+// Close 通知所有连接的玩家游戏已关闭并断开连接，返回未完成的游戏记录
+func (g *Game) Close(reason string, message string) *GameRecord {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// 让进行中的倒计时和结果展示失效
+	g.countdownID++
+	g.resultID++
+	g.resultPending = false
+	g.outbox = nil
+
+	for playerID, conn := range g.Connections {
+		writeMessage(conn, map[string]interface{}{
+			"type":    "game_closed",
+			"reason":  reason,
+			"message": message,
+		})
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, reason))
+		conn.Close()
+		delete(g.Connections, playerID)
+	}
+
+	// 已结束的记录在结束时已经归档
+	if g.play == nil || g.play.GameOver {
+		return nil
+	}
+	return g.record()
+}
+
+// reapReason 根据回收时间判断游戏是否应被回收，返回空字符串表示保留
+func (gm *GameManager) reapReason(status GameStatus, now time.Time) string {
+	switch status.State {
+	case GameStateWaiting, GameStateStarting:
+		if gm.options.WaitingTTL > 0 && now.Sub(status.LastActivity) > gm.options.WaitingTTL {
+			return ReapIdleWaiting
+		}
+
+	case GameStatePlaying:
+		if gm.options.AbandonedTTL > 0 && status.Connections == 0 && now.Sub(status.LastActivity) > gm.options.AbandonedTTL {
+			return ReapAbandoned
+		}
+
+	case GameStateFinished:
+		if gm.options.FinishedTTL > 0 && now.Sub(status.FinishedAt) > gm.options.FinishedTTL {
+			return ReapFinished
+		}
+	}
+
+	return ""
+}
+
+// StartJanitor 启动定期回收游戏的后台任务
+func (gm *GameManager) StartJanitor() {
+	if gm.options.JanitorInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(gm.options.JanitorInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				now := time.Now()
+				gm.reapGames(now)
+				gm.createLimiter.prune(now)
+				gm.joinLimiter.prune(now)
+			case <-gm.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止回收和快照等后台任务
+func (gm *GameManager) Stop() {
+	gm.stopOnce.Do(func() {
+		close(gm.stop)
+	})
+}
+
+// reapGames 回收所有到期的游戏
+func (gm *GameManager) reapGames(now time.Time) {
+	for _, game := range gm.Games() {
+		reason := gm.reapReason(game.Status(), now)
+		if reason == "" {
+			continue
+		}
+
+		slog.Info("回收游戏", logging.KeyGameID, game.ID, "reason", reason)
+
+		// 先断开所有玩家并归档未完成的记录，再移除游戏和快照，归档失败时不会丢掉快照之外唯一的记录
+		if record := game.Close(reason, "游戏已被关闭"); record != nil {
+			gm.archiveRecord(record)
+		}
+		gm.RemoveGame(game.ID)
+
+		gm.statsMutex.Lock()
+		gm.reaped[reason]++
+		gm.statsMutex.Unlock()
+	}
+}
+
+// archiveRecord 归档一局游戏记录，决出胜者的游戏同时计入玩家战绩
+// 被回收、停机或管理员结束的游戏没有打完，不计入战绩
+func (gm *GameManager) archiveRecord(record *GameRecord) {
+	if gm.options.Profiles != nil && record.WinnerID != "" {
+		if err := gm.options.Profiles.Record(record); err != nil {
+			slog.Error("保存玩家战绩失败", logging.KeyGameID, record.GameID, logging.KeyError, err)
+		}
+	}
+
+	if gm.options.Archiver == nil {
+		return
+	}
+
+	if err := gm.options.Archiver.Archive(record); err != nil {
+		slog.Error("归档游戏记录失败", logging.KeyGameID, record.GameID, logging.KeyError, err)
+		gm.statsMutex.Lock()
+		gm.archiveErrors++
+		gm.statsMutex.Unlock()
+		return
+	}
+
+	gm.statsMutex.Lock()
+	gm.archived++
+	gm.statsMutex.Unlock()
+}
+
+// ManagerStats 游戏管理器的统计数据
+type ManagerStats struct {
+	GamesByState  map[string]int   `json:"gamesByState"`
+	Reaped        map[string]int64 `json:"reaped"`
+	Archived      int64            `json:"archived"`
+	ArchiveErrors int64            `json:"archiveErrors"`
+}
+
+// Stats 返回当前游戏数量和回收统计
+func (gm *GameManager) Stats() ManagerStats {
+	stats := ManagerStats{
+		GamesByState: make(map[string]int),
+		Reaped:       make(map[string]int64),
+	}
+
+	for _, game := range gm.Games() {
+		stats.GamesByState[game.Status().State]++
+	}
+
+	gm.statsMutex.Lock()
+	for reason, count := range gm.reaped {
+		stats.Reaped[reason] = count
+	}
+	stats.Archived = gm.archived
+	stats.ArchiveErrors = gm.archiveErrors
+	gm.statsMutex.Unlock()
+
+	return stats
+}
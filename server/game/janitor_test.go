@@ -0,0 +1,123 @@
+package game
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// memoryArchiver 在内存中保存归档记录，同时记下归档时快照是否还在
+type memoryArchiver struct {
+	gm       *GameManager
+	records  []*GameRecord
+	snapshot map[string]bool
+}
+
+func (a *memoryArchiver) Archive(record *GameRecord) error {
+	a.records = append(a.records, record)
+	_, err := os.Stat(a.gm.snapshotPath(record.GameID))
+	a.snapshot[record.GameID] = err == nil
+	return nil
+}
+
+// seatPlayers 让三名玩家入座
+func seatPlayers(g *Game) {
+	for _, name := range []string{"a", "b", "c"} {
+		g.AddPlayer(name)
+	}
+}
+
+// beginPlay 跳过倒计时直接开始游戏
+func beginPlay(g *Game) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.State = GameStateStarting
+	g.startGame()
+}
+
+// playToEnd 由当前玩家不断出一张牌并质疑，直到游戏结束，调用方需持有锁
+func playToEnd(g *Game) {
+	for g.State == GameStatePlaying {
+		current := g.getCurrentPlayerID()
+		if g.play.AwaitingChallenge {
+			g.handleChallenge(current, true, "")
+			continue
+		}
+		g.handlePlayCards(current, g.play.Players[current].Hand[:1])
+	}
+}
+
+func TestReapGames(t *testing.T) {
+	dir := t.TempDir()
+	archiver := &memoryArchiver{snapshot: make(map[string]bool)}
+	gm := NewGameManager(ManagerOptions{
+		SnapshotDir:  dir,
+		Archiver:     archiver,
+		WaitingTTL:   time.Minute,
+		AbandonedTTL: time.Minute,
+		FinishedTTL:  time.Minute,
+		Seed:         1,
+	})
+	defer gm.Stop()
+	archiver.gm = gm
+
+	games := make([]*Game, 0, 3)
+	for i := 0; i < 3; i++ {
+		gameID, err := gm.CreateGame(GameSettings{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		games = append(games, gm.GetGame(gameID))
+	}
+	waiting, playing, finished := games[0], games[1], games[2]
+
+	for _, game := range games[1:] {
+		seatPlayers(game)
+		beginPlay(game)
+	}
+	finished.mutex.Lock()
+	playToEnd(finished)
+	finished.mutex.Unlock()
+
+	if finished.State != GameStateFinished || len(archiver.records) != 1 {
+		t.Fatalf("打完的游戏应在结束时归档: %s, %d 条记录", finished.State, len(archiver.records))
+	}
+	if err := gm.SnapshotAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 还没到期时不回收
+	gm.reapGames(time.Now())
+	if games := len(gm.Games()); games != 3 {
+		t.Fatalf("未到期时剩下 %d 个游戏", games)
+	}
+
+	gm.reapGames(time.Now().Add(time.Hour))
+	if games := len(gm.Games()); games != 0 {
+		t.Errorf("到期后剩下 %d 个游戏", games)
+	}
+
+	stats := gm.Stats()
+	for _, reason := range []string{ReapIdleWaiting, ReapAbandoned, ReapFinished} {
+		if stats.Reaped[reason] != 1 {
+			t.Errorf("%s 回收了 %d 个游戏", reason, stats.Reaped[reason])
+		}
+	}
+
+	// 已结束的游戏不重复归档，等待中的游戏没有记录，只有中途放弃的游戏补充归档
+	if stats.Archived != 2 || len(archiver.records) != 2 {
+		t.Fatalf("归档了 %d 条记录", stats.Archived)
+	}
+	record := archiver.records[1]
+	if record.GameID != playing.ID || record.WinnerID != "" {
+		t.Errorf("放弃的游戏记录不对: %+v", record)
+	}
+	if !archiver.snapshot[playing.ID] {
+		t.Error("归档放弃的游戏之前快照已被删除")
+	}
+	for _, game := range []*Game{waiting, playing, finished} {
+		if _, err := os.Stat(gm.snapshotPath(game.ID)); !os.IsNotExist(err) {
+			t.Errorf("回收后 %s 的快照还在", game.ID)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package game
+
+import (
+	"server/logging"
+	"server/rules"
+)
+
+// handleLeave 处理玩家主动离开游戏
+// 开始前离开会空出座位，进行中离开视为认输
+func (g *Game) handleLeave(playerID string) {
+	player, ok := g.Players[playerID]
+	if !ok {
+		return
+	}
+
+	// 通知离开的玩家并断开连接，之后不再处理这个连接的消息
+	if conn, ok := g.Connections[playerID]; ok {
+		writeMessage(conn, map[string]interface{}{
+			"type":    "left_game",
+			"message": "你已离开游戏",
+		})
+		conn.Close()
+		delete(g.Connections, playerID)
+	}
+
+	forfeit := g.State == GameStatePlaying && g.playerStats(playerID).Alive
+	g.playerLogger(playerID).Info("玩家离开游戏", "forfeit", forfeit)
+
+	// 广播玩家离开的消息
+	message := map[string]interface{}{
+		"type":       "player_left",
+		"playerName": player.Name,
+		"forfeit":    forfeit,
+	}
+	for _, conn := range g.Connections {
+		writeMessage(conn, message)
+	}
+
+	switch g.State {
+	case GameStateWaiting, GameStateFinished:
+		g.removePlayer(playerID)
+		g.broadcastGameState()
+
+	case GameStateStarting:
+		g.removePlayer(playerID)
+		g.cancelCountdown(player.Name + " 离开了游戏")
+
+	case GameStatePlaying:
+		g.leaveSeat(playerID)
+		if forfeit {
+			g.forfeitPlayer(playerID)
+		} else {
+			g.broadcastGameState()
+		}
+	}
+}
+
+// forfeitPlayer 玩家在游戏中认输：由规则引擎判定出局并推进回合
+func (g *Game) forfeitPlayer(playerID string) {
+	if err := g.act(rules.Forfeit{PlayerID: playerID}); err != nil {
+		g.playerLogger(playerID).Error("认输失败", logging.KeyError, err)
+	}
+	g.broadcastGameState()
+}
@@ -0,0 +1,231 @@
+package game
+
+import (
+	"fmt"
+	"time"
+
+	"server/logging"
+)
+
+// 开局倒计时秒数
+const StartCountdownSeconds = 5
+
+// 默认的游戏节奏
+const (
+	DefaultResultDelay   = 2 * time.Second // 开枪和系统质疑后留给玩家查看结果的时间
+	DefaultCountdownTick = time.Second     // 开局倒计时每一秒的实际间隔
+)
+
+// stateTransitions 允许的游戏状态转换
+var stateTransitions = map[string][]string{
+	GameStateWaiting:  {GameStateStarting},
+	GameStateStarting: {GameStateWaiting, GameStatePlaying},
+	GameStatePlaying:  {GameStateFinished},
+	GameStateFinished: {GameStateStarting},
+}
+
+// setState 切换游戏状态，所有状态转换都经过这里校验
+func (g *Game) setState(next string) error {
+	for _, allowed := range stateTransitions[g.State] {
+		if allowed == next {
+			g.logger().Info("游戏状态切换", "from", g.State, "to", next)
+			g.State = next
+			return nil
+		}
+	}
+	return fmt.Errorf("不允许的状态转换: %s -> %s", g.State, next)
+}
+
+// allReady 检查是否所有在座玩家都已准备
+func (g *Game) allReady() bool {
+	for _, id := range g.PlayerOrder {
+		if !g.Players[id].Ready {
+			return false
+		}
+	}
+	return len(g.PlayerOrder) >= MinPlayers
+}
+
+// readyPlayers 返回已准备的玩家ID，按座位顺序排列
+func (g *Game) readyPlayers() []string {
+	ready := make([]string, 0, len(g.PlayerOrder))
+	for _, id := range g.PlayerOrder {
+		if g.Players[id].Ready {
+			ready = append(ready, id)
+		}
+	}
+	return ready
+}
+
+// handleReady 处理玩家切换准备状态
+func (g *Game) handleReady(playerID string, ready bool) {
+	player, ok := g.Players[playerID]
+	if !ok {
+		return
+	}
+	player.Ready = ready
+
+	// 倒计时中有玩家取消准备，回到等待状态
+	if !ready && g.State == GameStateStarting {
+		g.cancelCountdown(fmt.Sprintf("%s 取消了准备", player.Name))
+		return
+	}
+
+	g.broadcastGameState()
+
+	// 满员且所有玩家都已准备时自动开始倒计时
+	if g.State == GameStateWaiting && len(g.Players) >= g.maxPlayers && g.allReady() {
+		g.beginCountdown()
+	}
+}
+
+// handleStartRequest 处理房主开始游戏的请求，房主要求开始即视为已准备
+func (g *Game) handleStartRequest(playerID string) {
+	if g.State != GameStateWaiting {
+		return
+	}
+
+	if playerID != g.HostID {
+		g.sendError(playerID, "只有房主可以开始游戏")
+		return
+	}
+
+	if len(g.Players) < MinPlayers {
+		g.sendError(playerID, "至少需要2名玩家才能开始")
+		return
+	}
+
+	if player := g.Players[playerID]; !player.Ready {
+		player.Ready = true
+		g.broadcastGameState()
+	}
+
+	if !g.allReady() {
+		g.sendError(playerID, "还有玩家未准备")
+		return
+	}
+
+	g.beginCountdown()
+}
+
+// handleRematch 处理玩家对再来一局的表态，所有在座玩家同意后开始倒计时
+func (g *Game) handleRematch(playerID string, accept bool) {
+	player, ok := g.Players[playerID]
+	if !ok {
+		return
+	}
+	player.Ready = accept
+
+	// 广播再来一局的表态情况
+	message := map[string]interface{}{
+		"type":       "rematch_status",
+		"playerName": player.Name,
+		"accept":     accept,
+		"accepted":   g.readyPlayers(),
+		"total":      len(g.PlayerOrder),
+	}
+	for _, conn := range g.Connections {
+		writeMessage(conn, message)
+	}
+
+	// 倒计时中有玩家反悔，回到等待状态
+	if !accept && g.State == GameStateStarting {
+		g.cancelCountdown(fmt.Sprintf("%s 不再同意再来一局", player.Name))
+		return
+	}
+
+	if g.State == GameStateFinished && g.allReady() {
+		g.logger().Info("所有玩家同意再来一局")
+		g.beginCountdown()
+		g.rematching = g.State == GameStateStarting
+	}
+}
+
+// beginCountdown 进入开局倒计时，调用方需持有锁
+func (g *Game) beginCountdown() {
+	if g.draining {
+		for _, conn := range g.Connections {
+			writeMessage(conn, map[string]interface{}{
+				"type":    "error",
+				"message": "服务器即将关闭，暂时不能开始游戏",
+			})
+		}
+		return
+	}
+
+	if err := g.setState(GameStateStarting); err != nil {
+		g.logger().Error("无法开始倒计时", logging.KeyError, err)
+		return
+	}
+
+	g.countdownID++
+	g.rematching = false
+	g.Countdown = StartCountdownSeconds
+	g.broadcastCountdown()
+	g.broadcastGameState()
+
+	g.goroutines.Add(1)
+	go g.runCountdown(g.countdownID)
+}
+
+// runCountdown 每秒广播一次倒计时，结束后开始游戏
+func (g *Game) runCountdown(countdownID int) {
+	defer g.goroutines.Add(-1)
+
+	ticker := time.NewTicker(g.countdownTick)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		g.mutex.Lock()
+
+		// 倒计时已被取消或被新的倒计时取代
+		if g.countdownID != countdownID || g.State != GameStateStarting {
+			g.mutex.Unlock()
+			return
+		}
+
+		g.Countdown--
+		if g.Countdown > 0 {
+			g.broadcastCountdown()
+			g.mutex.Unlock()
+			continue
+		}
+
+		g.startGame()
+		g.mutex.Unlock()
+		return
+	}
+}
+
+// cancelCountdown 取消开局倒计时并回到等待状态，调用方需持有锁
+func (g *Game) cancelCountdown(reason string) {
+	if err := g.setState(GameStateWaiting); err != nil {
+		g.logger().Error("无法取消倒计时", logging.KeyError, err)
+		return
+	}
+
+	g.countdownID++
+	g.rematching = false
+	g.Countdown = 0
+
+	message := map[string]interface{}{
+		"type":   "countdown_cancelled",
+		"reason": reason,
+	}
+	for _, conn := range g.Connections {
+		writeMessage(conn, message)
+	}
+
+	g.broadcastGameState()
+}
+
+// broadcastCountdown 广播开局倒计时
+func (g *Game) broadcastCountdown() {
+	message := map[string]interface{}{
+		"type":    "countdown",
+		"seconds": g.Countdown,
+	}
+	for _, conn := range g.Connections {
+		writeMessage(conn, message)
+	}
+}
@@ -0,0 +1,47 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"server/rules"
+)
+
+func TestRematchOnlyDuringRematchCountdown(t *testing.T) {
+	g := NewGame("g", GameSettings{Mode: rules.GameModeLives, StartingLives: 2})
+	g.engine = rules.NewEngine(1)
+	g.countdownTick = time.Hour
+	seatPlayers(g)
+	defer g.Close("test", "")
+
+	// 第一局的开局倒计时中，再来一局的表态被忽略
+	g.mutex.Lock()
+	for _, playerID := range g.PlayerOrder {
+		g.Players[playerID].Ready = true
+	}
+	g.beginCountdown()
+	g.mutex.Unlock()
+
+	decliner := g.PlayerOrder[1]
+	g.handleMessage(decliner, map[string]interface{}{"type": "rematch", "accept": false})
+	if g.State != GameStateStarting || !g.Players[decliner].Ready {
+		t.Fatalf("开局倒计时被再来一局的表态打断: %s", g.State)
+	}
+
+	g.mutex.Lock()
+	g.startGame()
+	playToEnd(g)
+	g.mutex.Unlock()
+
+	// 所有玩家同意再来一局后进入倒计时，这时可以反悔
+	for _, playerID := range g.PlayerOrder {
+		g.handleMessage(playerID, map[string]interface{}{"type": "rematch", "accept": true})
+	}
+	if g.State != GameStateStarting {
+		t.Fatalf("所有玩家同意后应开始倒计时: %s", g.State)
+	}
+	g.handleMessage(decliner, map[string]interface{}{"type": "rematch", "accept": false})
+	if g.State != GameStateWaiting {
+		t.Errorf("再来一局的倒计时中反悔应回到等待: %s", g.State)
+	}
+}
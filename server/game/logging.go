@@ -0,0 +1,64 @@
+package game
+
+import (
+	"log/slog"
+
+	"server/logging"
+	"server/rules"
+)
+
+// logger 返回带有游戏ID和当前轮数的日志记录器，调用方需持有锁
+func (g *Game) logger() *slog.Logger {
+	return gameLogger(g.ID, g.currentPlay())
+}
+
+// playerLogger 返回带有玩家ID的日志记录器，调用方需持有锁
+func (g *Game) playerLogger(playerID string) *slog.Logger {
+	return g.logger().With(logging.KeyPlayerID, playerID)
+}
+
+// gameLogger 返回带有游戏ID和牌局轮数的日志记录器，还没开始第一轮时不带轮数
+func gameLogger(gameID string, play *rules.State) *slog.Logger {
+	logger := slog.With(logging.KeyGameID, gameID)
+	if play.RoundCount > 0 {
+		logger = logger.With(logging.KeyRound, play.RoundCount)
+	}
+	return logger
+}
+
+// logEvent 以调试级别记录一个游戏事件，秘密信息由日志配置决定是否脱敏
+func (g *Game) logEvent(view *rules.State, ev rules.Event) {
+	attrs := []any{logging.KeyEvent, ev.Type, "seq", ev.Seq}
+	if ev.PlayerID != "" {
+		attrs = append(attrs, logging.KeyPlayerID, ev.PlayerID)
+	}
+	if ev.TargetID != "" {
+		attrs = append(attrs, "target_id", ev.TargetID)
+	}
+
+	switch ev.Type {
+	case rules.EventGameStarted:
+		attrs = append(attrs, "game_number", ev.GameNumber, "players", len(ev.PlayerOrder), "mode", ev.Settings.Mode)
+	case rules.EventRevolverLoaded:
+		attrs = append(attrs, logging.KeyBullet, ev.Bullet)
+	case rules.EventCardsDealt:
+		attrs = append(attrs, logging.KeyHands, ev.Hands, logging.KeyDeck, ev.Deck)
+	case rules.EventTargetChosen:
+		attrs = append(attrs, logging.KeyTargetCard, ev.Card)
+	case rules.EventCardsPlayed:
+		attrs = append(attrs, "count", len(ev.Cards), logging.KeyCards, ev.Cards)
+	case rules.EventChallengeResolved:
+		attrs = append(attrs, "success", ev.Success, "system", ev.System)
+	case rules.EventShotFired:
+		attrs = append(attrs, logging.KeyChamber, ev.Chamber, "hit", ev.Hit)
+	case rules.EventPlayerEliminated:
+		attrs = append(attrs, "cause", ev.Reason)
+	case rules.EventTurnPassed:
+		attrs = append(attrs, "pending", ev.Pending)
+	case rules.EventEmote:
+		attrs = append(attrs, "emote", ev.Emote)
+	}
+
+	// 事件总是带上轮数，开局和第一轮发牌时为0
+	slog.Debug("游戏事件", append([]any{logging.KeyGameID, g.ID, logging.KeyRound, view.RoundCount}, attrs...)...)
+}
@@ -0,0 +1,52 @@
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"server/logging"
+)
+
+// TestLogRedaction 打完一局，每行游戏日志都带有游戏ID，事件带有轮数，秘密信息全部脱敏
+func TestLogRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Options{Format: logging.FormatJSON, Level: slog.LevelDebug})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logger)
+
+	g := newFuzzGame(fuzzFinished, 1)
+
+	events := 0
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("无效的日志行 %s: %v", scanner.Text(), err)
+		}
+		if line[logging.KeyGameID] != g.ID {
+			t.Errorf("缺少游戏ID: %s", scanner.Text())
+		}
+		for _, key := range []string{logging.KeyHand, logging.KeyHands, logging.KeyCards, logging.KeyDeck, logging.KeyTargetCard, logging.KeyBullet, logging.KeyChamber} {
+			if value, ok := line[key]; ok && value != logging.Redacted {
+				t.Errorf("%s 没有脱敏: %s", key, scanner.Text())
+			}
+		}
+
+		if line[logging.KeyEvent] == nil {
+			continue
+		}
+		events++
+		if _, ok := line[logging.KeyRound]; !ok {
+			t.Errorf("事件缺少轮数: %s", scanner.Text())
+		}
+	}
+	if events != len(g.Events) {
+		t.Errorf("记录了 %d 个事件，期望 %d 个", events, len(g.Events))
+	}
+}
@@ -0,0 +1,109 @@
+package game
+
+import (
+	"server/metrics"
+	"server/rules"
+
+	"github.com/gorilla/websocket"
+)
+
+// 客户端可以发送的消息类型，其余类型统计为 unknown，以免任意输入产生无数的标签值
+var clientMessageTypes = map[string]bool{
+	"ready":           true,
+	"start_game":      true,
+	"play_cards":      true,
+	"challenge":       true,
+	"rematch":         true,
+	"update_settings": true,
+	"kick_player":     true,
+	"transfer_host":   true,
+	"leave_game":      true,
+	"chat":            true,
+	"mute_player":     true,
+	"emote":           true,
+}
+
+// 进程内所有游戏共用的指标
+var (
+	messagesReceived = metrics.NewCounter("liarsbar_messages_received_total", "收到的客户端消息数", "type")
+	messagesSent     = metrics.NewCounter("liarsbar_messages_sent_total", "发送给客户端的消息数", "type")
+	challenges       = metrics.NewCounter("liarsbar_challenges_total", "质疑结果，kind 为 player 或 system，outcome 为 success 或 failure", "kind", "outcome")
+	shotsFired       = metrics.NewCounter("liarsbar_shots_fired_total", "开枪次数，result 为 hit 或 miss", "result")
+	eliminations     = metrics.NewCounter("liarsbar_eliminations_total", "出局的玩家数，reason 为 shot 或 forfeit", "reason")
+	gameDuration     = metrics.NewHistogram("liarsbar_game_duration_seconds", "一局游戏从开始到决出胜者的时间",
+		[]float64{30, 60, 120, 300, 600, 900, 1200, 1800, 3600}, "mode")
+)
+
+// RegisterMetrics 将游戏指标以及该管理器当前的游戏数和连接数注册到 registry
+func (gm *GameManager) RegisterMetrics(registry *metrics.Registry) {
+	games := metrics.NewGaugeFunc("liarsbar_games", "按状态统计的游戏数", []string{"state"}, func(gauge *metrics.Gauge) {
+		for _, state := range []string{GameStateWaiting, GameStateStarting, GameStatePlaying, GameStateFinished} {
+			gauge.Set(0, state)
+		}
+		for _, game := range gm.Games() {
+			gauge.Add(1, game.Status().State)
+		}
+	})
+	connections := metrics.NewGaugeFunc("liarsbar_websocket_connections", "当前连接的WebSocket数", nil, func(gauge *metrics.Gauge) {
+		for _, game := range gm.Games() {
+			gauge.Add(float64(game.Status().Connections))
+		}
+	})
+
+	registry.Register(games, connections, messagesReceived, messagesSent, challenges, shotsFired, eliminations, gameDuration, rateLimited)
+}
+
+// writeMessage 向一个连接发送消息并按类型计数
+func writeMessage(conn *websocket.Conn, message map[string]interface{}) error {
+	messageType, _ := message["type"].(string)
+	messagesSent.Inc(messageType)
+	return conn.WriteJSON(message)
+}
+
+// WriteMessage 供包外在连接进入游戏之前发送消息，同样按类型计数
+func WriteMessage(conn *websocket.Conn, message map[string]interface{}) error {
+	return writeMessage(conn, message)
+}
+
+// countReceived 按类型统计收到的消息
+func countReceived(message map[string]interface{}) {
+	messageType, _ := message["type"].(string)
+	if !clientMessageTypes[messageType] {
+		messageType = "unknown"
+	}
+	messagesReceived.Inc(messageType)
+}
+
+// countEvent 统计质疑、开枪和出局事件
+func countEvent(ev rules.Event) {
+	switch ev.Type {
+	case rules.EventChallengeResolved:
+		kind, outcome := "player", "failure"
+		if ev.System {
+			kind = "system"
+		}
+		if ev.Success {
+			outcome = "success"
+		}
+		challenges.Inc(kind, outcome)
+
+	case rules.EventShotFired:
+		result := "miss"
+		if ev.Hit {
+			result = "hit"
+		}
+		shotsFired.Inc(result)
+
+	case rules.EventPlayerEliminated:
+		eliminations.Inc(ev.Reason)
+	}
+}
+
+// observeGameDuration 记录一局游戏的时长，调用方需持有锁
+func (g *Game) observeGameDuration() {
+	if len(g.Events) == 0 || g.play == nil {
+		return
+	}
+	duration := g.play.FinishedAt.Sub(g.Events[0].Time)
+	gameDuration.Observe(duration.Seconds(), g.play.Settings.Mode)
+}
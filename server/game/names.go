@@ -0,0 +1,142 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxNameLength 玩家名字默认最多的字符数
+const MaxNameLength = 16
+
+// 名字不合法的原因，客户端据此显示提示
+const (
+	NameEmpty   = "name_empty"    // 名字为空
+	NameTooLong = "name_too_long" // 名字太长
+	NameInvalid = "name_invalid"  // 包含不允许的字符
+	NameTaken   = "name_taken"    // 与同桌玩家重名
+	NameBlocked = "name_blocked"  // 包含屏蔽词
+)
+
+// 重名时在名字后面加上的编号，分隔符必须是 nameSymbols 中的字符，加编号后的名字才能通过校验
+const (
+	nameDupStart     = 2
+	nameDupSeparator = "-"
+)
+
+// nameSymbols 字母、数字和空格之外允许出现在名字中的字符
+const nameSymbols = "-_.·'"
+
+// NameError 玩家名字不合法
+type NameError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error 实现 error 接口
+func (e *NameError) Error() string {
+	return e.Message
+}
+
+// NamePolicy 玩家名字的规则
+type NamePolicy struct {
+	MaxLength        int      // 最多字符数，0表示使用 MaxNameLength
+	Blocklist        []string // 名字中不能出现的词，比较时忽略大小写、全半角、空格和符号
+	RejectDuplicates bool     // 与同桌玩家重名时拒绝，否则自动加上编号
+}
+
+// maxLength 返回生效的最多字符数
+func (p NamePolicy) maxLength() int {
+	if p.MaxLength > 0 {
+		return p.MaxLength
+	}
+	return MaxNameLength
+}
+
+// Normalize 规范化名字并检查长度、字符和屏蔽词
+// 全角字符和兼容字符按 NFKC 转为标准形式，首尾空白去掉，中间连续的空白合并为一个空格
+func (p NamePolicy) Normalize(name string) (string, error) {
+	name = strings.Join(strings.FieldsFunc(norm.NFKC.String(name), unicode.IsSpace), " ")
+
+	if name == "" {
+		return "", &NameError{Code: NameEmpty, Message: "请输入名字"}
+	}
+	if utf8.RuneCountInString(name) > p.maxLength() {
+		return "", &NameError{Code: NameTooLong, Message: fmt.Sprintf("名字最多 %d 个字", p.maxLength())}
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.Is(unicode.Mn, r) && r != ' ' && !strings.ContainsRune(nameSymbols, r) {
+			return "", &NameError{Code: NameInvalid, Message: "名字只能包含文字、数字、空格和 " + nameSymbols}
+		}
+	}
+
+	key := blockKey(name)
+	for _, word := range p.Blocklist {
+		if word := blockKey(word); word != "" && strings.Contains(key, word) {
+			return "", &NameError{Code: NameBlocked, Message: "名字中含有不允许使用的词"}
+		}
+	}
+
+	return name, nil
+}
+
+// blockKey 屏蔽词比较用的形式：只保留字母和数字并忽略大小写
+func blockKey(s string) string {
+	s = cases.Fold().String(norm.NFKC.String(s))
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// sameName 判断两个规范化后的名字是否只有大小写不同
+func sameName(a, b string) bool {
+	return cases.Fold().String(a) == cases.Fold().String(b)
+}
+
+// errNameTaken 重名被拒绝
+func errNameTaken() error {
+	return &NameError{Code: NameTaken, Message: "这个名字已经有人用了"}
+}
+
+// uniqueName 检查名字在桌上是否重复，按规则拒绝或加上编号，调用方需持有锁
+func (g *Game) uniqueName(name string) (string, error) {
+	taken := func(candidate string) bool {
+		for _, player := range g.Players {
+			if sameName(player.Name, candidate) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !taken(name) {
+		return name, nil
+	}
+	if g.names.RejectDuplicates {
+		return "", errNameTaken()
+	}
+
+	// 加上编号，必要时按字符截短原名以免超过长度，放不下编号时只能拒绝
+	base := []rune(name)
+	for n := nameDupStart; ; n++ {
+		suffix := nameDupSeparator + strconv.Itoa(n)
+		keep := g.names.maxLength() - utf8.RuneCountInString(suffix)
+		if keep < 1 {
+			return "", errNameTaken()
+		}
+		if len(base) > keep {
+			base = base[:keep]
+		}
+		if candidate := strings.TrimSpace(string(base)) + suffix; !taken(candidate) {
+			return candidate, nil
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package game
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	policy := NamePolicy{Blocklist: []string{"admin"}}
+
+	tests := []struct {
+		name string
+		want string
+		code string
+	}{
+		{"alice", "alice", ""},
+		{"  Bob   the\tBuilder ", "Bob the Builder", ""},
+		{"Ａｌｉｃｅ１", "Alice1", ""},
+		{"小明", "小明", ""},
+		{"José", "José", ""},
+		{"o'neil-2_x.y", "o'neil-2_x.y", ""},
+		{"", "", NameEmpty},
+		{" \t ", "", NameEmpty},
+		{strings.Repeat("a", MaxNameLength+1), "", NameTooLong},
+		{strings.Repeat("骗", MaxNameLength), strings.Repeat("骗", MaxNameLength), ""},
+		{"<b>alice</b>", "", NameInvalid},
+		{"alice\u200b", "", NameInvalid},
+		{"alice\x00", "", NameInvalid},
+		{"Super ADMIN", "", NameBlocked},
+		{"Ａ.d.m.i.n", "", NameBlocked},
+	}
+	for _, tt := range tests {
+		got, err := policy.Normalize(tt.name)
+		var nameErr *NameError
+		switch {
+		case tt.code == "" && err != nil:
+			t.Errorf("Normalize(%q): %v", tt.name, err)
+		case tt.code != "" && (!errors.As(err, &nameErr) || nameErr.Code != tt.code):
+			t.Errorf("Normalize(%q): 错误 %v，应为 %s", tt.name, err, tt.code)
+		case got != tt.want:
+			t.Errorf("Normalize(%q) = %q，应为 %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDuplicateNames(t *testing.T) {
+	g := NewGame("g", GameSettings{})
+	g.names.MaxLength = 8
+	g.maxPlayers = 10
+
+	for _, tt := range []struct{ name, want string }{
+		{"alice", "alice"},
+		{"ALICE", "ALICE-2"},
+		{"alice", "alice-3"},
+		// 加编号后超长时按字符截短原名
+		{"longname", "longname"},
+		{"LongName", "LongNa-2"},
+		{"红桃皇后黑桃国王", "红桃皇后黑桃国王"},
+		{"红桃皇后黑桃国王", "红桃皇后黑桃-2"},
+	} {
+		id, err := g.AddPlayer(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := g.Players[id].Name
+		if got != tt.want {
+			t.Errorf("AddPlayer(%q) 的名字为 %q，应为 %q", tt.name, got, tt.want)
+		}
+		// 加了编号的名字也要能通过校验，例如从快照恢复时
+		if normalized, err := g.names.Normalize(got); err != nil || normalized != got {
+			t.Errorf("%q 没有通过校验: %q %v", got, normalized, err)
+		}
+	}
+
+	// 放不下编号时拒绝
+	var nameErr *NameError
+	g.names.MaxLength = 2
+	if _, err := g.AddPlayer("al"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.AddPlayer("AL"); !errors.As(err, &nameErr) || nameErr.Code != NameTaken {
+		t.Errorf("放不下编号: %v", err)
+	}
+
+	g.names.MaxLength = 8
+	g.names.RejectDuplicates = true
+	if _, err := g.AddPlayer("Alice"); !errors.As(err, &nameErr) || nameErr.Code != NameTaken {
+		t.Errorf("拒绝重名: %v", err)
+	}
+}
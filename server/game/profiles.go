@@ -0,0 +1,278 @@
+package game
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"server/rules"
+)
+
+// PlayerStats 一个匿名浏览器档案的累计战绩，由已结束的游戏记录统计得到，档案不是账号，见 IdentityKey
+type PlayerStats struct {
+	ProfileID         string  `json:"profileId"`
+	Name              string  `json:"name"`              // 最近一局使用的名字
+	GamesPlayed       int     `json:"gamesPlayed"`       // 参加的局数
+	Wins              int     `json:"wins"`              // 获胜的局数
+	Eliminations      int     `json:"eliminations"`      // 中弹出局的次数，中途认输不计
+	ShotsSurvived     int     `json:"shotsSurvived"`     // 开枪没有中弹的次数
+	LiesTold          int     `json:"liesTold"`          // 打出的牌不全是目标牌或王牌的次数
+	LiesCaught        int     `json:"liesCaught"`        // 质疑成功的次数
+	Challenges        int     `json:"challenges"`        // 质疑的次数
+	ChallengeAccuracy float64 `json:"challengeAccuracy"` // 质疑成功的比例，没有质疑过时为0
+	TimesCaughtLying  int     `json:"timesCaughtLying"`  // 说谎被玩家或系统质疑拆穿的次数
+}
+
+// add 累加另一份战绩并重新计算质疑成功率
+func (s *PlayerStats) add(other *PlayerStats) {
+	if other.Name != "" {
+		s.Name = other.Name
+	}
+	s.GamesPlayed += other.GamesPlayed
+	s.Wins += other.Wins
+	s.Eliminations += other.Eliminations
+	s.ShotsSurvived += other.ShotsSurvived
+	s.LiesTold += other.LiesTold
+	s.LiesCaught += other.LiesCaught
+	s.Challenges += other.Challenges
+	s.TimesCaughtLying += other.TimesCaughtLying
+
+	s.ChallengeAccuracy = 0
+	if s.Challenges > 0 {
+		s.ChallengeAccuracy = float64(s.LiesCaught) / float64(s.Challenges)
+	}
+}
+
+// recordStats 统计一局游戏记录中每个档案的战绩，没有档案的玩家不统计
+func recordStats(record *GameRecord) map[string]*PlayerStats {
+	stats := make(map[string]*PlayerStats, len(record.Profiles))
+	for playerID, profileID := range record.Profiles {
+		stats[playerID] = &PlayerStats{ProfileID: profileID, GamesPlayed: 1}
+	}
+
+	// of 返回玩家的战绩，不需要统计的玩家返回一个丢弃的值
+	of := func(playerID string) *PlayerStats {
+		if s, ok := stats[playerID]; ok {
+			return s
+		}
+		return &PlayerStats{}
+	}
+
+	for _, entry := range record.Scoreboard {
+		of(entry.PlayerID).Name = entry.PlayerName
+	}
+	if record.WinnerID != "" {
+		of(record.WinnerID).Wins++
+	}
+
+	for _, round := range record.Rounds {
+		for _, state := range round.PlayerInitialStates {
+			if s := of(state.PlayerID); s.Name == "" {
+				s.Name = state.PlayerName
+			}
+		}
+
+		for _, play := range round.PlayHistory {
+			lie := !rules.IsValidPlay(play.PlayedCards, round.TargetCard)
+			caught := play.WasChallenged && play.ChallengeResult != nil && *play.ChallengeResult
+			if lie {
+				of(play.PlayerID).LiesTold++
+			}
+			if caught {
+				of(play.PlayerID).TimesCaughtLying++
+			}
+			if play.ChallengerID != "" {
+				challenger := of(play.ChallengerID)
+				challenger.Challenges++
+				if caught {
+					challenger.LiesCaught++
+				}
+			}
+		}
+
+		if result := round.RoundResult; result != nil {
+			shooter := of(result.ShooterID)
+			if !result.BulletHit {
+				shooter.ShotsSurvived++
+			}
+			if result.Eliminated {
+				shooter.Eliminations++
+			}
+		}
+	}
+
+	// 同一档案可能占了不止一个座位，按档案合并
+	byProfile := make(map[string]*PlayerStats, len(stats))
+	for _, s := range stats {
+		total, ok := byProfile[s.ProfileID]
+		if !ok {
+			total = &PlayerStats{ProfileID: s.ProfileID}
+			byProfile[s.ProfileID] = total
+		}
+		total.add(s)
+	}
+	return byProfile
+}
+
+// ProfileStore 按匿名浏览器档案保存的战绩，dir 不为空时每个档案的战绩保存为一个JSON文件，重启后仍然保留
+type ProfileStore struct {
+	dir     string
+	mutex   sync.RWMutex
+	players map[string]*PlayerStats
+}
+
+// NewProfileStore 创建战绩存储并读取 dir 中已有的战绩，dir 为空时只保存在内存中
+func NewProfileStore(dir string) (*ProfileStore, error) {
+	s := &ProfileStore{dir: dir, players: make(map[string]*PlayerStats)}
+	if dir == "" {
+		return s, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		stats := &PlayerStats{}
+		if err := json.Unmarshal(data, stats); err != nil {
+			return nil, err
+		}
+		s.players[stats.ProfileID] = stats
+	}
+	return s, nil
+}
+
+// Record 把一局游戏记录计入参加的档案的战绩
+func (s *ProfileStore) Record(record *GameRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var errs []error
+	for profileID, delta := range recordStats(record) {
+		stats, ok := s.players[profileID]
+		if !ok {
+			stats = &PlayerStats{ProfileID: profileID}
+			s.players[profileID] = stats
+		}
+		stats.add(delta)
+
+		if s.dir != "" {
+			data, err := json.MarshalIndent(stats, "", "  ")
+			if err == nil {
+				err = writeFileAtomic(filepath.Join(s.dir, profileID+".json"), data)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats 返回档案的战绩，没有参加过游戏时返回 false
+func (s *ProfileStore) Stats(profileID string) (PlayerStats, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	stats, ok := s.players[profileID]
+	if !ok {
+		return PlayerStats{}, false
+	}
+	return *stats, true
+}
+
+// IdentityKey 签发和校验匿名身份令牌的服务器密钥，战绩按令牌里的身份统计
+// 令牌为 "身份ID.签名"，签名是服务器密钥对身份ID的 HMAC-SHA256，客户端不能自己编造令牌，
+// 也不能冒用别人的档案：只有拿到服务器签发的令牌才会计入对应的档案。
+// 身份仍然是匿名的，代表保存令牌的那个浏览器，不是经过登录的账号
+type IdentityKey struct {
+	key []byte
+}
+
+// NewIdentityKey 由配置的密钥创建，密钥为空时随机生成，重启后之前签发的令牌全部失效
+func NewIdentityKey(secret string) *IdentityKey {
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &IdentityKey{key: key}
+}
+
+// sign 返回身份ID的签名
+func (s *IdentityKey) sign(id string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Issue 签发一个新的身份令牌
+func (s *IdentityKey) Issue() string {
+	raw := make([]byte, 8)
+	rand.Read(raw)
+	id := hex.EncodeToString(raw)
+	return id + "." + s.sign(id)
+}
+
+// ProfileID 校验令牌并返回公开的档案ID，令牌无效时返回空字符串
+func (s *IdentityKey) ProfileID(token string) string {
+	id, signature, ok := strings.Cut(token, ".")
+	if !ok || id == "" || !hmac.Equal([]byte(signature), []byte(s.sign(id))) {
+		return ""
+	}
+	return "p" + id
+}
+
+// requestProfileID 返回请求携带的身份令牌对应的档案ID，没有令牌或令牌无效时返回空字符串
+func (gm *GameManager) requestProfileID(r *http.Request) string {
+	return gm.identities.ProfileID(requestUser(r))
+}
+
+// HandleIdentity 签发新的匿名身份令牌，浏览器保存后在创建和加入游戏时带上
+func (gm *GameManager) HandleIdentity(w http.ResponseWriter, r *http.Request) {
+	if !gm.limitRequest(w, r, gm.joinLimiter, "identity") {
+		return
+	}
+
+	token := gm.identities.Issue()
+	writeJSON(w, map[string]string{
+		"token":     token,
+		"profileId": gm.identities.ProfileID(token),
+	})
+}
+
+// HandlePlayerStats 返回匿名档案的战绩，id 为 me 时返回请求者所用浏览器的战绩
+func (gm *GameManager) HandlePlayerStats(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(r.PathValue("id"))
+	if id == "me" {
+		if id = gm.requestProfileID(r); id == "" {
+			http.Error(w, "请求没有携带有效的身份令牌", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if gm.options.Profiles == nil {
+		http.Error(w, "没有启用玩家战绩", http.StatusNotFound)
+		return
+	}
+	stats, ok := gm.options.Profiles.Stats(id)
+	if !ok {
+		http.Error(w, "没有这名玩家的战绩", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, stats)
+}
@@ -0,0 +1,143 @@
+package game
+
+import (
+	"strings"
+	"testing"
+
+	"server/rules"
+)
+
+// testRecord 三名玩家的一局：a 和 b 有档案，c 没有
+func testRecord() *GameRecord {
+	yes, no := true, false
+	return &GameRecord{
+		GameID:   "g",
+		WinnerID: "b",
+		Profiles: map[string]string{"a": "ua", "b": "ub"},
+		Scoreboard: []rules.ScoreEntry{
+			{PlayerID: "b", PlayerName: "bob"},
+			{PlayerID: "a", PlayerName: "alice"},
+			{PlayerID: "c", PlayerName: "carol"},
+		},
+		Rounds: []RoundRecord{
+			{
+				TargetCard: rules.CardQ,
+				PlayHistory: []PlayAction{
+					// a 说谎，b 质疑成功
+					{PlayerID: "a", PlayedCards: []string{rules.CardK}, WasChallenged: true, ChallengeResult: &yes, ChallengerID: "b"},
+				},
+				RoundResult: &ShootingResult{ShooterID: "a", BulletHit: false},
+			},
+			{
+				TargetCard: rules.CardA,
+				PlayHistory: []PlayAction{
+					// b 诚实出牌，c 不质疑
+					{PlayerID: "b", PlayedCards: []string{rules.CardA, rules.CardJoker}},
+					// c 说谎，a 没有质疑
+					{PlayerID: "c", PlayedCards: []string{rules.CardQ}},
+					// a 诚实出牌，b 质疑失败
+					{PlayerID: "a", PlayedCards: []string{rules.CardA}, WasChallenged: true, ChallengeResult: &no, ChallengerID: "b"},
+				},
+				RoundResult: &ShootingResult{ShooterID: "b", BulletHit: false},
+			},
+			{
+				TargetCard: rules.CardK,
+				PlayHistory: []PlayAction{
+					// a 说谎，被系统拆穿后中弹出局
+					{PlayerID: "a", PlayedCards: []string{rules.CardQ}, WasChallenged: true, ChallengeResult: &yes},
+				},
+				RoundResult: &ShootingResult{ShooterID: "a", BulletHit: true, Eliminated: true},
+			},
+		},
+	}
+}
+
+func TestRecordStats(t *testing.T) {
+	stats := recordStats(testRecord())
+	if len(stats) != 2 {
+		t.Fatalf("应只统计有档案的玩家: %+v", stats)
+	}
+
+	want := map[string]PlayerStats{
+		"ua": {ProfileID: "ua", Name: "alice", GamesPlayed: 1, Eliminations: 1, ShotsSurvived: 1, LiesTold: 2, TimesCaughtLying: 2},
+		"ub": {ProfileID: "ub", Name: "bob", GamesPlayed: 1, Wins: 1, ShotsSurvived: 1, LiesCaught: 1, Challenges: 2, ChallengeAccuracy: 0.5},
+	}
+	for profileID, w := range want {
+		if got := *stats[profileID]; got != w {
+			t.Errorf("%s 的战绩:\n得到 %+v\n应为 %+v", profileID, got, w)
+		}
+	}
+}
+
+func TestProfileStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewProfileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Record(testRecord()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 重新读取目录后战绩仍在
+	reloaded, err := NewProfileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, ok := reloaded.Stats("ub")
+	if !ok || bob.GamesPlayed != 2 || bob.Wins != 2 || bob.Challenges != 4 || bob.ChallengeAccuracy != 0.5 {
+		t.Errorf("bob 的战绩: %+v", bob)
+	}
+	if _, ok := reloaded.Stats("uc"); ok {
+		t.Error("匿名玩家不应有战绩")
+	}
+}
+
+func TestUnfinishedGameNotRecorded(t *testing.T) {
+	store, err := NewProfileStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gm := NewGameManager(ManagerOptions{Profiles: store})
+
+	unfinished := testRecord()
+	unfinished.WinnerID = ""
+	gm.archiveRecord(unfinished)
+	if stats, ok := store.Stats("ua"); ok {
+		t.Errorf("没有打完的游戏不应计入战绩: %+v", stats)
+	}
+
+	gm.archiveRecord(testRecord())
+	if bob, ok := store.Stats("ub"); !ok || bob.GamesPlayed != 1 || bob.Wins != 1 {
+		t.Errorf("bob 的战绩: %+v", bob)
+	}
+}
+
+func TestIdentityKey(t *testing.T) {
+	key := NewIdentityKey("secret")
+	token := key.Issue()
+	profileID := key.ProfileID(token)
+	if profileID == "" || key.ProfileID(key.Issue()) == profileID {
+		t.Fatalf("签发的令牌: %q -> %q", token, profileID)
+	}
+
+	// 相同密钥重启后仍然有效，其他密钥签发或篡改过的令牌无效
+	if NewIdentityKey("secret").ProfileID(token) != profileID {
+		t.Error("相同密钥不认识之前签发的令牌")
+	}
+	id, _, _ := strings.Cut(token, ".")
+	for _, forged := range []string{
+		NewIdentityKey("other").Issue(),
+		NewIdentityKey("").Issue(),
+		id,
+		id + ".",
+		"x" + token,
+		"",
+	} {
+		if got := key.ProfileID(forged); got != "" {
+			t.Errorf("无效的令牌 %q 得到了档案 %q", forged, got)
+		}
+	}
+}
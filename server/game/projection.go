@@ -0,0 +1,133 @@
+package game
+
+import "server/rules"
+
+// project 将事件投影为推送给某位玩家的消息，隐藏该玩家不应看到的信息
+// view 是折叠了该事件之后的状态
+func project(view *rules.State, ev rules.Event, viewerID string) []map[string]interface{} {
+	switch ev.Type {
+	case rules.EventTargetChosen:
+		if viewerID == ev.PlayerID {
+			return []map[string]interface{}{yourTurnMessage()}
+		}
+
+	case rules.EventCardsPlayed:
+		message := map[string]interface{}{
+			"type":       "play_action",
+			"playerName": view.Players[ev.PlayerID].Name,
+			"cardCount":  len(ev.Cards),
+			"targetCard": view.TargetCard,
+			"nextPlayer": playerName(view, ev.TargetID),
+		}
+		// 对出牌玩家显示实际打出的牌
+		if viewerID == ev.PlayerID {
+			message["playedCards"] = ev.Cards
+		}
+		messages := []map[string]interface{}{message}
+		if viewerID == ev.TargetID && view.AwaitingChallenge {
+			messages = append(messages, challengeRequestMessage(view))
+		}
+		return messages
+
+	case rules.EventChallengeDeclined:
+		messages := []map[string]interface{}{{
+			"type":            "challenge_result",
+			"challengerName":  view.Players[ev.PlayerID].Name,
+			"wasChallenged":   false,
+			"challengeReason": ev.Reason,
+		}}
+		// 不质疑的玩家接着出牌
+		if viewerID == ev.PlayerID {
+			messages = append(messages, yourTurnMessage())
+		}
+		return messages
+
+	case rules.EventChallengeResolved:
+		if ev.System {
+			return []map[string]interface{}{{
+				"type":           "system_challenge",
+				"playerName":     view.Players[ev.PlayerID].Name,
+				"challengeValid": ev.Success, // 质疑成功意味着出牌不合法
+				"playedCards":    ev.Cards,
+			}}
+		}
+		return []map[string]interface{}{{
+			"type":             "challenge_result",
+			"challengerName":   view.Players[ev.TargetID].Name,
+			"wasChallenged":    true,
+			"challengeReason":  ev.Reason,
+			"challengeSuccess": ev.Success,
+		}}
+
+	case rules.EventShotFired:
+		shooter := view.Players[ev.PlayerID]
+		return []map[string]interface{}{{
+			"type":        "shooting_result",
+			"shooterName": shooter.Name,
+			"bulletHit":   ev.Hit,
+			"lives":       shooter.Lives,
+			"eliminated":  shooter.Lives <= 0,
+		}}
+
+	case rules.EventPlayerEliminated:
+		return []map[string]interface{}{{
+			"type":       "player_eliminated",
+			"playerName": view.Players[ev.PlayerID].Name,
+			"reason":     ev.Reason,
+		}}
+
+	case rules.EventTurnPassed:
+		if viewerID != ev.PlayerID {
+			return nil
+		}
+		if ev.Pending {
+			return []map[string]interface{}{challengeRequestMessage(view)}
+		}
+		return []map[string]interface{}{yourTurnMessage()}
+
+	case rules.EventGameWon:
+		message := map[string]interface{}{
+			"type":       "game_over",
+			"winnerName": view.Players[ev.PlayerID].Name,
+			"scoreboard": view.Scoreboard(),
+			"gameNumber": view.GameNumber,
+			"bestOf":     view.Settings.BestOf,
+			"matchWins":  view.MatchWins,
+		}
+		if seriesWinner, ok := view.Players[view.SeriesWinnerID]; ok {
+			message["seriesWinnerName"] = seriesWinner.Name
+		}
+		return []map[string]interface{}{message}
+
+	case rules.EventEmote:
+		return []map[string]interface{}{emoteMessage(ev.PlayerID, playerName(view, ev.PlayerID), ev.TargetID, playerName(view, ev.TargetID), ev.Emote)}
+	}
+
+	return nil
+}
+
+// yourTurnMessage 轮到玩家出牌的通知
+func yourTurnMessage() map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "your_turn",
+		"message": "轮到你出牌了",
+	}
+}
+
+// challengeRequestMessage 询问玩家是否质疑上一次出牌
+func challengeRequestMessage(view *rules.State) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "challenge_request",
+		"playerName": playerName(view, view.LastPlay.PlayerID),
+		"cardCount":  len(view.LastPlay.Cards),
+		"targetCard": view.TargetCard,
+	}
+}
+
+// playerName 返回玩家在牌局中的名字，玩家不存在时返回空字符串
+func playerName(view *rules.State, playerID string) string {
+	if player, ok := view.Players[playerID]; ok {
+		return player.Name
+	}
+	return ""
+}
@@ -0,0 +1,332 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"server/metrics"
+
+	"github.com/gorilla/websocket"
+)
+
+// MessageAbuseLimit 一个连接被限流丢弃的消息比放行的多出这么多条时断开连接
+const MessageAbuseLimit = 50
+
+// TooManyGamesRetryAfter 创建的游戏数达到上限时建议客户端等待的时间
+const TooManyGamesRetryAfter = time.Minute
+
+// ErrTooManyGames 同一用户或IP同时进行的游戏数达到上限
+var ErrTooManyGames = errors.New("你创建的游戏太多，请先结束已有的游戏")
+
+// 被限流的请求和消息数，scope 为 create_game、join_game、identity、message、chat 或 emote，by 为 ip、user、connection 或 player
+var rateLimited = metrics.NewCounter("liarsbar_rate_limited_total", "被限流拒绝的请求和消息数", "scope", "by")
+
+// RateLimit 令牌桶限流：平均每秒 Rate 次，最多连续 Burst 次，Rate 为0表示不限
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Enabled 是否启用限流
+func (l RateLimit) Enabled() bool {
+	return l.Rate > 0
+}
+
+// Validate 检查限流参数
+func (l RateLimit) Validate() error {
+	if l.Rate < 0 {
+		return errors.New("限流速率不能为负")
+	}
+	if l.Enabled() && l.Burst < 1 {
+		return errors.New("启用限流时突发次数至少为1")
+	}
+	return nil
+}
+
+// tokenBucket 令牌桶，调用方负责加锁
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket 创建装满令牌的桶
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{tokens: float64(limit.Burst), last: now}
+}
+
+// refill 按经过的时间补充令牌
+func (b *tokenBucket) refill(limit RateLimit, now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed.Seconds()*limit.Rate)
+		b.last = now
+	}
+}
+
+// take 取出一个令牌，不够时返回还需要等待的时间
+func (b *tokenBucket) take(limit RateLimit, now time.Time) (bool, time.Duration) {
+	b.refill(limit, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+// keyedLimiter 按来源IP或用户分别限流
+type keyedLimiter struct {
+	limit   RateLimit
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// newKeyedLimiter 创建按键限流的限流器
+func newKeyedLimiter(limit RateLimit) *keyedLimiter {
+	return &keyedLimiter{limit: limit, buckets: make(map[string]*tokenBucket)}
+}
+
+// allow 为 key 取出一个令牌，空的 key 不限流
+func (l *keyedLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	rejected, wait := l.allowAll([]string{key}, now)
+	return rejected < 0, wait
+}
+
+// allowAll 所有 key 都有令牌时各取出一个，只要有一个不够就都不取，
+// 返回第一个被拒绝的 key 的下标和需要等待的时间，都允许时返回-1；空的 key 不限流
+func (l *keyedLimiter) allowAll(keys []string, now time.Time) (int, time.Duration) {
+	if !l.limit.Enabled() {
+		return -1, 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	buckets := make(map[string]*tokenBucket, len(keys))
+	for i, key := range keys {
+		if key == "" || buckets[key] != nil {
+			continue
+		}
+
+		bucket, ok := l.buckets[key]
+		if !ok {
+			bucket = newTokenBucket(l.limit, now)
+			l.buckets[key] = bucket
+		}
+		bucket.refill(l.limit, now)
+		if bucket.tokens < 1 {
+			return i, time.Duration((1 - bucket.tokens) / l.limit.Rate * float64(time.Second))
+		}
+		buckets[key] = bucket
+	}
+
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return -1, 0
+}
+
+// prune 删除已经装满的桶，它们和新建的桶没有区别
+func (l *keyedLimiter) prune(now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for key, bucket := range l.buckets {
+		bucket.refill(l.limit, now)
+		if bucket.tokens >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// playerLimiter 按玩家分别限流，调用方需持有游戏的锁
+type playerLimiter struct {
+	limit   RateLimit
+	buckets map[string]*tokenBucket
+}
+
+// newPlayerLimiter 创建按玩家限流的限流器
+func newPlayerLimiter(limit RateLimit) playerLimiter {
+	return playerLimiter{limit: limit, buckets: make(map[string]*tokenBucket)}
+}
+
+// allow 为玩家取出一个令牌，未启用限流时总是允许
+func (l playerLimiter) allow(playerID string) bool {
+	if !l.limit.Enabled() {
+		return true
+	}
+
+	now := time.Now()
+	bucket, ok := l.buckets[playerID]
+	if !ok {
+		bucket = newTokenBucket(l.limit, now)
+		l.buckets[playerID] = bucket
+	}
+	ok, _ = bucket.take(l.limit, now)
+	return ok
+}
+
+// TrustedProxies 可信的反向代理，来自这些地址的请求按 X-Forwarded-For 识别来源IP
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies 解析IP或CIDR列表
+func ParseTrustedProxies(entries []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("无效的代理地址 %q", entry)
+		}
+		addr = addr.Unmap()
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return proxies, nil
+}
+
+// contains 检查地址是否属于可信代理
+func (p TrustedProxies) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP 返回请求的来源IP：连接来自可信代理时，从 X-Forwarded-For 的最右边往左跳过可信代理，
+// 第一个不可信的地址就是客户端；客户端自己伪造的部分在它左边，不会被采用
+func (p TrustedProxies) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !p.contains(addr) {
+		return host
+	}
+
+	hops := make([]string, 0)
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		host = hop.Unmap().String()
+		if !p.contains(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// clientIP 按可信代理的配置返回请求的来源IP
+func (gm *GameManager) clientIP(r *http.Request) string {
+	return gm.options.TrustedProxies.clientIP(r)
+}
+
+// requestUser 返回请求携带的身份令牌，没有时返回空字符串，令牌由 IdentityKey 校验
+func requestUser(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// requestOwners 用于限制同时进行的游戏数的身份：总是按IP，带有效的身份令牌时同时按档案
+// 新的身份随时可以申请，每次换一个身份也绕不过IP的上限；快照里只保存公开的档案ID，不保存令牌
+func (gm *GameManager) requestOwners(r *http.Request) []string {
+	owners := []string{"ip:" + gm.clientIP(r)}
+	if user := gm.requestProfileID(r); user != "" {
+		owners = append(owners, "user:"+user)
+	}
+	return owners
+}
+
+// limitRequest 按来源IP和身份档案限流，两者都有余量时才各扣一次，超过时返回429和 Retry-After 并返回 false
+func (gm *GameManager) limitRequest(w http.ResponseWriter, r *http.Request, limiter *keyedLimiter, scope string) bool {
+	ip := gm.clientIP(r)
+	rejected, wait := limiter.allowAll([]string{ip, gm.requestProfileID(r)}, time.Now())
+	if rejected < 0 {
+		return true
+	}
+
+	by := []string{"ip", "user"}[rejected]
+	rateLimited.Inc(scope, by)
+	slog.Warn("请求被限流", "scope", scope, "by", by, "ip", ip)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondError(w, http.StatusTooManyRequests, ErrorRateLimited, "请求过于频繁，请稍后再试")
+	return false
+}
+
+// messageLimiter 一个WebSocket连接的消息限流，只在读取消息的 goroutine 中使用
+type messageLimiter struct {
+	limit   RateLimit
+	bucket  *tokenBucket
+	strikes int // 被丢弃的消息比放行的多出的条数
+}
+
+// newMessageLimiter 创建连接的消息限流
+func newMessageLimiter(limit RateLimit) *messageLimiter {
+	return &messageLimiter{limit: limit, bucket: newTokenBucket(limit, time.Now())}
+}
+
+// allow 判断是否处理这条消息
+func (l *messageLimiter) allow() bool {
+	if !l.limit.Enabled() {
+		return true
+	}
+
+	if ok, _ := l.bucket.take(l.limit, time.Now()); ok {
+		if l.strikes > 0 {
+			l.strikes--
+		}
+		return true
+	}
+	l.strikes++
+	rateLimited.Inc("message", "connection")
+	return false
+}
+
+// rejectMessage 处理一条被限流的消息：刚开始被限流时提醒玩家，持续滥用时断开连接，返回是否应断开
+func (g *Game) rejectMessage(playerID string, conn *websocket.Conn, limiter *messageLimiter) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if limiter.strikes >= MessageAbuseLimit {
+		g.playerLogger(playerID).Warn("持续发送过多消息，断开连接", "strikes", limiter.strikes)
+		writeMessage(conn, map[string]interface{}{
+			"type":    "error",
+			"message": "发送消息过于频繁，连接已断开",
+		})
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limited"))
+		conn.Close()
+		return true
+	}
+
+	if limiter.strikes == 1 {
+		g.playerLogger(playerID).Warn("消息被限流")
+		writeMessage(conn, map[string]interface{}{
+			"type":    "error",
+			"message": "发送消息太频繁，部分操作被忽略",
+		})
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package game
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedLimiter(t *testing.T) {
+	limiter := newKeyedLimiter(RateLimit{Rate: 2, Burst: 3})
+	now := time.Unix(0, 0)
+
+	// 连续3次之后需要等半秒才有下一个令牌
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow("a", now); !ok {
+			t.Fatalf("第 %d 次请求被拒绝", i+1)
+		}
+	}
+	ok, wait := limiter.allow("a", now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("第4次请求: %v %v，应等待500ms", ok, wait)
+	}
+
+	// 不同的键互不影响，空键不限流
+	if ok, _ := limiter.allow("b", now); !ok {
+		t.Error("另一个键被限流")
+	}
+	if ok, _ := limiter.allow("", now); !ok {
+		t.Error("空键被限流")
+	}
+
+	if ok, _ := limiter.allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("等待后仍被拒绝")
+	}
+
+	// 任一个键没有令牌时其他键也不扣
+	if rejected, _ := limiter.allowAll([]string{"c", "a"}, now.Add(500*time.Millisecond)); rejected != 1 {
+		t.Errorf("a 没有令牌时应拒绝第2个键，实际 %d", rejected)
+	}
+	if tokens := limiter.buckets["c"].tokens; tokens != 3 {
+		t.Errorf("被拒绝的请求扣了 c 的令牌，剩余 %v", tokens)
+	}
+
+	// 装满的桶会被清理
+	limiter.prune(now.Add(100 * time.Millisecond))
+	if _, ok := limiter.buckets["b"]; !ok {
+		t.Error("还没装满的桶被清理")
+	}
+	limiter.prune(now.Add(10 * time.Second))
+	if len(limiter.buckets) != 0 {
+		t.Errorf("清理后还剩 %d 个桶", len(limiter.buckets))
+	}
+
+	// 速率为0时不限流
+	unlimited := newKeyedLimiter(RateLimit{})
+	for i := 0; i < 100; i++ {
+		if ok, _ := unlimited.allow("a", now); !ok {
+			t.Fatal("没有启用的限流器拒绝了请求")
+		}
+	}
+}
+
+func TestMessageLimiter(t *testing.T) {
+	limiter := newMessageLimiter(RateLimit{Rate: 0.001, Burst: 2})
+	for i := 0; i < 2; i++ {
+		if !limiter.allow() {
+			t.Fatal("突发范围内的消息被拒绝")
+		}
+	}
+	for i := 0; i < MessageAbuseLimit; i++ {
+		if limiter.allow() {
+			t.Fatal("超过频率的消息被放行")
+		}
+	}
+	if limiter.strikes != MessageAbuseLimit {
+		t.Errorf("strikes = %d", limiter.strikes)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"直连", "1.2.3.4:5000", []string{"9.9.9.9"}, "1.2.3.4"},
+		{"经过代理", "10.0.0.1:5000", []string{"1.2.3.4"}, "1.2.3.4"},
+		{"多层代理", "10.0.0.1:5000", []string{"9.9.9.9, 1.2.3.4", "10.0.0.2"}, "1.2.3.4"},
+		{"IPv6代理", "[::1]:5000", []string{"1.2.3.4"}, "1.2.3.4"},
+		{"代理没有转发头", "10.0.0.1:5000", nil, "10.0.0.1"},
+		{"无效的转发头", "10.0.0.1:5000", []string{"1.2.3.4, unknown"}, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := proxies.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+
+	// 没有配置代理时忽略转发头
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4")
+	if got := TrustedProxies(nil).clientIP(r); got != "10.0.0.1" {
+		t.Errorf("未配置代理时 clientIP = %q", got)
+	}
+}
+
+func TestAtCapacityRetryAfter(t *testing.T) {
+	gm := NewGameManager(ManagerOptions{MaxGames: 1})
+	defer gm.Stop()
+	if _, err := gm.CreateGame(GameSettings{}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	gm.HandleCreateGame(w, httptest.NewRequest(http.MethodPost, "/api/games", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("游戏数达到上限: %d，Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestCreateGameLimits(t *testing.T) {
+	gm := NewGameManager(ManagerOptions{MaxGames: 2, MaxGamesPerUser: 1})
+	defer gm.Stop()
+
+	first, err := gm.CreateGame(GameSettings{}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gm.CreateGame(GameSettings{}, "alice"); err != ErrTooManyGames {
+		t.Errorf("同一创建者第二个游戏: %v", err)
+	}
+	if _, err := gm.CreateGame(GameSettings{}, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gm.CreateGame(GameSettings{}, "carol"); err != ErrAtCapacity {
+		t.Errorf("超过游戏总数: %v", err)
+	}
+
+	// 移除游戏后归还名额，被总数拒绝的创建者没有占用名额
+	gm.RemoveGame(first)
+	if _, err := gm.CreateGame(GameSettings{}, "carol"); err != nil {
+		t.Errorf("空出位置后创建: %v", err)
+	}
+	if _, err := gm.CreateGame(GameSettings{}, "alice"); err != ErrAtCapacity {
+		t.Errorf("名额归还后应只受总数限制: %v", err)
+	}
+}
+
+func TestCreateGameLimitsPerIP(t *testing.T) {
+	gm := NewGameManager(ManagerOptions{MaxGamesPerUser: 1, MaxGamesPerIP: 2})
+	defer gm.Stop()
+
+	if _, err := gm.CreateGame(GameSettings{}, "ip:1.2.3.4", "user:a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gm.CreateGame(GameSettings{}, "ip:1.2.3.4", "user:b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gm.CreateGame(GameSettings{}, "ip:1.2.3.4", "user:c"); err != ErrTooManyGames {
+		t.Errorf("换令牌绕过IP上限: %v", err)
+	}
+
+	// 被IP上限拒绝的用户没有占用名额
+	if _, err := gm.CreateGame(GameSettings{}, "ip:5.6.7.8", "user:c"); err != nil {
+		t.Errorf("其他IP的新用户: %v", err)
+	}
+}
+
+func TestConcurrentJoin(t *testing.T) {
+	gm := NewGameManager(ManagerOptions{})
+	defer gm.Stop()
+	gameID, err := gm.CreateGame(GameSettings{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := gm.GetGame(gameID)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	joined, full := 0, 0
+	for i := 0; i < 3*MaxPlayers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := g.AddPlayer(fmt.Sprintf("p%d", i))
+			mutex.Lock()
+			defer mutex.Unlock()
+			switch err {
+			case nil:
+				joined++
+			case ErrGameFull:
+				full++
+			default:
+				t.Errorf("加入失败: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if joined != MaxPlayers || full != 2*MaxPlayers {
+		t.Errorf("加入 %d 人，满员拒绝 %d 人", joined, full)
+	}
+
+	g.mutex.Lock()
+	g.State = GameStatePlaying
+	g.mutex.Unlock()
+	if _, err := g.AddPlayer("late"); err != ErrGameStarted {
+		t.Errorf("开局后加入: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package game
+
+import "server/rules"
+
+// buildRecord 由事件日志生成游戏记录，记录只是日志的一个视图
+func buildRecord(gameID string, events []rules.Event) *GameRecord {
+	if len(events) == 0 || events[0].Type != rules.EventGameStarted {
+		return nil
+	}
+
+	// 在一个独立的状态上重放日志，以便得到每一步时的手牌和弹仓
+	replay := rules.NewState()
+
+	record := &GameRecord{
+		GameID: gameID,
+		Rounds: make([]RoundRecord, 0),
+	}
+
+	// currentRound 当前回合的记录
+	currentRound := func() *RoundRecord {
+		if len(record.Rounds) == 0 {
+			return nil
+		}
+		return &record.Rounds[len(record.Rounds)-1]
+	}
+
+	// lastPlay 当前回合最近一次出牌的记录
+	lastPlay := func() *PlayAction {
+		round := currentRound()
+		if round == nil || len(round.PlayHistory) == 0 {
+			return nil
+		}
+		return &round.PlayHistory[len(round.PlayHistory)-1]
+	}
+
+	for _, ev := range events {
+		replay.Apply(ev)
+
+		switch ev.Type {
+		case rules.EventGameStarted:
+			record.GameNumber = ev.GameNumber
+			record.Settings = *ev.Settings
+			record.PlayerNames = append([]string(nil), ev.PlayerNames...)
+
+		case rules.EventTargetChosen:
+			round := RoundRecord{
+				RoundID:             ev.Round,
+				TargetCard:          ev.Card,
+				RoundPlayers:        make([]string, 0),
+				StartingPlayerID:    ev.PlayerID,
+				StartingPlayerName:  playerName(replay, ev.PlayerID),
+				PlayerInitialStates: make([]PlayerInitialState, 0),
+				PlayerOpinions:      make(map[string]map[string]string),
+				PlayHistory:         make([]PlayAction, 0),
+			}
+			for _, playerID := range replay.PlayerOrder {
+				player := replay.Players[playerID]
+				if !player.Alive {
+					continue
+				}
+				round.RoundPlayers = append(round.RoundPlayers, player.Name)
+				round.PlayerInitialStates = append(round.PlayerInitialStates, PlayerInitialState{
+					PlayerID:           playerID,
+					PlayerName:         player.Name,
+					BulletPosition:     player.BulletPosition,
+					CurrentGunPosition: player.CurrentBulletPosition,
+					InitialHand:        append([]string(nil), player.Hand...),
+				})
+				round.PlayerOpinions[playerID] = make(map[string]string)
+			}
+			record.Rounds = append(record.Rounds, round)
+
+		case rules.EventCardsPlayed:
+			if round := currentRound(); round != nil {
+				play := replay.LastPlay
+				round.PlayHistory = append(round.PlayHistory, PlayAction{
+					PlayerID:       play.PlayerID,
+					PlayerName:     playerName(replay, play.PlayerID),
+					PlayedCards:    append([]string(nil), play.Cards...),
+					RemainingCards: append([]string(nil), play.Remaining...),
+					NextPlayerID:   play.NextPlayerID,
+					NextPlayerName: playerName(replay, play.NextPlayerID),
+				})
+			}
+
+		case rules.EventChallengeDeclined:
+			if play := lastPlay(); play != nil {
+				play.WasChallenged = false
+				play.ChallengeReason = ev.Reason
+			}
+
+		case rules.EventChallengeResolved:
+			if play := lastPlay(); play != nil {
+				success := ev.Success
+				play.WasChallenged = true
+				play.ChallengeReason = ev.Reason
+				play.ChallengeResult = &success
+				if !ev.System {
+					play.ChallengerID = ev.TargetID
+				}
+			}
+
+		case rules.EventShotFired:
+			if round := currentRound(); round != nil {
+				round.RoundResult = &ShootingResult{
+					ShooterID:   ev.PlayerID,
+					ShooterName: playerName(replay, ev.PlayerID),
+					BulletHit:   ev.Hit,
+				}
+			}
+
+		case rules.EventPlayerEliminated:
+			round := currentRound()
+			if round == nil {
+				break
+			}
+			switch {
+			case ev.Reason == rules.EliminatedByForfeit:
+				round.Forfeits = append(round.Forfeits, playerName(replay, ev.PlayerID))
+			case ev.Reason == rules.EliminatedByShot && round.RoundResult != nil && round.RoundResult.ShooterID == ev.PlayerID:
+				round.RoundResult.Eliminated = true
+			}
+
+		case rules.EventEmote:
+			if round := currentRound(); round != nil {
+				round.Emotes = append(round.Emotes, EmoteRecord{
+					PlayerID:   ev.PlayerID,
+					PlayerName: playerName(replay, ev.PlayerID),
+					TargetID:   ev.TargetID,
+					TargetName: playerName(replay, ev.TargetID),
+					Emote:      ev.Emote,
+					AfterPlay:  len(round.PlayHistory),
+					Time:       ev.Time,
+				})
+			}
+
+		case rules.EventGameWon:
+			record.Winner = playerName(replay, ev.PlayerID)
+			record.WinnerID = ev.PlayerID
+			record.Scoreboard = replay.Scoreboard()
+		}
+	}
+
+	return record
+}
+
+// record 返回最近这一局的游戏记录，并记下各玩家对应的档案
+func (g *Game) record() *GameRecord {
+	record := buildRecord(g.ID, g.Events)
+	if record == nil {
+		return nil
+	}
+	for playerID, player := range g.Players {
+		if player.ProfileID == "" {
+			continue
+		}
+		if record.Profiles == nil {
+			record.Profiles = make(map[string]string)
+		}
+		record.Profiles[playerID] = player.ProfileID
+	}
+	return record
+}
@@ -0,0 +1,11 @@
+package game
+
+import "server/rules"
+
+// GameSettings 牌桌规则设置，具体规则由 rules 包定义
+type GameSettings = rules.Settings
+
+// DefaultGameSettings 返回默认规则（中弹即出局）
+func DefaultGameSettings() GameSettings {
+	return rules.DefaultSettings()
+}
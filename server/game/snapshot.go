@@ -0,0 +1,183 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"server/logging"
+	"server/rules"
+
+	"github.com/gorilla/websocket"
+)
+
+// Snapshot 将游戏的座位、规则和事件日志序列化为JSON，手牌、牌堆和子弹位置都可由日志重放得到
+func (g *Game) Snapshot() ([]byte, error) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return json.Marshal(g)
+}
+
+// RestoreGame 从快照恢复游戏，玩家需要重新连接
+func RestoreGame(data []byte) (*Game, error) {
+	g := &Game{}
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, err
+	}
+	if g.ID == "" {
+		return nil, errors.New("快照缺少游戏ID")
+	}
+
+	if g.Players == nil {
+		g.Players = make(map[string]*Player)
+	}
+	for _, player := range g.Players {
+		if player.Opinions == nil {
+			player.Opinions = make(map[string]string)
+		}
+	}
+	g.Connections = make(map[string]*websocket.Conn)
+	g.engine = rules.NewEngine(time.Now().UnixNano())
+	g.resultDelay = DefaultResultDelay
+	g.countdownTick = DefaultCountdownTick
+	g.maxPlayers = MaxPlayers
+
+	// 牌局状态由事件日志重放得到，保证与日志一致
+	if len(g.Events) > 0 {
+		play, err := rules.Replay(g.Events)
+		if err != nil {
+			return nil, err
+		}
+		g.play = play
+	} else {
+		g.Events = make([]rules.Event, 0)
+	}
+
+	// 倒计时无法跨重启继续，回到等待状态
+	if g.State == GameStateStarting {
+		g.State = GameStateWaiting
+		g.Countdown = 0
+	}
+
+	// 快照可能在展示结果期间写入，这时一轮已经结束但还没开始下一轮，
+	// 按暂停处理，等玩家重连后继续
+	if g.State == GameStatePlaying && g.play != nil && !g.play.GameOver && g.play.RoundOver {
+		g.Paused = true
+	}
+
+	// 给玩家留出重连的时间
+	g.LastActivity = time.Now()
+
+	return g, nil
+}
+
+// snapshotPath 返回游戏快照文件的路径
+func (gm *GameManager) snapshotPath(gameID string) string {
+	return filepath.Join(gm.options.SnapshotDir, gameID+".json")
+}
+
+// SnapshotAll 将所有游戏的快照写入快照目录，并清理已移除游戏的快照
+func (gm *GameManager) SnapshotAll() error {
+	if gm.options.SnapshotDir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(gm.options.SnapshotDir, 0o755); err != nil {
+		return err
+	}
+
+	var errs []error
+	saved := make(map[string]bool)
+	for _, game := range gm.Games() {
+		data, err := game.Snapshot()
+		if err == nil {
+			err = writeFileAtomic(gm.snapshotPath(game.ID), data)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		saved[game.ID+".json"] = true
+	}
+
+	// 清理已经不存在的游戏的快照
+	entries, err := os.ReadDir(gm.options.SnapshotDir)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".json") && !saved[entry.Name()] {
+			os.Remove(filepath.Join(gm.options.SnapshotDir, entry.Name()))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// loadSnapshots 从快照目录恢复游戏
+func (gm *GameManager) loadSnapshots() {
+	entries, err := os.ReadDir(gm.options.SnapshotDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("读取快照目录失败", logging.KeyError, err)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(gm.options.SnapshotDir, entry.Name()))
+		if err != nil {
+			slog.Error("读取快照失败", "file", entry.Name(), logging.KeyError, err)
+			continue
+		}
+
+		game, err := RestoreGame(data)
+		if err != nil {
+			slog.Error("恢复快照失败", "file", entry.Name(), logging.KeyError, err)
+			continue
+		}
+
+		// 恢复的游戏与新建的游戏受同样的总数和创建者上限，已结束的游戏不再计入创建者
+		owners := game.Owners
+		if game.State == GameStateFinished {
+			owners = nil
+		}
+		if err := gm.addGame(game, owners); err != nil {
+			game.logger().Warn("跳过快照中的游戏", logging.KeyError, err)
+			continue
+		}
+		game.logger().Info("从快照恢复游戏", "state", game.State)
+	}
+}
+
+// StartSnapshotter 启动定期保存快照的后台任务
+func (gm *GameManager) StartSnapshotter() {
+	if gm.options.SnapshotDir == "" || gm.options.SnapshotInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(gm.options.SnapshotInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := gm.SnapshotAll(); err != nil {
+					slog.Error("保存快照失败", logging.KeyError, err)
+				}
+			case <-gm.stop:
+				return
+			}
+		}
+	}()
+}
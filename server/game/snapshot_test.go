@@ -0,0 +1,95 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"server/rules"
+)
+
+func TestRestoreCountsLimits(t *testing.T) {
+	dir := t.TempDir()
+
+	gm := NewGameManager(ManagerOptions{SnapshotDir: dir})
+	if _, err := gm.CreateGame(GameSettings{}, "ip:1.2.3.4", "user:a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gm.CreateGame(GameSettings{}, "ip:5.6.7.8"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gm.SnapshotAll(); err != nil {
+		t.Fatal(err)
+	}
+	gm.Stop()
+
+	// 恢复的游戏仍计入创建者的游戏数
+	restored := NewGameManager(ManagerOptions{SnapshotDir: dir, MaxGamesPerUser: 1, MaxGamesPerIP: 1})
+	defer restored.Stop()
+	if games := len(restored.Games()); games != 2 {
+		t.Fatalf("恢复了 %d 个游戏", games)
+	}
+	if _, err := restored.CreateGame(GameSettings{}, "ip:9.9.9.9", "user:a"); err != ErrTooManyGames {
+		t.Errorf("恢复后同一用户再创建: %v", err)
+	}
+	if _, err := restored.CreateGame(GameSettings{}, "ip:5.6.7.8"); err != ErrTooManyGames {
+		t.Errorf("恢复后同一IP再创建: %v", err)
+	}
+
+	// 恢复时不超过游戏总数
+	limited := NewGameManager(ManagerOptions{SnapshotDir: dir, MaxGames: 1})
+	defer limited.Stop()
+	if games := len(limited.Games()); games != 1 {
+		t.Errorf("游戏总数上限为1时恢复了 %d 个游戏", games)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	g := NewGame("g", GameSettings{Mode: rules.GameModeLives, StartingLives: 2})
+	g.engine = rules.NewEngine(1)
+	seatPlayers(g)
+	beginPlay(g)
+
+	// 出一张牌后停在等待质疑
+	g.mutex.Lock()
+	current := g.getCurrentPlayerID()
+	g.handlePlayCards(current, g.play.Players[current].Hand[:1])
+	g.mutex.Unlock()
+	if !g.play.AwaitingChallenge {
+		t.Fatal("出牌后应等待质疑")
+	}
+
+	data, err := g.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := RestoreGame(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.State != GameStatePlaying || restored.Paused {
+		t.Errorf("恢复后的状态: %s，暂停: %v", restored.State, restored.Paused)
+	}
+	if !reflect.DeepEqual(restored.PlayerOrder, g.PlayerOrder) {
+		t.Errorf("座位顺序: 期望 %v，实际 %v", g.PlayerOrder, restored.PlayerOrder)
+	}
+	if restored.getCurrentPlayerID() != g.getCurrentPlayerID() {
+		t.Errorf("当前玩家: 期望 %s，实际 %s", g.getCurrentPlayerID(), restored.getCurrentPlayerID())
+	}
+	if !restored.play.AwaitingChallenge || !reflect.DeepEqual(restored.play.LastPlay, g.play.LastPlay) {
+		t.Errorf("等待质疑的出牌没有恢复: %+v", restored.play.LastPlay)
+	}
+	for _, playerID := range g.PlayerOrder {
+		if want, got := g.play.Players[playerID], restored.play.Players[playerID]; !reflect.DeepEqual(want.Hand, got.Hand) || want.Lives != got.Lives {
+			t.Errorf("%s 的手牌或命数: 期望 %v/%d，实际 %v/%d", playerID, want.Hand, want.Lives, got.Hand, got.Lives)
+		}
+	}
+
+	// 恢复后可以继续质疑并打完
+	restored.mutex.Lock()
+	playToEnd(restored)
+	restored.mutex.Unlock()
+	if restored.State != GameStateFinished || restored.play.WinnerID == "" {
+		t.Errorf("恢复后没能打完: %s", restored.State)
+	}
+}
@@ -6,3 +6,5 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.3
 )
+
+require golang.org/x/text v0.24.0
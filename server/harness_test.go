@@ -0,0 +1,532 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"server/config"
+	"server/game"
+
+	"github.com/gorilla/websocket"
+)
+
+var update = flag.Bool("update", false, "用本次运行的消息记录更新 testdata 中的期望结果")
+
+// 测试服务器的管理员令牌
+const testAdminToken = "secret"
+
+// 等待消息的最长时间
+const waitTimeout = 10 * time.Second
+
+// testServer 在进程内启动的服务器，使用与 main 相同的路由
+type testServer struct {
+	t       *testing.T
+	server  *httptest.Server
+	manager *game.GameManager
+	clients []*fakeClient
+}
+
+// newTestServer 启动测试服务器：固定随机种子，不停顿、不回收、不保存快照
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	return newTestServerWithOptions(t, game.ManagerOptions{
+		CountdownTick: time.Millisecond,
+		Seed:          1,
+	})
+}
+
+// newTestServerWithOptions 按给定的管理器配置启动测试服务器
+func newTestServerWithOptions(t *testing.T, options game.ManagerOptions) *testServer {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.AdminToken = testAdminToken
+	return newTestServerWithConfig(t, cfg, options)
+}
+
+// newTestServerWithConfig 按给定的服务器配置和管理器配置启动测试服务器
+func newTestServerWithConfig(t *testing.T, cfg config.Config, options game.ManagerOptions) *testServer {
+	t.Helper()
+
+	manager := game.NewGameManager(options)
+	ts := &testServer{
+		t:       t,
+		server:  httptest.NewServer(newHandler(manager, cfg)),
+		manager: manager,
+	}
+	t.Cleanup(func() {
+		for _, c := range ts.clients {
+			c.close()
+		}
+		ts.server.Close()
+		manager.Stop()
+	})
+	return ts
+}
+
+// post 发送JSON请求，返回响应状态码和解析后的响应体
+func (ts *testServer) post(path string, body interface{}) (int, map[string]string) {
+	ts.t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		ts.t.Fatalf("编码请求失败: %v", err)
+	}
+	resp, err := http.Post(ts.server.URL+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		ts.t.Fatalf("请求 %s 失败: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	// 成功和失败的响应都是JSON
+	result := make(map[string]string)
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		ts.t.Fatalf("解析 %s 的响应失败: %d %v", path, resp.StatusCode, err)
+	}
+	return resp.StatusCode, result
+}
+
+// admin 以管理员身份发送请求，返回响应状态码和响应体
+func (ts *testServer) admin(method string, path string, body interface{}) (int, []byte) {
+	ts.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatalf("编码请求失败: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, ts.server.URL+path, reader)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return ts.do(req)
+}
+
+// do 发送请求，返回响应状态码和响应体，不跟随重定向
+func (ts *testServer) do(req *http.Request) (int, []byte) {
+	ts.t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		ts.t.Fatalf("请求 %s 失败: %v", req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ts.t.Fatalf("读取 %s 的响应失败: %v", req.URL.Path, err)
+	}
+	return resp.StatusCode, data
+}
+
+// scrape 读取 /metrics，校验每一行的格式，返回以 名字{标签} 为键的样本值
+func (ts *testServer) scrape() map[string]float64 {
+	ts.t.Helper()
+
+	resp, err := http.Get(ts.server.URL + "/metrics")
+	if err != nil {
+		ts.t.Fatalf("读取指标失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		ts.t.Fatalf("指标的内容类型: %s", contentType)
+	}
+
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		match := sampleLine.FindStringSubmatch(line)
+		if match == nil {
+			ts.t.Fatalf("无效的指标行: %q", line)
+		}
+		value, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			ts.t.Fatalf("无效的指标值: %q", line)
+		}
+		samples[match[1]] = value
+	}
+	return samples
+}
+
+// sampleLine 匹配文本格式中的一个样本：名字、可选的标签和值
+var sampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*(?:\{(?:[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\]|\\.)*",?)*\})?) (\S+)$`)
+
+// createGame 创建游戏，创建者入座成为房主并连接
+func (ts *testServer) createGame(hostName string, settings map[string]interface{}) (string, *fakeClient) {
+	ts.t.Helper()
+
+	body := map[string]interface{}{"playerName": hostName}
+	for key, value := range settings {
+		body[key] = value
+	}
+	status, result := ts.post("/api/games", body)
+	if status != http.StatusOK {
+		ts.t.Fatalf("创建游戏失败: %d", status)
+	}
+	return result["gameId"], ts.connect(result["gameId"], result["playerId"], hostName)
+}
+
+// join 加入游戏并连接
+func (ts *testServer) join(gameID string, name string) *fakeClient {
+	ts.t.Helper()
+
+	status, result := ts.post("/api/games/join", map[string]string{"gameId": gameID, "playerName": name})
+	if status != http.StatusOK {
+		ts.t.Fatalf("%s 加入游戏失败: %d", name, status)
+	}
+	return ts.connect(gameID, result["playerId"], name)
+}
+
+// connect 建立WebSocket连接，等到收到第一份游戏状态
+func (ts *testServer) connect(gameID string, playerID string, name string) *fakeClient {
+	ts.t.Helper()
+
+	c := ts.dial(gameID, playerID, name)
+	c.waitFor("第一份游戏状态", isType("game_state"))
+	return c
+}
+
+// dial 建立WebSocket连接并开始记录收到的消息
+func (ts *testServer) dial(gameID string, playerID string, name string) *fakeClient {
+	ts.t.Helper()
+
+	url := "ws" + strings.TrimPrefix(ts.server.URL, "http") + "/ws?gameId=" + gameID + "&playerId=" + playerID
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		ts.t.Fatalf("%s 连接失败: %v", name, err)
+	}
+
+	c := &fakeClient{
+		t:        ts.t,
+		name:     name,
+		playerID: playerID,
+		conn:     conn,
+	}
+	ts.clients = append(ts.clients, c)
+	go c.readLoop()
+
+	return c
+}
+
+// fakeClient 脚本化的WebSocket客户端，记录收到的每一条消息，
+// 轮到自己时按固定策略出牌或质疑
+type fakeClient struct {
+	t        *testing.T
+	name     string
+	playerID string
+	conn     *websocket.Conn
+	writeMu  sync.Mutex
+	stopped  bool // 测试已结束，不再发送消息
+
+	mu       sync.Mutex
+	raw      [][]byte                 // 收到的原始消息
+	messages []map[string]interface{} // 解析后的消息
+	cursor   int                      // waitFor 已经看过的消息数
+	prompt   map[string]interface{}   // 还没处理的出牌或质疑请求
+	closed   bool
+}
+
+// readLoop 读取消息直到连接断开
+func (c *fakeClient) readLoop() {
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.mu.Lock()
+			c.closed = true
+			c.mu.Unlock()
+			return
+		}
+
+		var message map[string]interface{}
+		if err := json.Unmarshal(data, &message); err != nil {
+			c.t.Errorf("%s 收到无效的消息: %s", c.name, data)
+			continue
+		}
+
+		c.mu.Lock()
+		c.raw = append(c.raw, data)
+		c.messages = append(c.messages, message)
+		c.mu.Unlock()
+
+		c.autoplay(message)
+	}
+}
+
+// autoplay 收到请求后记下，等同一次操作最后广播的游戏状态到达后再行动，以免用到过时的手牌
+func (c *fakeClient) autoplay(message map[string]interface{}) {
+	switch message["type"] {
+	case "your_turn", "challenge_request":
+		c.prompt = message
+
+	case "game_state":
+		if c.prompt == nil {
+			return
+		}
+		prompt := c.prompt
+		c.prompt = nil
+
+		state := message["state"].(map[string]interface{})
+		if prompt["type"] == "challenge_request" {
+			// 只对单张出牌质疑
+			c.send(map[string]interface{}{
+				"type":      "challenge",
+				"challenge": prompt["cardCount"] == float64(1),
+				"reason":    c.name + " 的判断",
+			})
+			return
+		}
+		c.send(map[string]interface{}{
+			"type":  "play_cards",
+			"cards": chooseCards(state, c.playerID),
+		})
+	}
+}
+
+// chooseCards 出牌策略：打出所有目标牌和大王（最多3张），没有时打出第一张牌
+func chooseCards(state map[string]interface{}, playerID string) []string {
+	targetCard := state["targetCard"].(string)
+	me := state["players"].(map[string]interface{})[playerID].(map[string]interface{})
+
+	hand := make([]string, 0)
+	for _, card := range me["hand"].([]interface{}) {
+		hand = append(hand, card.(string))
+	}
+
+	cards := make([]string, 0, 3)
+	for _, card := range hand {
+		if (card == targetCard || card == "Joker") && len(cards) < 3 {
+			cards = append(cards, card)
+		}
+	}
+	if len(cards) == 0 && len(hand) > 0 {
+		cards = append(cards, hand[0])
+	}
+	return cards
+}
+
+// send 发送一条消息
+func (c *fakeClient) send(message map[string]interface{}) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.stopped {
+		return
+	}
+	if err := c.conn.WriteJSON(message); err != nil {
+		c.t.Errorf("%s 发送消息失败: %v", c.name, err)
+	}
+}
+
+// close 停止发送并断开连接
+func (c *fakeClient) close() {
+	c.writeMu.Lock()
+	c.stopped = true
+	c.writeMu.Unlock()
+
+	c.conn.Close()
+}
+
+// waitFor 等待下一条满足条件的消息，跳过之前的消息
+func (c *fakeClient) waitFor(what string, match func(map[string]interface{}) bool) map[string]interface{} {
+	c.t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		for c.cursor < len(c.messages) {
+			message := c.messages[c.cursor]
+			c.cursor++
+			if match(message) {
+				c.mu.Unlock()
+				return message
+			}
+		}
+		closed := c.closed
+		c.mu.Unlock()
+
+		if closed {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	c.t.Fatalf("%s 没有等到%s", c.name, what)
+	return nil
+}
+
+// transcript 返回收到的原始消息的拷贝
+func (c *fakeClient) transcript() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([][]byte(nil), c.raw...)
+}
+
+// isType 匹配指定类型的消息
+func isType(messageType string) func(map[string]interface{}) bool {
+	return func(message map[string]interface{}) bool {
+		return message["type"] == messageType
+	}
+}
+
+// isState 匹配处于指定阶段的游戏状态
+func isState(state string) func(map[string]interface{}) bool {
+	return func(message map[string]interface{}) bool {
+		if message["type"] != "game_state" {
+			return false
+		}
+		return message["state"].(map[string]interface{})["state"] == state
+	}
+}
+
+// isReady 匹配玩家已准备的游戏状态
+func isReady(playerID string) func(map[string]interface{}) bool {
+	return func(message map[string]interface{}) bool {
+		if message["type"] != "game_state" {
+			return false
+		}
+		players := message["state"].(map[string]interface{})["players"].(map[string]interface{})
+		player, ok := players[playerID].(map[string]interface{})
+		return ok && player["ready"] == true
+	}
+}
+
+// readyAll 所有玩家依次准备，每位玩家等到自己的准备状态被广播后再继续
+func readyAll(clients ...*fakeClient) {
+	for _, c := range clients {
+		c.send(map[string]interface{}{"type": "ready", "ready": true})
+		c.waitFor("准备状态", isReady(c.playerID))
+	}
+}
+
+// waitGameOver 等待每位玩家收到游戏结束和结束后的游戏状态
+func waitGameOver(clients ...*fakeClient) {
+	for _, c := range clients {
+		c.waitFor("游戏结束", isType("game_over"))
+		c.waitFor("结束后的游戏状态", isState(game.GameStateFinished))
+	}
+}
+
+// assertNoHiddenInfo 检查玩家从未收到其他玩家的手牌和子弹位置，也没有看到别人打出的牌面
+func assertNoHiddenInfo(t *testing.T, clients ...*fakeClient) {
+	t.Helper()
+
+	for _, c := range clients {
+		for _, data := range c.transcript() {
+			var message interface{}
+			json.Unmarshal(data, &message)
+			if leak := findLeak(message, c.playerID); leak != "" {
+				t.Errorf("%s 收到了隐藏信息 %s: %s", c.name, leak, data)
+			}
+			if m := message.(map[string]interface{}); m["type"] == "play_action" {
+				if _, ok := m["playedCards"]; ok && m["playerName"] != c.name {
+					t.Errorf("%s 看到了别人打出的牌: %s", c.name, data)
+				}
+			}
+		}
+	}
+}
+
+// findLeak 在消息中查找不属于 playerID 的手牌或子弹位置，返回泄露的字段名
+func findLeak(value interface{}, playerID string) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range []string{"hand", "bulletPosition", "currentBulletPosition"} {
+			if _, ok := v[key]; ok && v["id"] != playerID {
+				return key
+			}
+		}
+		for _, child := range v {
+			if leak := findLeak(child, playerID); leak != "" {
+				return leak
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if leak := findLeak(child, playerID); leak != "" {
+				return leak
+			}
+		}
+	}
+	return ""
+}
+
+// assertTranscripts 将每位玩家收到的消息与 testdata 中的期望结果逐条比较
+// 游戏ID和玩家ID每次运行都不同，比较前替换为玩家名字
+func assertTranscripts(t *testing.T, gameID string, golden string, clients ...*fakeClient) {
+	t.Helper()
+
+	replacer := []string{gameID, "<game>"}
+	for _, c := range clients {
+		replacer = append(replacer, c.playerID, "<"+c.name+">")
+	}
+	normalize := strings.NewReplacer(replacer...)
+
+	var got bytes.Buffer
+	encoder := json.NewEncoder(&got)
+	encoder.SetEscapeHTML(false)
+	for _, c := range clients {
+		fmt.Fprintf(&got, "== %s\n", c.name)
+		for _, data := range c.transcript() {
+			// 重新编码使对象的键按字母顺序排列
+			var message interface{}
+			json.Unmarshal([]byte(normalize.Replace(string(data))), &message)
+			encoder.Encode(message)
+		}
+	}
+
+	path := filepath.Join("testdata", golden)
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取 %s 失败（使用 -update 生成）: %v", path, err)
+	}
+
+	gotLines := strings.Split(got.String(), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Fatalf("%s 第 %d 行不一致\n实际: %s\n期望: %s", path, i+1, g, w)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Package logging 配置结构化日志：统一的字段名、可选的输出格式和级别，
+// 以及对手牌、目标牌和子弹位置等秘密信息的脱敏
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// 日志中通用的字段名
+const (
+	KeyGameID   = "game_id"
+	KeyPlayerID = "player_id"
+	KeyRound    = "round"
+	KeyEvent    = "event"
+	KeyError    = "error"
+)
+
+// 秘密信息的字段名，非调试模式下会被脱敏
+const (
+	KeyHand       = "hand"
+	KeyHands      = "hands"
+	KeyCards      = "cards"
+	KeyDeck       = "deck"
+	KeyTargetCard = "target_card"
+	KeyBullet     = "bullet"
+	KeyChamber    = "chamber"
+)
+
+// 输出格式
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Redacted 脱敏后的字段值
+const Redacted = "[REDACTED]"
+
+// secretKeys 需要脱敏的字段
+var secretKeys = map[string]bool{
+	KeyHand:       true,
+	KeyHands:      true,
+	KeyCards:      true,
+	KeyDeck:       true,
+	KeyTargetCard: true,
+	KeyBullet:     true,
+	KeyChamber:    true,
+}
+
+// Options 日志配置
+type Options struct {
+	Format string     // text 或 json
+	Level  slog.Level // 最低输出级别
+	Debug  bool       // 调试模式，输出秘密信息
+}
+
+// New 按配置创建日志记录器
+func New(w io.Writer, options Options) (*slog.Logger, error) {
+	handlerOptions := &slog.HandlerOptions{Level: options.Level}
+	if !options.Debug {
+		handlerOptions.ReplaceAttr = redact
+	}
+
+	switch options.Format {
+	case FormatText, "":
+		return slog.New(slog.NewTextHandler(w, handlerOptions)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, handlerOptions)), nil
+	default:
+		return nil, fmt.Errorf("不支持的日志格式: %s", options.Format)
+	}
+}
+
+// redact 将秘密字段的值替换为 Redacted
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if secretKeys[a.Key] {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
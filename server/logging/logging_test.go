@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// TestRedact 非调试模式下秘密字段被脱敏，调试模式下原样输出
+func TestRedact(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		var buf bytes.Buffer
+		logger, err := New(&buf, Options{Format: FormatJSON, Level: slog.LevelDebug, Debug: debug})
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger.With(KeyGameID, "g1").WithGroup("ev").Debug("发牌",
+			KeyHands, map[string][]string{"p1": {"Q", "K"}},
+			KeyTargetCard, "A",
+			KeyBullet, 3,
+			KeyRound, 2,
+		)
+
+		var line map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+			t.Fatalf("无效的日志行 %s: %v", buf.String(), err)
+		}
+		if line[KeyGameID] != "g1" || line["msg"] != "发牌" {
+			t.Errorf("缺少字段: %s", buf.String())
+		}
+
+		ev := line["ev"].(map[string]interface{})
+		if ev[KeyRound] != float64(2) {
+			t.Errorf("普通字段不应脱敏: %s", buf.String())
+		}
+		redacted := ev[KeyTargetCard] == Redacted && ev[KeyBullet] == Redacted && ev[KeyHands] == Redacted
+		if redacted == debug {
+			t.Errorf("debug=%v: %s", debug, buf.String())
+		}
+		if !debug && strings.Contains(buf.String(), `"Q"`) {
+			t.Errorf("手牌泄露: %s", buf.String())
+		}
+	}
+}
+
+// TestFormat 只支持 text 和 json
+func TestFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{Format: FormatText, Level: slog.LevelWarn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("不输出")
+	logger.Warn("输出", KeyPlayerID, "p1")
+	if got := buf.String(); strings.Contains(got, "不输出") || !strings.Contains(got, "player_id=p1") {
+		t.Errorf("输出: %s", got)
+	}
+
+	if _, err := New(&buf, Options{Format: "xml"}); err == nil {
+		t.Error("不支持的格式应报错")
+	}
+}
@@ -1,68 +1,287 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"server/config"
 	"server/game"
+	"server/logging"
+	"server/metrics"
+	"server/web"
 	"syscall"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-var addr = flag.String("addr", ":8080", "服务地址")
+var defaults = config.Default()
 
-// 配置websocket
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	// 允许所有CORS请求
-	CheckOrigin: func(r *http.Request) bool { return true },
+var (
+	configPath       = flag.String("config", "", "JSON配置文件路径，环境变量 "+config.EnvPrefix+"* 覆盖文件，命令行参数覆盖两者")
+	printConfig      = flag.Bool("print-config", false, "输出生效的配置后退出")
+	addr             = flag.String("addr", defaults.Addr, "服务地址")
+	tlsCert          = flag.String("tls-cert", defaults.TLS.CertFile, "TLS证书文件，与 -tls-key 一起给出时提供 HTTPS/WSS")
+	tlsKey           = flag.String("tls-key", defaults.TLS.KeyFile, "TLS私钥文件")
+	tlsRedirectAddr  = flag.String("tls-redirect-addr", defaults.TLS.RedirectAddr, "在这个地址上把HTTP请求重定向到HTTPS，例如 :80，为空则不监听")
+	staticDir        = flag.String("static-dir", defaults.StaticDir, "开发时从磁盘读取网页客户端的目录（例如 web/static），为空则使用编译进二进制的文件")
+	waitingTTL       = flag.Duration("waiting-ttl", time.Duration(defaults.Games.WaitingTTL), "等待中的牌桌无人操作多久后回收")
+	abandonedTTL     = flag.Duration("abandoned-ttl", time.Duration(defaults.Games.AbandonedTTL), "进行中的游戏所有玩家断开多久后回收")
+	finishedTTL      = flag.Duration("finished-ttl", time.Duration(defaults.Games.FinishedTTL), "已结束的游戏保留多久")
+	janitorInterval  = flag.Duration("janitor-interval", time.Duration(defaults.Games.JanitorInterval), "游戏回收检查间隔，0表示不回收")
+	archiveDir       = flag.String("archive-dir", defaults.Storage.ArchiveDir, "游戏记录归档目录，为空则不归档")
+	snapshotDir      = flag.String("snapshot-dir", defaults.Storage.SnapshotDir, "游戏快照目录，为空则不保存快照")
+	snapshotInterval = flag.Duration("snapshot-interval", time.Duration(defaults.Storage.SnapshotInterval), "定期保存快照的间隔，0表示只在关闭时保存")
+	drainTimeout     = flag.Duration("drain-timeout", time.Duration(defaults.Games.DrainTimeout), "关闭时等待进行中的一轮结束的最长时间")
+	resultDelay      = flag.Duration("result-delay", time.Duration(defaults.Games.ResultDelay), "开枪和系统质疑后留给玩家查看结果的时间")
+	logFormat        = flag.String("log-format", defaults.Log.Format, "日志格式：text 或 json")
+	debug            = flag.Bool("debug", defaults.Log.Debug, "调试模式：日志中显示手牌、目标牌和子弹位置")
+	maxGames         = flag.Int("max-games", defaults.Games.MaxGames, "同时存在的游戏数上限，达到后不再接受新游戏且就绪检查失败，0表示不限")
+	maxPlayers       = flag.Int("max-players", defaults.Games.MaxPlayers, "每桌最多人数")
+	adminToken       = flag.String("admin-token", "", "管理接口和管理页面的令牌，为空则关闭管理功能（也可用环境变量 "+config.EnvPrefix+"ADMIN_TOKEN 设置）")
+	logLevel         slog.Level
+)
+
+func init() {
+	flag.TextVar(&logLevel, "log-level", defaults.Log.Level, "日志级别：debug、info、warn 或 error")
 }
 
-func main() {
-	flag.Parse()
+// HTTP接口的处理时间
+var httpDuration = metrics.NewHistogram("liarsbar_http_request_duration_seconds", "HTTP接口的处理时间", metrics.DefaultBuckets, "handler", "code")
 
-	// 创建游戏管理器
-	gameManager := game.NewGameManager()
+// loadConfig 加载配置文件和环境变量，再用命令行中明确给出的参数覆盖
+func loadConfig() (config.Config, error) {
+	cfg, err := config.Load(*configPath, os.LookupEnv)
+	if err != nil {
+		return cfg, err
+	}
 
-	// 设置HTTP路由
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		handleWebSocket(w, r, gameManager)
+	overrides := map[string]func(){
+		"addr":              func() { cfg.Addr = *addr },
+		"tls-cert":          func() { cfg.TLS.CertFile = *tlsCert },
+		"tls-key":           func() { cfg.TLS.KeyFile = *tlsKey },
+		"tls-redirect-addr": func() { cfg.TLS.RedirectAddr = *tlsRedirectAddr },
+		"static-dir":        func() { cfg.StaticDir = *staticDir },
+		"waiting-ttl":       func() { cfg.Games.WaitingTTL = config.Duration(*waitingTTL) },
+		"abandoned-ttl":     func() { cfg.Games.AbandonedTTL = config.Duration(*abandonedTTL) },
+		"finished-ttl":      func() { cfg.Games.FinishedTTL = config.Duration(*finishedTTL) },
+		"janitor-interval":  func() { cfg.Games.JanitorInterval = config.Duration(*janitorInterval) },
+		"archive-dir":       func() { cfg.Storage.ArchiveDir = *archiveDir },
+		"snapshot-dir":      func() { cfg.Storage.SnapshotDir = *snapshotDir },
+		"snapshot-interval": func() { cfg.Storage.SnapshotInterval = config.Duration(*snapshotInterval) },
+		"drain-timeout":     func() { cfg.Games.DrainTimeout = config.Duration(*drainTimeout) },
+		"result-delay":      func() { cfg.Games.ResultDelay = config.Duration(*resultDelay) },
+		"log-format":        func() { cfg.Log.Format = *logFormat },
+		"log-level":         func() { cfg.Log.Level = logLevel },
+		"debug":             func() { cfg.Log.Debug = *debug },
+		"max-games":         func() { cfg.Games.MaxGames = *maxGames },
+		"max-players":       func() { cfg.Games.MaxPlayers = *maxPlayers },
+		"admin-token":       func() { cfg.AdminToken = *adminToken },
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if override, ok := overrides[f.Name]; ok {
+			override()
+		}
 	})
 
-	// 设置API路由
-	http.HandleFunc("/api/games", gameManager.HandleCreateGame)
-	http.HandleFunc("/api/games/join", gameManager.HandleJoinGame)
+	return cfg, cfg.Validate()
+}
+
+func main() {
+	flag.Parse()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "配置无效:", err)
+		os.Exit(2)
+	}
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 配置结构化日志
+	logger, err := logging.New(os.Stderr, logging.Options{Format: cfg.Log.Format, Level: cfg.Log.Level, Debug: cfg.Log.Debug})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
 
-	// 设置静态文件服务
-	fs := http.FileServer(http.Dir("./static"))
-	http.Handle("/", fs)
+	// 创建游戏管理器
+	options := cfg.ManagerOptions()
+	if cfg.Storage.ArchiveDir != "" {
+		archiver, err := game.NewFileArchiver(cfg.Storage.ArchiveDir)
+		if err != nil {
+			slog.Error("创建归档目录失败", logging.KeyError, err)
+			os.Exit(1)
+		}
+		options.Archiver = archiver
+	}
+	profiles, err := game.NewProfileStore(cfg.Storage.ProfileDir)
+	if err != nil {
+		slog.Error("读取玩家战绩失败", logging.KeyError, err)
+		os.Exit(1)
+	}
+	options.Profiles = profiles
+	if cfg.IdentitySecret == "" {
+		slog.Warn("没有配置身份密钥，重启后玩家需要重新申请身份")
+	}
+	gameManager := game.NewGameManager(options)
+	gameManager.StartJanitor()
+	gameManager.StartSnapshotter()
 
 	// 启动HTTP服务器
-	server := &http.Server{Addr: *addr}
+	server := newServer(cfg, cfg.Addr, newHandler(gameManager, cfg))
+
+	// 把HTTP请求重定向到HTTPS
+	var redirectServer *http.Server
+	if cfg.TLS.RedirectAddr != "" {
+		redirectServer = newServer(cfg, cfg.TLS.RedirectAddr, redirectToHTTPS(cfg.Addr))
+		go func() {
+			slog.Info("HTTPS重定向启动", "addr", cfg.TLS.RedirectAddr)
+			if err := redirectServer.ListenAndServe(); err != http.ErrServerClosed {
+				slog.Error("HTTPS重定向启动失败", logging.KeyError, err)
+				os.Exit(1)
+			}
+		}()
+	}
 
 	// 优雅关闭
+	shutdownDone := make(chan struct{})
 	go func() {
 		sigint := make(chan os.Signal, 1)
 		signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
 		<-sigint
 		// 收到中断信号，关闭服务器
-		log.Println("关闭服务器...")
-		server.Close()
+		slog.Info("关闭服务器")
+		gameManager.Stop()
+
+		// 等待进行中的一轮结束，保存快照后断开所有玩家
+		gameManager.Drain(time.Duration(cfg.Games.DrainTimeout))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Error("关闭HTTP服务失败", logging.KeyError, err)
+		}
+		if redirectServer != nil {
+			redirectServer.Shutdown(ctx)
+		}
+		close(shutdownDone)
 	}()
 
 	// 启动服务器
-	log.Printf("服务器启动在 %s", *addr)
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
-		log.Fatalf("服务器启动失败: %v", err)
+	slog.Info("服务器启动", "addr", cfg.Addr, "tls", cfg.TLS.Enabled())
+	if cfg.TLS.Enabled() {
+		err = server.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	} else {
+		err = server.ListenAndServe()
 	}
+	if err != http.ErrServerClosed {
+		slog.Error("服务器启动失败", logging.KeyError, err)
+		os.Exit(1)
+	}
+	<-shutdownDone
+}
+
+// newServer 创建带超时设置的HTTP服务器
+func newServer(cfg config.Config, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(cfg.HTTP.ReadHeaderTimeout),
+		IdleTimeout:       time.Duration(cfg.HTTP.IdleTimeout),
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// redirectToHTTPS 把请求永久重定向到 httpsAddr 端口上的同一地址
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// newHandler 设置HTTP路由
+func newHandler(gameManager *game.GameManager, cfg config.Config) http.Handler {
+	mux := http.NewServeMux()
+
+	// 配置websocket
+	upgrader := &websocket.Upgrader{
+		ReadBufferSize:  cfg.WebSocket.ReadBufferSize,
+		WriteBufferSize: cfg.WebSocket.WriteBufferSize,
+		CheckOrigin: func(r *http.Request) bool {
+			return cfg.WebSocket.AllowOrigin(r.Header.Get("Origin"))
+		},
+	}
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		handleWebSocket(w, r, upgrader, int64(cfg.WebSocket.MaxMessageSize), gameManager)
+	})
+
+	// 设置API路由
+	mux.HandleFunc("/api/games", metrics.InstrumentHandler(httpDuration, "create_game", gameManager.HandleCreateGame))
+	mux.HandleFunc("/api/games/join", metrics.InstrumentHandler(httpDuration, "join_game", gameManager.HandleJoinGame))
+	mux.HandleFunc("POST /api/identity", metrics.InstrumentHandler(httpDuration, "identity", gameManager.HandleIdentity))
+	mux.HandleFunc("GET /api/players/{id}/stats", metrics.InstrumentHandler(httpDuration, "player_stats", gameManager.HandlePlayerStats))
+
+	// 管理接口和管理页面
+	admin := gameManager.AdminHandler(cfg.AdminToken)
+	mux.Handle("/api/admin/", admin)
+	mux.Handle("/admin", admin)
+
+	// 负载均衡使用的存活和就绪检查
+	mux.HandleFunc("/healthz", gameManager.HandleHealthz)
+	mux.HandleFunc("/readyz", gameManager.HandleReadyz)
+
+	// 需要管理员令牌的调试接口
+	mux.Handle("/debug/", game.RequireAdmin(cfg.AdminToken, newDebugHandler(gameManager)))
+
+	// 以 Prometheus 文本格式导出指标
+	registry := metrics.NewRegistry()
+	gameManager.RegisterMetrics(registry)
+	registry.Register(httpDuration)
+	mux.Handle("/metrics", registry)
+
+	// 网页客户端，默认使用编译进二进制的文件
+	mux.Handle("/", web.NewHandler(cfg.StaticDir))
+
+	return mux
+}
+
+// newDebugHandler 设置调试路由：pprof 以及游戏数和每个游戏的 goroutine 数
+func newDebugHandler(gameManager *game.GameManager) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/games", gameManager.HandleDebugGames)
+
+	return mux
 }
 
 // 处理WebSocket连接
-func handleWebSocket(w http.ResponseWriter, r *http.Request, gameManager *game.GameManager) {
+func handleWebSocket(w http.ResponseWriter, r *http.Request, upgrader *websocket.Upgrader, readLimit int64, gameManager *game.GameManager) {
 	// 从查询参数获取游戏ID和玩家ID
 	gameID := r.URL.Query().Get("gameId")
 	playerID := r.URL.Query().Get("playerId")
@@ -75,14 +294,17 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request, gameManager *game.G
 	// 升级HTTP连接为WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket升级失败: %v", err)
+		slog.Warn("WebSocket升级失败", logging.KeyGameID, gameID, logging.KeyPlayerID, playerID, logging.KeyError, err)
 		return
 	}
 
+	// 超过上限的消息会使读取失败并断开连接
+	conn.SetReadLimit(readLimit)
+
 	// 将玩家添加到游戏
-	game := gameManager.GetGame(gameID)
-	if game == nil {
-		conn.WriteJSON(map[string]interface{}{
+	g := gameManager.GetGame(gameID)
+	if g == nil {
+		game.WriteMessage(conn, map[string]interface{}{
 			"type":    "error",
 			"message": "游戏不存在",
 		})
@@ -91,5 +313,5 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request, gameManager *game.G
 	}
 
 	// 将玩家连接到游戏
-	game.ConnectPlayer(playerID, conn)
+	g.ConnectPlayer(playerID, conn)
 }
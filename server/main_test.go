@@ -0,0 +1,913 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"server/config"
+	"server/game"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestSuddenDeathGame 三名玩家准备后由房主开始，完整地打完一局中弹即出局的游戏
+func TestSuddenDeathGame(t *testing.T) {
+	ts := newTestServer(t)
+
+	gameID, alice := ts.createGame("alice", nil)
+	bob := ts.join(gameID, "bob")
+	carol := ts.join(gameID, "carol")
+	clients := []*fakeClient{alice, bob, carol}
+
+	readyAll(clients...)
+	alice.send(map[string]interface{}{"type": "start_game"})
+	waitGameOver(clients...)
+
+	assertNoHiddenInfo(t, clients...)
+	assertTranscripts(t, gameID, "sudden_death.golden", clients...)
+}
+
+// TestLivesGame 四名玩家满员后自动开始，打完一局有轮数限制的生命模式游戏
+func TestLivesGame(t *testing.T) {
+	ts := newTestServer(t)
+
+	gameID, alice := ts.createGame("alice", map[string]interface{}{
+		"mode":          "lives",
+		"startingLives": 2,
+		"maxRounds":     4,
+	})
+	bob := ts.join(gameID, "bob")
+	carol := ts.join(gameID, "carol")
+	dave := ts.join(gameID, "dave")
+	clients := []*fakeClient{alice, bob, carol, dave}
+
+	readyAll(clients...)
+	waitGameOver(clients...)
+
+	assertNoHiddenInfo(t, clients...)
+	assertTranscripts(t, gameID, "lives.golden", clients...)
+}
+
+// TestRematchSeries 三局两胜的系列赛，第一局结束后所有玩家同意再来一局
+func TestRematchSeries(t *testing.T) {
+	ts := newTestServer(t)
+
+	gameID, alice := ts.createGame("alice", map[string]interface{}{"bestOf": 3})
+	bob := ts.join(gameID, "bob")
+	clients := []*fakeClient{alice, bob}
+
+	readyAll(clients...)
+	alice.send(map[string]interface{}{"type": "start_game"})
+	waitGameOver(clients...)
+
+	for _, c := range clients {
+		c.send(map[string]interface{}{"type": "rematch", "accept": true})
+		c.waitFor("再来一局的表态", isType("rematch_status"))
+	}
+	for _, c := range clients {
+		c.waitFor("第二局开始", isState(game.GameStatePlaying))
+	}
+	waitGameOver(clients...)
+
+	assertNoHiddenInfo(t, clients...)
+	assertTranscripts(t, gameID, "rematch.golden", clients...)
+}
+
+// TestLeaveThenRematch 房主在游戏中离开后房主转给下一位玩家，剩下的玩家打完后可以再来一局
+func TestLeaveThenRematch(t *testing.T) {
+	ts := newTestServer(t)
+
+	gameID, alice := ts.createGame("alice", nil)
+	bob := ts.join(gameID, "bob")
+	carol := ts.join(gameID, "carol")
+
+	readyAll(alice, bob, carol)
+	alice.send(map[string]interface{}{"type": "start_game"})
+	alice.waitFor("游戏开始", isState(game.GameStatePlaying))
+
+	alice.send(map[string]interface{}{"type": "leave_game"})
+	alice.waitFor("离开确认", isType("left_game"))
+	host := bob.waitFor("房主转让", isType("host_changed"))
+	if host["hostId"] != bob.playerID {
+		t.Errorf("房主应转给 bob: %v", host)
+	}
+	waitGameOver(bob, carol)
+
+	// 离开的玩家不能再连回来
+	stranger := ts.dial(gameID, alice.playerID, "alice")
+	stranger.waitFor("错误消息", isType("error"))
+
+	for _, c := range []*fakeClient{bob, carol} {
+		c.send(map[string]interface{}{"type": "rematch", "accept": true})
+		c.waitFor("再来一局的表态", isType("rematch_status"))
+	}
+	for _, c := range []*fakeClient{bob, carol} {
+		c.waitFor("第二局开始", isState(game.GameStatePlaying))
+	}
+	waitGameOver(bob, carol)
+}
+
+// TestJoinRejected 房主开始时自动准备，游戏开始后不能再加入，连接不存在的游戏会收到错误
+func TestJoinRejected(t *testing.T) {
+	ts := newTestServer(t)
+
+	gameID, alice := ts.createGame("alice", nil)
+	bob := ts.join(gameID, "bob")
+
+	// 其他玩家未准备时不能开始，房主要求开始即视为已准备
+	alice.send(map[string]interface{}{"type": "start_game"})
+	alice.waitFor("未准备提醒", func(m map[string]interface{}) bool {
+		return m["type"] == "error" && m["message"] == "还有玩家未准备"
+	})
+	bob.waitFor("房主已准备", isReady(alice.playerID))
+	readyAll(bob)
+	alice.send(map[string]interface{}{"type": "start_game"})
+	alice.waitFor("游戏开始", isState(game.GameStatePlaying))
+
+	// 加入失败时返回JSON格式的错误代码
+	if status, body := ts.post("/api/games/join", map[string]string{"gameId": gameID, "playerName": "carol"}); status != http.StatusBadRequest || body["code"] != game.ErrorGameStarted {
+		t.Errorf("游戏开始后加入应被拒绝，实际 %d %v", status, body)
+	}
+	if status, body := ts.post("/api/games/join", map[string]string{"gameId": "missing", "playerName": "carol"}); status != http.StatusNotFound || body["code"] != game.ErrorGameNotFound {
+		t.Errorf("加入不存在的游戏应返回404，实际 %d %v", status, body)
+	}
+
+	stranger := ts.dial(gameID, "stranger", "stranger")
+	stranger.waitFor("错误消息", isType("error"))
+	missing := ts.dial("missing", "stranger", "stranger")
+	missing.waitFor("错误消息", isType("error"))
+}
+
+// TestHostControls 只有房主可以踢人、转让房主和修改规则，房主不能转让给离线或已离开的玩家
+func TestHostControls(t *testing.T) {
+	ts := newTestServerWithOptions(t, game.ManagerOptions{
+		CountdownTick: time.Millisecond,
+		ResultDelay:   300 * time.Millisecond,
+		Seed:          1,
+	})
+
+	gameID, alice := ts.createGame("alice", map[string]interface{}{"mode": "lives", "startingLives": 3})
+	bob := ts.join(gameID, "bob")
+	carol := ts.join(gameID, "carol")
+
+	// dave 入座但没有连接
+	_, dave := ts.post("/api/games/join", map[string]string{"gameId": gameID, "playerName": "dave"})
+
+	expectError := func(c *fakeClient, message map[string]interface{}, want string) {
+		t.Helper()
+		c.send(message)
+		if got := c.waitFor("错误消息", isType("error"))["message"]; got != want {
+			t.Errorf("%s 发送 %v: 期望错误 %q，实际 %q", c.name, message["type"], want, got)
+		}
+	}
+
+	expectError(bob, map[string]interface{}{"type": "kick_player", "playerId": carol.playerID}, "只有房主可以踢出玩家")
+	expectError(bob, map[string]interface{}{"type": "transfer_host", "playerId": bob.playerID}, "只有房主可以转让房主")
+	expectError(bob, map[string]interface{}{"type": "update_settings", "settings": map[string]interface{}{"startingLives": 1}}, "只有房主可以修改规则")
+	expectError(alice, map[string]interface{}{"type": "transfer_host", "playerId": dave["playerId"]}, "玩家不在线")
+
+	alice.send(map[string]interface{}{"type": "kick_player", "playerId": dave["playerId"]})
+	alice.waitFor("踢出玩家", isType("player_kicked"))
+
+	readyAll(alice, bob, carol)
+	alice.send(map[string]interface{}{"type": "start_game"})
+	alice.waitFor("游戏开始", isState(game.GameStatePlaying))
+
+	// 进行中离开的玩家座位保留到本局结束，但不能成为房主
+	carol.send(map[string]interface{}{"type": "leave_game"})
+	carol.waitFor("离开确认", isType("left_game"))
+	expectError(alice, map[string]interface{}{"type": "transfer_host", "playerId": carol.playerID}, "玩家已经离开")
+
+	alice.send(map[string]interface{}{"type": "transfer_host", "playerId": bob.playerID})
+	if host := bob.waitFor("房主转让", isType("host_changed")); host["hostId"] != bob.playerID {
+		t.Errorf("房主应转给 bob: %v", host)
+	}
+	expectError(alice, map[string]interface{}{"type": "kick_player", "playerId": bob.playerID}, "只有房主可以踢出玩家")
+}
+
+// TestMetrics 打完一局后 /metrics 反映游戏数、连接数、消息、质疑、开枪和接口延迟
+func TestMetrics(t *testing.T) {
+	ts := newTestServer(t)
+
+	gameID, alice := ts.createGame("alice", nil)
+	bob := ts.join(gameID, "bob")
+	ts.post("/api/games/join", map[string]string{"gameId": "missing", "playerName": "carol"})
+
+	readyAll(alice, bob)
+	alice.send(map[string]interface{}{"type": "no_such_type"})
+	alice.send(map[string]interface{}{"type": "start_game"})
+	waitGameOver(alice, bob)
+
+	samples := ts.scrape()
+	exact := map[string]float64{
+		`liarsbar_games{state="waiting"}`:  0,
+		`liarsbar_games{state="playing"}`:  0,
+		`liarsbar_games{state="finished"}`: 1,
+		`liarsbar_websocket_connections`:   2,
+	}
+	for key, want := range exact {
+		if got, ok := samples[key]; !ok || got != want {
+			t.Errorf("%s: 期望 %v，实际 %v", key, want, got)
+		}
+	}
+
+	// 计数器在同一进程的测试之间累计，只检查下限
+	atLeast := map[string]float64{
+		`liarsbar_messages_received_total{type="ready"}`:                                            2,
+		`liarsbar_messages_received_total{type="unknown"}`:                                          1,
+		`liarsbar_messages_sent_total{type="game_over"}`:                                            2,
+		`liarsbar_shots_fired_total{result="hit"}`:                                                  1,
+		`liarsbar_eliminations_total{reason="shot"}`:                                                1,
+		`liarsbar_game_duration_seconds_count{mode="sudden_death"}`:                                 1,
+		`liarsbar_http_request_duration_seconds_count{handler="create_game",code="200"}`:            1,
+		`liarsbar_http_request_duration_seconds_count{handler="join_game",code="200"}`:              1,
+		`liarsbar_http_request_duration_seconds_count{handler="join_game",code="404"}`:              1,
+		`liarsbar_http_request_duration_seconds_bucket{handler="create_game",code="200",le="+Inf"}`: 1,
+	}
+	for key, want := range atLeast {
+		if got := samples[key]; got < want {
+			t.Errorf("%s: 期望至少 %v，实际 %v", key, want, got)
+		}
+	}
+
+	challenges := 0.0
+	for key, value := range samples {
+		if strings.HasPrefix(key, "liarsbar_challenges_total{") {
+			challenges += value
+		}
+	}
+	if challenges < 1 {
+		t.Error("没有统计到质疑")
+	}
+}
+
+// TestResultDelay 开枪后展示结果期间不占用游戏锁，/metrics 照常响应，游戏随后继续打完
+func TestResultDelay(t *testing.T) {
+	const resultDelay = 500 * time.Millisecond
+	ts := newTestServerWithOptions(t, game.ManagerOptions{
+		CountdownTick: time.Millisecond,
+		ResultDelay:   resultDelay,
+		Seed:          1,
+	})
+
+	gameID, alice := ts.createGame("alice", nil)
+	bob := ts.join(gameID, "bob")
+
+	readyAll(alice, bob)
+	alice.send(map[string]interface{}{"type": "start_game"})
+	alice.waitFor("开枪结果", isType("shooting_result"))
+
+	started := time.Now()
+	ts.scrape()
+	if elapsed := time.Since(started); elapsed >= resultDelay/2 {
+		t.Errorf("展示结果期间 /metrics 被阻塞了 %v", elapsed)
+	}
+
+	waitGameOver(alice, bob)
+}
+
+// TestAdmin 管理员查看游戏、广播系统消息、在游戏中踢出玩家并强制结束游戏
+func TestAdmin(t *testing.T) {
+	ts := newTestServer(t)
+
+	gameID, alice := ts.createGame("alice", map[string]interface{}{"mode": "lives", "startingLives": 3})
+	bob := ts.join(gameID, "bob")
+	carol := ts.join(gameID, "carol")
+
+	// 没有令牌或令牌错误时拒绝，浏览器缓存的 Basic 密码不能用于接口
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:"+testAdminToken))
+	for _, header := range []string{"", "Bearer wrong", basic} {
+		req, _ := http.NewRequest(http.MethodPost, ts.server.URL+"/api/admin/games/"+gameID+"/end", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		if status, _ := ts.do(req); status != http.StatusUnauthorized {
+			t.Errorf("令牌 %q: 期望401，实际 %d", header, status)
+		}
+	}
+
+	var games []game.AdminGame
+	status, body := ts.admin(http.MethodGet, "/api/admin/games", nil)
+	if err := json.Unmarshal(body, &games); status != http.StatusOK || err != nil {
+		t.Fatalf("列出游戏: %d %s", status, body)
+	}
+	if len(games) != 1 || games[0].ID != gameID || len(games[0].Seats) != 3 || !games[0].Seats[2].Connected {
+		t.Errorf("游戏列表: %s", body)
+	}
+
+	readyAll(alice, bob, carol)
+	alice.send(map[string]interface{}{"type": "start_game"})
+	alice.waitFor("游戏开始", isState(game.GameStatePlaying))
+
+	// 完整状态包括所有玩家的手牌
+	var state game.AdminGameState
+	status, body = ts.admin(http.MethodGet, "/api/admin/games/"+gameID, nil)
+	if err := json.Unmarshal(body, &state); status != http.StatusOK || err != nil || state.Play == nil {
+		t.Fatalf("查看游戏: %d %s", status, body)
+	}
+	if hand := state.Play.Players[bob.playerID].Hand; len(hand) == 0 {
+		t.Errorf("完整状态中没有 bob 的手牌: %s", body)
+	}
+
+	// 广播系统消息
+	status, body = ts.admin(http.MethodPost, "/api/admin/broadcast", map[string]string{"gameId": gameID, "message": "维护通知"})
+	if status != http.StatusOK || !strings.Contains(string(body), `"games":1`) {
+		t.Errorf("广播: %d %s", status, body)
+	}
+	for _, c := range []*fakeClient{alice, bob, carol} {
+		c.waitFor("系统消息", func(m map[string]interface{}) bool {
+			return m["type"] == "system_message" && m["message"] == "维护通知"
+		})
+	}
+
+	// 游戏中踢出玩家视为认输，剩下的玩家继续打完
+	if status, body := ts.admin(http.MethodPost, "/api/admin/games/"+gameID+"/kick", map[string]string{"playerId": carol.playerID}); status != http.StatusNoContent {
+		t.Fatalf("踢出玩家: %d %s", status, body)
+	}
+	carol.waitFor("被踢出", isType("kicked"))
+	bob.waitFor("玩家被踢出", isType("player_kicked"))
+	waitGameOver(alice, bob)
+
+	// 强制结束后游戏被移除
+	if status, body := ts.admin(http.MethodPost, "/api/admin/games/"+gameID+"/end", nil); status != http.StatusNoContent {
+		t.Fatalf("结束游戏: %d %s", status, body)
+	}
+	alice.waitFor("游戏关闭", isType("game_closed"))
+	if status, _ := ts.admin(http.MethodGet, "/api/admin/games/"+gameID, nil); status != http.StatusNotFound {
+		t.Errorf("结束后查看游戏: 期望404，实际 %d", status)
+	}
+	if status, _ := ts.admin(http.MethodPost, "/api/admin/games/"+gameID+"/end", nil); status != http.StatusNotFound {
+		t.Errorf("重复结束游戏: 期望404，实际 %d", status)
+	}
+}
+
+// TestAdminPage 管理页面需要 Basic 认证，表单只接受来自本站的提交
+func TestAdminPage(t *testing.T) {
+	ts := newTestServer(t)
+	gameID, _ := ts.createGame("alice's", nil)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.server.URL+"/admin?game="+gameID, nil)
+	if status, _ := ts.do(req); status != http.StatusUnauthorized {
+		t.Errorf("未认证: 期望401，实际 %d", status)
+	}
+
+	req.SetBasicAuth("admin", testAdminToken)
+	status, body := ts.do(req)
+	if status != http.StatusOK || !strings.Contains(string(body), gameID) || !strings.Contains(string(body), "alice&#39;s") {
+		t.Errorf("管理页面: %d %s", status, body)
+	}
+
+	form := func(origin string) int {
+		req, _ := http.NewRequest(http.MethodPost, ts.server.URL+"/admin", strings.NewReader("action=delete&gameId="+gameID))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("admin", testAdminToken)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		status, _ := ts.do(req)
+		return status
+	}
+	if status := form(""); status != http.StatusForbidden {
+		t.Errorf("没有来源的表单: 期望403，实际 %d", status)
+	}
+	if status := form("http://evil.example"); status != http.StatusForbidden {
+		t.Errorf("跨站表单: 期望403，实际 %d", status)
+	}
+	if status := form(ts.server.URL); status != http.StatusSeeOther {
+		t.Errorf("本站表单: 期望303，实际 %d", status)
+	}
+	if ts.manager.GetGame(gameID) != nil {
+		t.Error("游戏没有被移除")
+	}
+}
+
+// TestAdminDisabled 没有配置令牌时管理功能关闭
+func TestAdminDisabled(t *testing.T) {
+	manager := game.NewGameManager(game.ManagerOptions{})
+	server := httptest.NewServer(newHandler(manager, config.Default()))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/admin/games", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("期望404，实际 %d", resp.StatusCode)
+	}
+}
+
+// TestHealth 就绪检查在游戏数达到上限和关闭时失败，存活检查始终成功
+func TestHealth(t *testing.T) {
+	ts := newTestServerWithOptions(t, game.ManagerOptions{CountdownTick: time.Millisecond, Seed: 1, MaxGames: 1})
+
+	get := func(path string) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, ts.server.URL+path, nil)
+		status, body := ts.do(req)
+		return status, string(body)
+	}
+
+	if status, _ := get("/readyz"); status != http.StatusOK {
+		t.Errorf("空闲时就绪检查: %d", status)
+	}
+
+	gameID, _ := ts.createGame("alice", nil)
+	if status, body := get("/readyz"); status != http.StatusServiceUnavailable || !strings.Contains(body, "上限") {
+		t.Errorf("达到上限时就绪检查: %d %s", status, body)
+	}
+	if status, _ := ts.post("/api/games", map[string]string{"playerName": "bob"}); status != http.StatusServiceUnavailable {
+		t.Errorf("达到上限时创建游戏: 期望503，实际 %d", status)
+	}
+
+	// 调试接口需要管理员令牌
+	if status, _ := get("/debug/games"); status != http.StatusUnauthorized {
+		t.Errorf("未认证的调试接口: 期望401，实际 %d", status)
+	}
+	var info game.DebugInfo
+	status, body := ts.admin(http.MethodGet, "/debug/games", nil)
+	if err := json.Unmarshal(body, &info); status != http.StatusOK || err != nil {
+		t.Fatalf("调试信息: %d %s", status, body)
+	}
+	if info.Games != 1 || info.MaxGames != 1 || info.GameGoroutines[gameID] != 1 || info.Goroutines == 0 {
+		t.Errorf("调试信息: %s", body)
+	}
+	if status, body := ts.admin(http.MethodGet, "/debug/pprof/", nil); status != http.StatusOK || !strings.Contains(string(body), "goroutine") {
+		t.Errorf("pprof: %d", status)
+	}
+
+	ts.manager.Drain(0)
+	if status, body := get("/readyz"); status != http.StatusServiceUnavailable || !strings.Contains(body, "关闭") {
+		t.Errorf("关闭时就绪检查: %d %s", status, body)
+	}
+	if status, _ := get("/healthz"); status != http.StatusOK {
+		t.Errorf("存活检查: %d", status)
+	}
+}
+
+// TestDrainResume 平滑关闭等进行中的一轮打完后暂停并保存快照，重启恢复后玩家重连即可继续打完
+func TestDrainResume(t *testing.T) {
+	dir := t.TempDir()
+	ts := newTestServerWithOptions(t, game.ManagerOptions{
+		CountdownTick: time.Millisecond,
+		ResultDelay:   200 * time.Millisecond,
+		SnapshotDir:   dir,
+		Seed:          1,
+	})
+
+	gameID, alice := ts.createGame("alice", map[string]interface{}{"mode": "lives", "startingLives": 3})
+	bob := ts.join(gameID, "bob")
+	readyAll(alice, bob)
+	alice.send(map[string]interface{}{"type": "start_game"})
+	alice.waitFor("第一次出牌", isType("play_action"))
+
+	ts.manager.Drain(10 * time.Second)
+
+	alice.waitFor("这一轮结束后游戏暂停", isType("game_paused"))
+	alice.waitFor("游戏关闭", isType("game_closed"))
+	if _, err := os.Stat(filepath.Join(dir, gameID+".json")); err != nil {
+		t.Fatalf("关闭时没有保存快照: %v", err)
+	}
+
+	// 重启后从快照恢复，游戏仍处于暂停状态
+	restarted := newTestServerWithOptions(t, game.ManagerOptions{
+		CountdownTick: time.Millisecond,
+		SnapshotDir:   dir,
+		Seed:          1,
+	})
+	if restarted.manager.GetGame(gameID) == nil {
+		t.Fatal("重启后没有恢复游戏")
+	}
+
+	aliceAgain := restarted.dial(gameID, alice.playerID, "alice")
+	state := aliceAgain.waitFor("恢复后的游戏状态", isType("game_state"))["state"].(map[string]interface{})
+	if state["state"] != "playing" || state["paused"] != true {
+		t.Errorf("恢复后的游戏状态: %v，暂停: %v", state["state"], state["paused"])
+	}
+
+	// 玩家重连后开始下一轮并打完
+	bobAgain := restarted.connect(gameID, bob.playerID, "bob")
+	waitGameOver(aliceAgain, bobAgain)
+}
+
+// TestConfig 服务器按配置限制 Origin、每桌人数并使用默认规则
+func TestConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.WebSocket.AllowedOrigins = []string{"https://liarsbar.example"}
+	cfg.Games.MaxPlayers = 2
+	cfg.Rules.Defaults = game.GameSettings{Mode: "lives", StartingLives: 2}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	options := cfg.ManagerOptions()
+	options.SnapshotDir = ""
+	options.JanitorInterval = 0
+	ts := newTestServerWithConfig(t, cfg, options)
+
+	// 请求中没有给出的规则取配置中的默认规则
+	gameID, _ := ts.createGame("alice", nil)
+	if settings := ts.manager.GetGame(gameID).Settings; settings.Mode != "lives" || settings.StartingLives != 2 {
+		t.Errorf("默认规则: %+v", settings)
+	}
+
+	// 每桌最多2人
+	ts.join(gameID, "bob")
+	if status, _ := ts.post("/api/games/join", map[string]string{"gameId": gameID, "playerName": "carol"}); status != http.StatusBadRequest {
+		t.Errorf("满员后加入: 期望400，实际 %d", status)
+	}
+
+	// 不在允许列表中的 Origin 不能建立连接
+	url := "ws" + strings.TrimPrefix(ts.server.URL, "http") + "/ws?gameId=" + gameID + "&playerId=x"
+	for origin, ok := range map[string]bool{"https://liarsbar.example": true, "https://evil.example": false} {
+		conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {origin}})
+		if ok != (err == nil) {
+			t.Errorf("Origin %s: 错误 %v", origin, err)
+		}
+		if err == nil {
+			conn.Close()
+		} else if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Origin %s: 期望403，实际 %d", origin, resp.StatusCode)
+		}
+	}
+}
+
+// TestHardening 超长的WebSocket消息断开连接，静态文件带安全响应头，HTTP请求重定向到HTTPS
+func TestHardening(t *testing.T) {
+	cfg := config.Default()
+	cfg.WebSocket.MaxMessageSize = 512
+	ts := newTestServerWithConfig(t, cfg, game.ManagerOptions{})
+
+	gameID, alice := ts.createGame("alice", nil)
+	bob := ts.join(gameID, "bob")
+	bob.send(map[string]interface{}{"type": "ready", "padding": strings.Repeat("骗", 1024)})
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		bob.mu.Lock()
+		closed := bob.closed
+		bob.mu.Unlock()
+		if closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("超长消息没有断开连接")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	alice.send(map[string]interface{}{"type": "ready"})
+	alice.waitFor("准备后的游戏状态", isType("game_state"))
+
+	resp, err := http.Get(ts.server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Content-Security-Policy") == "" || resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("静态文件缺少安全响应头: %v", resp.Header)
+	}
+
+	for _, tt := range []struct{ httpsAddr, host, want string }{
+		{":443", "liarsbar.example", "https://liarsbar.example/join?id=1"},
+		{":443", "liarsbar.example:80", "https://liarsbar.example/join?id=1"},
+		{":8443", "liarsbar.example:8080", "https://liarsbar.example:8443/join?id=1"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://"+tt.host+"/join?id=1", nil)
+		w := httptest.NewRecorder()
+		redirectToHTTPS(tt.httpsAddr).ServeHTTP(w, req)
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != tt.want {
+			t.Errorf("%s 重定向到 %d %s，应为 %s", tt.host, w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+}
+
+// TestRateLimit 创建和加入游戏按IP和用户限流，每个用户和每个IP同时创建的游戏数有上限，刷消息的连接被断开
+func TestRateLimit(t *testing.T) {
+	identities := game.NewIdentityKey("secret")
+	ts := newTestServerWithOptions(t, game.ManagerOptions{
+		CreateLimit:     game.RateLimit{Rate: 0.001, Burst: 4},
+		JoinLimit:       game.RateLimit{Rate: 0.001, Burst: 2},
+		MessageLimit:    game.RateLimit{Rate: 0.001, Burst: 5},
+		MaxGamesPerUser: 1,
+		MaxGamesPerIP:   2,
+		Identities:      identities,
+	})
+	alice, bob, carol, dave := identities.Issue(), identities.Issue(), identities.Issue(), identities.Issue()
+	// 计数器在同一进程的测试之间累计，只检查增量
+	limitedBefore := ts.scrape()[`liarsbar_rate_limited_total{scope="create_game",by="ip"}`]
+
+	create := func(token string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, ts.server.URL+"/api/games", strings.NewReader(`{"playerName":"alice"}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// 同一用户只能有一个未结束的游戏
+	if resp := create(alice); resp.StatusCode != http.StatusOK {
+		t.Fatalf("创建游戏: %d", resp.StatusCode)
+	}
+	if resp := create(alice); resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("超过用户游戏数上限: %d Retry-After=%q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// 换一个令牌仍受同一IP的游戏数上限
+	if resp := create(bob); resp.StatusCode != http.StatusOK {
+		t.Fatalf("其他用户创建游戏: %d", resp.StatusCode)
+	}
+	if resp := create(dave); resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("超过IP游戏数上限: %d Retry-After=%q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// 同一IP的第5次请求超过频率
+	resp := create(carol)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("超过频率: %d Retry-After=%q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// 加入游戏的频率单独计算
+	gameID, _ := ts.manager.CreateGame(game.GameSettings{}, "")
+	if _, err := ts.manager.GetGame(gameID).AddPlayer("host"); err != nil {
+		t.Fatal(err)
+	}
+	spammer := ts.join(gameID, "dave")
+	ts.join(gameID, "erin")
+	if status, _ := ts.post("/api/games/join", map[string]string{"gameId": gameID, "playerName": "frank"}); status != http.StatusTooManyRequests {
+		t.Errorf("超过加入频率: %d", status)
+	}
+	if ts.scrape()[`liarsbar_rate_limited_total{scope="create_game",by="ip"}`] != limitedBefore+1 {
+		t.Error("没有统计被限流的请求")
+	}
+
+	// 持续刷消息的连接被断开
+	for i := 0; i < 5+game.MessageAbuseLimit; i++ {
+		spammer.send(map[string]interface{}{"type": "ready"})
+	}
+	spammer.waitFor("限流提醒", func(m map[string]interface{}) bool {
+		return m["type"] == "error" && strings.Contains(m["message"].(string), "太频繁")
+	})
+	spammer.waitFor("断开提醒", func(m map[string]interface{}) bool {
+		return m["type"] == "error" && strings.Contains(m["message"].(string), "连接已断开")
+	})
+}
+
+// TestPlayerNames 创建和加入游戏时校验名字，不合法时返回带原因代码的JSON
+func TestPlayerNames(t *testing.T) {
+	ts := newTestServerWithOptions(t, game.ManagerOptions{
+		Names: game.NamePolicy{Blocklist: []string{"admin"}, RejectDuplicates: true},
+	})
+
+	nameError := func(path string, body map[string]string) (int, game.NameError) {
+		data, _ := json.Marshal(body)
+		resp, err := http.Post(ts.server.URL+path, "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var nameErr game.NameError
+		if err := json.NewDecoder(resp.Body).Decode(&nameErr); err != nil {
+			t.Fatalf("%s 没有返回JSON错误: %v", path, err)
+		}
+		return resp.StatusCode, nameErr
+	}
+
+	if status, err := nameError("/api/games", map[string]string{"playerName": "<script>"}); status != http.StatusBadRequest || err.Code != game.NameInvalid {
+		t.Errorf("创建游戏: %d %+v", status, err)
+	}
+	if games := len(ts.manager.Games()); games != 0 {
+		t.Errorf("名字不合法时留下了 %d 个游戏", games)
+	}
+
+	gameID, _ := ts.createGame("  Ａlice ", nil)
+	for _, tt := range []struct {
+		name   string
+		status int
+		code   string
+	}{
+		{"", http.StatusBadRequest, game.NameEmpty},
+		{strings.Repeat("x", 100), http.StatusBadRequest, game.NameTooLong},
+		{"the admin", http.StatusBadRequest, game.NameBlocked},
+		{"ALICE", http.StatusConflict, game.NameTaken},
+	} {
+		status, err := nameError("/api/games/join", map[string]string{"gameId": gameID, "playerName": tt.name})
+		if status != tt.status || err.Code != tt.code || err.Message == "" {
+			t.Errorf("加入 %q: %d %+v，应为 %d %s", tt.name, status, err, tt.status, tt.code)
+		}
+	}
+
+	// 广播的是规范化后的名字
+	bob := ts.join(gameID, "bob")
+	if transcript := bytes.Join(bob.transcript(), nil); !bytes.Contains(transcript, []byte(`"Alice"`)) {
+		t.Errorf("游戏状态中没有规范化后的名字: %s", transcript)
+	}
+}
+
+// TestChat 聊天广播给桌上所有人，经过过滤和限流，屏蔽的玩家收不到，重连时补发聊天记录
+func TestChat(t *testing.T) {
+	ts := newTestServerWithOptions(t, game.ManagerOptions{
+		ChatLimit:  game.RateLimit{Rate: 0.001, Burst: 2},
+		ChatFilter: game.NewWordFilter([]string{"darn"}),
+	})
+
+	gameID, alice := ts.createGame("alice", nil)
+	bob := ts.join(gameID, "bob")
+	isChat := func(text string) func(map[string]interface{}) bool {
+		return func(m map[string]interface{}) bool {
+			return m["type"] == "chat" && m["message"].(map[string]interface{})["text"] == text
+		}
+	}
+	isError := func(text string) func(map[string]interface{}) bool {
+		return func(m map[string]interface{}) bool {
+			return m["type"] == "error" && strings.Contains(m["message"].(string), text)
+		}
+	}
+
+	alice.send(map[string]interface{}{"type": "chat", "text": "  Darn,\nI have a Q "})
+	message := bob.waitFor("聊天消息", isChat("****, I have a Q"))["message"].(map[string]interface{})
+	if message["playerName"] != "alice" || message["channel"] != game.ChatChannelTable {
+		t.Errorf("聊天消息: %v", message)
+	}
+	alice.waitFor("自己的聊天消息", isChat("****, I have a Q"))
+
+	alice.send(map[string]interface{}{"type": "chat", "text": strings.Repeat("长", game.MaxChatLength+1)})
+	alice.waitFor("消息太长", isError("太长"))
+
+	// bob 屏蔽 alice 后收不到她的消息
+	bob.send(map[string]interface{}{"type": "mute_player", "playerId": alice.playerID})
+	bob.waitFor("屏蔽确认", isType("mute_updated"))
+	alice.send(map[string]interface{}{"type": "chat", "text": "bob?"})
+	alice.waitFor("自己的聊天消息", isChat("bob?"))
+	bob.send(map[string]interface{}{"type": "chat", "text": "ping"})
+	bob.waitFor("自己的聊天消息", isChat("ping"))
+	if bytes.Contains(bytes.Join(bob.transcript(), nil), []byte("bob?")) {
+		t.Error("屏蔽后仍收到了消息")
+	}
+
+	// 超过发言频率
+	alice.send(map[string]interface{}{"type": "chat", "text": "again"})
+	alice.waitFor("限流", isError("太频繁"))
+
+	// 重连时补发能看到的聊天记录
+	carol := ts.join(gameID, "carol")
+	history := carol.waitFor("聊天记录", isType("chat_history"))["messages"].([]interface{})
+	if len(history) != 3 {
+		t.Errorf("聊天记录有 %d 条: %v", len(history), history)
+	}
+	bob.close()
+	bob = ts.connect(gameID, bob.playerID, "bob")
+	history = bob.waitFor("聊天记录", isType("chat_history"))["messages"].([]interface{})
+	if len(history) != 1 {
+		t.Errorf("屏蔽后的聊天记录有 %d 条: %v", len(history), history)
+	}
+}
+
+func TestEmotes(t *testing.T) {
+	ts := newTestServerWithOptions(t, game.ManagerOptions{
+		EmoteLimit: game.RateLimit{Rate: 0.001, Burst: 1},
+	})
+
+	gameID, alice := ts.createGame("alice", nil)
+	bob := ts.join(gameID, "bob")
+	isEmote := func(emote string) func(map[string]interface{}) bool {
+		return func(m map[string]interface{}) bool {
+			return m["type"] == "emote" && m["emote"] == emote
+		}
+	}
+	isError := func(text string) func(map[string]interface{}) bool {
+		return func(m map[string]interface{}) bool {
+			return m["type"] == "error" && strings.Contains(m["message"].(string), text)
+		}
+	}
+
+	alice.send(map[string]interface{}{"type": "emote", "emote": "wink"})
+	alice.waitFor("不存在的表情", isError("表情"))
+
+	// 对某位玩家的表情带上发送者和目标
+	alice.send(map[string]interface{}{"type": "emote", "emote": "suspicious", "playerId": bob.playerID})
+	for _, client := range []*fakeClient{alice, bob} {
+		message := client.waitFor("表情", isEmote("suspicious"))
+		if message["playerId"] != alice.playerID || message["playerName"] != "alice" || message["targetId"] != bob.playerID || message["targetName"] != "bob" {
+			t.Errorf("表情消息: %v", message)
+		}
+	}
+
+	// 超过频率限制
+	alice.send(map[string]interface{}{"type": "emote", "emote": "laugh"})
+	alice.waitFor("限流", isError("太频繁"))
+}
+
+// TestPlayerStats 携带服务器签发的身份令牌入座的玩家在一局结束后可以查到战绩，伪造令牌的玩家不统计
+func TestPlayerStats(t *testing.T) {
+	profiles, err := game.NewProfileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServerWithOptions(t, game.ManagerOptions{CountdownTick: time.Millisecond, Seed: 1, Profiles: profiles})
+
+	post := func(path string, token string, body map[string]string) map[string]string {
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(http.MethodPost, ts.server.URL+path, bytes.NewReader(data))
+		req.Header.Set("Authorization", "Bearer "+token)
+		status, respBody := ts.do(req)
+		result := make(map[string]string)
+		if err := json.Unmarshal(respBody, &result); status != http.StatusOK || err != nil {
+			t.Fatalf("%s: %d %s", path, status, respBody)
+		}
+		return result
+	}
+	stats := func(id string, token string) (int, game.PlayerStats) {
+		req, _ := http.NewRequest(http.MethodGet, ts.server.URL+"/api/players/"+id+"/stats", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		status, body := ts.do(req)
+		var result game.PlayerStats
+		if status == http.StatusOK {
+			if err := json.Unmarshal(body, &result); err != nil {
+				t.Fatalf("解析战绩失败: %s", body)
+			}
+		}
+		return status, result
+	}
+
+	// 身份令牌由服务器签发
+	identity := func() map[string]string {
+		status, body := ts.post("/api/identity", nil)
+		if status != http.StatusOK || body["token"] == "" || body["profileId"] == "" {
+			t.Fatalf("申请身份: %d %v", status, body)
+		}
+		return body
+	}
+	aliceID, bobID, carolID := identity(), identity(), identity()
+
+	created := post("/api/games", aliceID["token"], map[string]string{"playerName": "alice"})
+	gameID := created["gameId"]
+	joined := post("/api/games/join", bobID["token"], map[string]string{"gameId": gameID, "playerName": "bob"})
+	if created["profileId"] != aliceID["profileId"] || joined["profileId"] != bobID["profileId"] || created["profileId"] == joined["profileId"] {
+		t.Fatalf("档案ID: %v %v", created, joined)
+	}
+
+	// 客户端自己编造或篡改的令牌不计入任何档案
+	forged := post("/api/games/join", bobID["profileId"][1:]+".forged", map[string]string{"gameId": gameID, "playerName": "mallory"})
+	if forged["profileId"] != "" {
+		t.Errorf("伪造的令牌得到了档案: %v", forged)
+	}
+	alice := ts.connect(gameID, created["playerId"], "alice")
+	bob := ts.connect(gameID, joined["playerId"], "bob")
+	mallory := ts.connect(gameID, forged["playerId"], "mallory")
+	clients := []*fakeClient{alice, bob, mallory}
+
+	// 还没有打完一局
+	if status, _ := stats(created["profileId"], ""); status != http.StatusNotFound {
+		t.Errorf("开局前查询战绩: %d", status)
+	}
+
+	readyAll(clients...)
+	alice.send(map[string]interface{}{"type": "start_game"})
+	waitGameOver(clients...)
+
+	// 战绩在一局结束归档时写入，稍等一下
+	var aliceStats game.PlayerStats
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, result := stats(created["profileId"], "")
+		if status == http.StatusOK {
+			aliceStats = result
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("查询战绩: %d", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if aliceStats.ProfileID != created["profileId"] || aliceStats.Name != "alice" || aliceStats.GamesPlayed != 1 || aliceStats.Wins > 1 {
+		t.Errorf("alice 的战绩: %+v", aliceStats)
+	}
+
+	// me 表示请求者自己
+	if status, bobStats := stats("me", bobID["token"]); status != http.StatusOK || bobStats.ProfileID != joined["profileId"] || bobStats.GamesPlayed != 1 {
+		t.Errorf("bob 的战绩: %d %+v", status, bobStats)
+	}
+	if status, _ := stats("me", ""); status != http.StatusUnauthorized {
+		t.Errorf("没有令牌查询自己的战绩: %d", status)
+	}
+	if status, _ := stats("me", "bob-token"); status != http.StatusUnauthorized {
+		t.Errorf("无效的令牌查询自己的战绩: %d", status)
+	}
+	if status, _ := stats("me", carolID["token"]); status != http.StatusNotFound {
+		t.Errorf("没有参加过游戏的档案: %d", status)
+	}
+}
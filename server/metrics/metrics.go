@@ -0,0 +1,339 @@
+// Package metrics 以 Prometheus 文本格式导出计数器、仪表和直方图
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType Prometheus 文本格式的内容类型
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric 可以写成文本格式的指标
+type Metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry 一组一起导出的指标
+type Registry struct {
+	mu      sync.Mutex
+	metrics []Metric
+}
+
+// NewRegistry 创建空的注册表
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register 注册指标，导出时按注册顺序排列
+func (r *Registry) Register(metrics ...Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics = append(r.metrics, metrics...)
+}
+
+// WriteText 以文本格式写出所有指标
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]Metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP 导出所有指标
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteText(w)
+}
+
+// desc 指标的名字、说明和标签名
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+// header 写出指标的说明和类型
+func (d *desc) header(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, kind)
+}
+
+// key 校验标签值的个数并拼成查找用的键
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("指标 %s 需要 %d 个标签值，实际 %d 个", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs 将标签名和值写成 {a="1",b="2"}，extra 追加在最后
+func (d *desc) labelPairs(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, value := range values {
+		pairs = append(pairs, d.labels[i]+`="`+escapeLabel(value)+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabel 转义标签值中的反斜杠、双引号和换行
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatValue 格式化样本值
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// series 一组标签值对应的样本
+type series struct {
+	labels []string
+	value  float64
+}
+
+// vec 按标签值保存样本，计数器和仪表共用
+type vec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// add 给一组标签值对应的样本加上 v
+func (v *vec) add(delta float64, values []string) {
+	key := v.key(values)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	s.value += delta
+}
+
+// set 设置一组标签值对应的样本
+func (v *vec) set(value float64, values []string) {
+	key := v.key(values)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.series[key] = &series{labels: append([]string(nil), values...), value: value}
+}
+
+// writeSamples 按标签值排序写出所有样本
+func (v *vec) writeSamples(w *bufio.Writer, kind string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.header(w, kind)
+	for _, key := range sortedKeys(v.series) {
+		s := v.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelPairs(s.labels), formatValue(s.value))
+	}
+}
+
+// Counter 只增不减的计数器，可以带标签
+type Counter struct {
+	vec
+}
+
+// NewCounter 创建计数器；没有标签时初始值为0
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec{desc: desc{name, help, labels}, series: make(map[string]*series)}}
+	if len(labels) == 0 {
+		c.add(0, nil)
+	}
+	return c
+}
+
+// Inc 计数加一
+func (c *Counter) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+// Add 计数加上 delta，delta 不能为负
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("计数器 %s 不能减少", c.name))
+	}
+	c.add(delta, labelValues)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.writeSamples(w, "counter")
+}
+
+// Gauge 可增可减的仪表，可以带标签
+type Gauge struct {
+	vec
+}
+
+// NewGauge 创建仪表；没有标签时初始值为0
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec{desc: desc{name, help, labels}, series: make(map[string]*series)}}
+	if len(labels) == 0 {
+		g.set(0, nil)
+	}
+	return g
+}
+
+// Set 设置当前值
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.set(value, labelValues)
+}
+
+// Add 当前值加上 delta
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.add(delta, labelValues)
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.writeSamples(w, "gauge")
+}
+
+// GaugeFunc 每次导出时重新统计的仪表
+type GaugeFunc struct {
+	desc
+	collect func(g *Gauge)
+}
+
+// NewGaugeFunc 创建导出时调用 collect 填充样本的仪表
+func NewGaugeFunc(name, help string, labels []string, collect func(g *Gauge)) *GaugeFunc {
+	return &GaugeFunc{desc: desc{name, help, labels}, collect: collect}
+}
+
+func (f *GaugeFunc) write(w *bufio.Writer) {
+	g := NewGauge(f.name, f.help, f.labels...)
+	f.collect(g)
+	g.write(w)
+}
+
+// DefaultBuckets 默认的直方图分桶（秒），适合请求延迟
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogramSeries 一组标签值对应的直方图
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // 每个分桶（不累计）的观测次数
+	count  uint64
+	sum    float64
+}
+
+// Histogram 按分桶统计观测值的直方图，可以带标签
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+// NewHistogram 创建直方图，buckets 为递增的分桶上界
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{
+		desc:    desc{name, help, labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+}
+
+// Observe 记录一次观测
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(s.labels, "le", formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(s.labels), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(s.labels), s.count)
+	}
+}
+
+// sortedKeys 返回按字母顺序排列的键，使输出稳定
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// statusRecorder 记录处理函数写出的状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// InstrumentHandler 按状态码记录处理时间（秒），h 需要 handler 和 code 两个标签
+func InstrumentHandler(h *Histogram, name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next(recorder, r)
+		h.Observe(time.Since(start).Seconds(), name, strconv.Itoa(recorder.code))
+	}
+}
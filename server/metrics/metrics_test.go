@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestWriteText 各类指标按文本格式导出
+func TestWriteText(t *testing.T) {
+	requests := NewCounter("requests_total", "请求数", "path", "code")
+	requests.Inc("/b", "200")
+	requests.Inc("/a", "200")
+	requests.Add(2, "/a", "200")
+	requests.Inc(`/"q"`, "500")
+
+	errors := NewCounter("errors_total", "错误数")
+
+	temperature := NewGauge("temperature", "温度\n多行说明")
+	temperature.Set(1.5)
+	temperature.Add(-3)
+
+	rooms := NewGaugeFunc("rooms", "按状态统计的房间", []string{"state"}, func(g *Gauge) {
+		g.Set(0, "closed")
+		g.Add(1, "open")
+		g.Add(1, "open")
+	})
+
+	latency := NewHistogram("latency_seconds", "延迟", []float64{1, 0.1}, "handler")
+	latency.Observe(0.05, "x")
+	latency.Observe(0.1, "x")
+	latency.Observe(0.5, "x")
+	latency.Observe(3, "x")
+
+	registry := NewRegistry()
+	registry.Register(requests, errors, temperature, rooms, latency)
+
+	want := `# HELP requests_total 请求数
+# TYPE requests_total counter
+requests_total{path="/\"q\"",code="500"} 1
+requests_total{path="/a",code="200"} 3
+requests_total{path="/b",code="200"} 1
+# HELP errors_total 错误数
+# TYPE errors_total counter
+errors_total 0
+# HELP temperature 温度\n多行说明
+# TYPE temperature gauge
+temperature -1.5
+# HELP rooms 按状态统计的房间
+# TYPE rooms gauge
+rooms{state="closed"} 0
+rooms{state="open"} 2
+# HELP latency_seconds 延迟
+# TYPE latency_seconds histogram
+latency_seconds_bucket{handler="x",le="0.1"} 2
+latency_seconds_bucket{handler="x",le="1"} 3
+latency_seconds_bucket{handler="x",le="+Inf"} 4
+latency_seconds_sum{handler="x"} 3.65
+latency_seconds_count{handler="x"} 4
+`
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if got := recorder.Body.String(); got != want {
+		t.Errorf("导出结果不一致:\n%s\n期望:\n%s", got, want)
+	}
+	if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("内容类型: %s", got)
+	}
+}
+
+// TestLabelCount 标签值个数不对时 panic
+func TestLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("缺少标签值时应 panic")
+		}
+	}()
+	NewCounter("c", "c", "a").Inc()
+}
@@ -0,0 +1,53 @@
+package rules
+
+// Action 玩家或牌桌对一局游戏发出的动作
+type Action interface {
+	action()
+}
+
+// Seat 开局时入座的玩家
+type Seat struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// StartGame 开始新的一局，上一局的系列赛战绩已决出胜者时重新计算
+type StartGame struct {
+	Seats    []Seat
+	Settings Settings
+}
+
+// PlayCards 当前玩家出1到3张牌
+type PlayCards struct {
+	PlayerID string
+	Cards    []string
+}
+
+// Challenge 被询问的玩家决定是否质疑上一次出牌
+type Challenge struct {
+	PlayerID  string
+	Challenge bool
+	Reason    string
+}
+
+// Forfeit 玩家中途认输
+type Forfeit struct {
+	PlayerID string
+}
+
+// NextRound 一轮结束后发牌开始下一轮
+type NextRound struct{}
+
+// Emote 玩家向全桌或某位玩家发出表情，不影响牌局，只记入日志
+type Emote struct {
+	PlayerID string
+	TargetID string // 为空表示对全桌
+	Emote    string
+}
+
+func (StartGame) action() {}
+func (PlayCards) action() {}
+func (Challenge) action() {}
+func (Forfeit) action()   {}
+func (NextRound) action() {}
+func (Emote) action()     {}
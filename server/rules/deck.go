@@ -0,0 +1,46 @@
+package rules
+
+import "fmt"
+
+// Deck 牌组构成：目标牌Q、K、A以及万能的大王各有几张
+type Deck struct {
+	Queens int `json:"queens"`
+	Kings  int `json:"kings"`
+	Aces   int `json:"aces"`
+	Jokers int `json:"jokers"`
+}
+
+// DefaultDeck 返回默认牌组：Q、K、A各6张，大王2张
+func DefaultDeck() Deck {
+	return Deck{Queens: 6, Kings: 6, Aces: 6, Jokers: 2}
+}
+
+// Size 牌组的总张数
+func (d Deck) Size() int {
+	return d.Queens + d.Kings + d.Aces + d.Jokers
+}
+
+// Validate 检查牌组足够给 maxPlayers 名玩家每人发一手牌
+func (d Deck) Validate(maxPlayers int) error {
+	if d.Queens < 0 || d.Kings < 0 || d.Aces < 0 || d.Jokers < 0 {
+		return fmt.Errorf("牌组中每种牌的张数不能为负")
+	}
+	if d.Size() < maxPlayers*HandSize {
+		return fmt.Errorf("牌组只有 %d 张，不够 %d 名玩家每人 %d 张", d.Size(), maxPlayers, HandSize)
+	}
+	return nil
+}
+
+// cards 按构成列出牌组中的所有牌
+func (d Deck) cards() []string {
+	cards := make([]string, 0, d.Size())
+	for _, kind := range []struct {
+		card  string
+		count int
+	}{{CardQ, d.Queens}, {CardK, d.Kings}, {CardA, d.Aces}, {CardJoker, d.Jokers}} {
+		for i := 0; i < kind.count; i++ {
+			cards = append(cards, kind.card)
+		}
+	}
+	return cards
+}
@@ -0,0 +1,26 @@
+package rules
+
+// 表情，牌桌上只接受这些表情
+const (
+	EmoteLaugh      = "laugh"      // 大笑
+	EmoteSuspicious = "suspicious" // 怀疑
+	EmoteSweat      = "sweat"      // 冒汗
+	EmoteConfident  = "confident"  // 自信
+	EmoteAngry      = "angry"      // 生气
+	EmoteCry        = "cry"        // 哭
+	EmoteThink      = "think"      // 思考
+	EmoteClap       = "clap"       // 鼓掌
+)
+
+// Emotes 所有可用的表情，按客户端显示的顺序
+var Emotes = []string{EmoteLaugh, EmoteSuspicious, EmoteSweat, EmoteConfident, EmoteAngry, EmoteCry, EmoteThink, EmoteClap}
+
+// IsEmote 检查是否是可用的表情
+func IsEmote(name string) bool {
+	for _, emote := range Emotes {
+		if emote == name {
+			return true
+		}
+	}
+	return false
+}
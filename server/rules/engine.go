@@ -0,0 +1,477 @@
+package rules
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// 动作被拒绝的原因
+var (
+	ErrGameInProgress    = errors.New("游戏正在进行中")
+	ErrNotEnoughPlayers  = errors.New("至少需要2名玩家才能开始")
+	ErrTooManyPlayers    = errors.New("玩家人数超出上限")
+	ErrGameNotStarted    = errors.New("游戏还没有开始")
+	ErrGameOver          = errors.New("游戏已结束")
+	ErrRoundOver         = errors.New("这一轮已经结束")
+	ErrRoundInProgress   = errors.New("这一轮还没有结束")
+	ErrUnknownPlayer     = errors.New("玩家不存在")
+	ErrPlayerEliminated  = errors.New("玩家已出局")
+	ErrNotYourTurn       = errors.New("还没有轮到你")
+	ErrAwaitingChallenge = errors.New("请先决定是否质疑")
+	ErrNoChallenge       = errors.New("现在不能质疑")
+	ErrCardCount         = errors.New("每次只能出1到3张牌")
+	ErrCardNotInHand     = errors.New("你没有这张牌")
+	ErrUnknownEmote      = errors.New("没有这个表情")
+)
+
+// Engine 规则引擎：接收动作，校验后返回新的状态和产生的事件
+// 引擎不做网络通信、不加锁也不等待，随机数来自给定的种子，同一个引擎不能并发使用
+type Engine struct {
+	rand       *rand.Rand
+	now        func() time.Time
+	deck       Deck // 每轮使用的牌组
+	maxPlayers int  // 每桌最多人数
+}
+
+// NewEngine 使用给定的随机种子创建规则引擎
+func NewEngine(seed int64) *Engine {
+	return &Engine{
+		rand:       rand.New(rand.NewSource(seed)),
+		now:        time.Now,
+		deck:       DefaultDeck(),
+		maxPlayers: MaxPlayers,
+	}
+}
+
+// SetClock 设置事件时间的来源，默认为当前时间
+func (e *Engine) SetClock(now func() time.Time) {
+	e.now = now
+}
+
+// SetDeck 设置牌组构成，调用方需保证牌组足够发牌（见 Deck.Validate）
+func (e *Engine) SetDeck(deck Deck) {
+	e.deck = deck
+}
+
+// SetMaxPlayers 设置每桌最多人数，默认为 MaxPlayers
+func (e *Engine) SetMaxPlayers(maxPlayers int) {
+	e.maxPlayers = maxPlayers
+}
+
+// Apply 在状态的拷贝上执行动作，返回新的状态和产生的事件
+// 动作被拒绝时返回原状态和错误，传入的状态不会被修改
+func (e *Engine) Apply(state *State, action Action) (*State, []Event, error) {
+	if state == nil {
+		state = NewState()
+	}
+
+	t := &turn{engine: e, state: state.Clone()}
+
+	var err error
+	switch a := action.(type) {
+	case StartGame:
+		err = t.startGame(a)
+	case PlayCards:
+		err = t.playCards(a)
+	case Challenge:
+		err = t.challenge(a)
+	case Forfeit:
+		err = t.forfeit(a)
+	case NextRound:
+		err = t.nextRound()
+	case Emote:
+		err = t.emote(a)
+	default:
+		err = errors.New("未知的动作")
+	}
+
+	if err != nil {
+		return state, nil, err
+	}
+	return t.state, t.events, nil
+}
+
+// turn 执行一个动作的过程，事件产生后立即折叠到状态上
+type turn struct {
+	engine *Engine
+	state  *State
+	events []Event
+}
+
+// emit 产生一个事件并折叠到状态上
+func (t *turn) emit(ev Event) {
+	ev.Seq = t.state.Seq + 1
+	if ev.Type == EventGameStarted {
+		ev.Seq = 1
+	}
+	ev.Time = t.engine.now()
+
+	t.state.Apply(ev)
+	t.events = append(t.events, ev)
+}
+
+// startGame 开局：装弹、发牌并随机选择起始玩家
+func (t *turn) startGame(a StartGame) error {
+	s := t.state
+	if s.Playing() {
+		return ErrGameInProgress
+	}
+	if len(a.Seats) < MinPlayers {
+		return ErrNotEnoughPlayers
+	}
+	if len(a.Seats) > t.engine.maxPlayers {
+		return ErrTooManyPlayers
+	}
+	settings := a.Settings
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	// 系列赛已决出胜负时开始新的系列赛，离开的玩家不再计入战绩
+	gameNumber := 1
+	matchWins := make(map[string]int)
+	if s.GameOver && s.SeriesWinnerID == "" {
+		gameNumber = s.GameNumber + 1
+		for _, seat := range a.Seats {
+			if wins, ok := s.MatchWins[seat.ID]; ok {
+				matchWins[seat.ID] = wins
+			}
+		}
+	}
+
+	playerOrder := make([]string, 0, len(a.Seats))
+	playerNames := make([]string, 0, len(a.Seats))
+	for _, seat := range a.Seats {
+		playerOrder = append(playerOrder, seat.ID)
+		playerNames = append(playerNames, seat.Name)
+	}
+
+	t.emit(Event{
+		Type:        EventGameStarted,
+		GameNumber:  gameNumber,
+		Settings:    &settings,
+		PlayerOrder: playerOrder,
+		PlayerNames: playerNames,
+		MatchWins:   matchWins,
+	})
+
+	// 为每位玩家装弹
+	for _, playerID := range playerOrder {
+		t.emit(Event{Type: EventRevolverLoaded, PlayerID: playerID, Bullet: t.engine.rand.Intn(Chambers)})
+	}
+
+	// 随机选择起始玩家，发牌并开始第一轮
+	t.deal(t.engine.rand.Intn(len(playerOrder)))
+	return nil
+}
+
+// deal 洗牌发牌、选择目标牌，从指定位置的玩家开始新的一轮
+func (t *turn) deal(startIdx int) {
+	s := t.state
+	deck := t.shuffledDeck()
+
+	// 每位存活玩家发5张牌
+	hands := make(map[string][]string)
+	for i := 0; i < HandSize; i++ {
+		for _, playerID := range s.PlayerOrder {
+			if s.Players[playerID].Alive && len(deck) > 0 {
+				hands[playerID] = append(hands[playerID], deck[0])
+				deck = deck[1:]
+			}
+		}
+	}
+	t.emit(Event{Type: EventCardsDealt, Hands: hands, Deck: deck})
+
+	// 随机选择目标牌
+	targetCards := []string{CardQ, CardK, CardA}
+	t.emit(Event{
+		Type:     EventTargetChosen,
+		PlayerID: s.PlayerOrder[startIdx],
+		Card:     targetCards[t.engine.rand.Intn(len(targetCards))],
+		Round:    s.RoundCount + 1,
+	})
+}
+
+// shuffledDeck 按引擎的牌组构成创建并洗牌牌组
+func (t *turn) shuffledDeck() []string {
+	deck := t.engine.deck.cards()
+
+	t.engine.rand.Shuffle(len(deck), func(i, j int) {
+		deck[i], deck[j] = deck[j], deck[i]
+	})
+	return deck
+}
+
+// checkTurn 检查一局正在进行且这一轮还没有结束
+func (t *turn) checkTurn() error {
+	switch {
+	case len(t.state.PlayerOrder) == 0:
+		return ErrGameNotStarted
+	case t.state.GameOver:
+		return ErrGameOver
+	case t.state.RoundOver:
+		return ErrRoundOver
+	}
+	return nil
+}
+
+// playCards 当前玩家出牌，其他玩家都没有手牌时由系统自动质疑
+func (t *turn) playCards(a PlayCards) error {
+	s := t.state
+	if err := t.checkTurn(); err != nil {
+		return err
+	}
+	if s.CurrentPlayerID() != a.PlayerID {
+		return ErrNotYourTurn
+	}
+	if s.AwaitingChallenge {
+		return ErrAwaitingChallenge
+	}
+	if len(a.Cards) == 0 || len(a.Cards) > 3 {
+		return ErrCardCount
+	}
+	if _, ok := removeCards(s.Players[a.PlayerID].Hand, a.Cards); !ok {
+		return ErrCardNotInHand
+	}
+
+	cards := copyStrings(a.Cards)
+
+	// 其他存活玩家都没有手牌时，由系统自动质疑
+	if s.othersHaveNoCards(a.PlayerID) {
+		t.emit(Event{Type: EventCardsPlayed, PlayerID: a.PlayerID, Cards: cards})
+		t.systemChallenge()
+		return nil
+	}
+
+	// 轮到下一个有手牌的玩家决定是否质疑
+	nextPlayerID := s.PlayerOrder[s.nextPlayerWithCards(s.CurrentPlayerIdx)]
+	t.emit(Event{Type: EventCardsPlayed, PlayerID: a.PlayerID, TargetID: nextPlayerID, Cards: cards})
+	return nil
+}
+
+// challenge 被询问的玩家决定是否质疑，质疑失败的一方开枪
+func (t *turn) challenge(a Challenge) error {
+	s := t.state
+	if err := t.checkTurn(); err != nil {
+		return err
+	}
+	if !s.AwaitingChallenge || s.LastPlay == nil {
+		return ErrNoChallenge
+	}
+	if s.CurrentPlayerID() != a.PlayerID {
+		return ErrNotYourTurn
+	}
+
+	// 不质疑时由该玩家接着出牌
+	if !a.Challenge {
+		t.emit(Event{Type: EventChallengeDeclined, PlayerID: a.PlayerID, Reason: a.Reason})
+		return nil
+	}
+
+	// 出牌不合法则质疑成功，由出牌者开枪，否则由质疑者开枪
+	accusedID := s.LastPlay.PlayerID
+	success := !s.isValidPlay(s.LastPlay.Cards)
+	t.emit(Event{
+		Type:     EventChallengeResolved,
+		PlayerID: accusedID,
+		TargetID: a.PlayerID,
+		Cards:    s.LastPlay.Cards,
+		Reason:   a.Reason,
+		Success:  success,
+	})
+
+	shooterID := a.PlayerID
+	if success {
+		shooterID = accusedID
+	}
+	t.shoot(shooterID)
+	return nil
+}
+
+// systemChallenge 系统自动质疑最近一次出牌
+func (t *turn) systemChallenge() {
+	s := t.state
+	playerID := s.LastPlay.PlayerID
+	valid := s.isValidPlay(s.LastPlay.Cards)
+	t.emit(Event{
+		Type:     EventChallengeResolved,
+		PlayerID: playerID,
+		Cards:    s.LastPlay.Cards,
+		Reason:   "系统自动质疑",
+		Success:  !valid,
+		System:   true,
+	})
+
+	// 出牌合法时无人受罚，随机选择下一轮的起始玩家
+	if valid {
+		t.endRound("")
+		return
+	}
+	t.shoot(playerID)
+}
+
+// shoot 开枪：中弹扣一条命，命数耗尽则出局，否则重新装弹
+func (t *turn) shoot(playerID string) {
+	player := t.state.Players[playerID]
+
+	// 转到下一个弹仓，检查是否命中
+	chamber := (player.CurrentBulletPosition + 1) % Chambers
+	hit := chamber == player.BulletPosition
+	t.emit(Event{Type: EventShotFired, PlayerID: playerID, Chamber: chamber, Hit: hit})
+
+	if hit {
+		if player.Lives <= 0 {
+			t.emit(Event{Type: EventPlayerEliminated, PlayerID: playerID, Reason: EliminatedByShot})
+		} else {
+			t.emit(Event{Type: EventRevolverLoaded, PlayerID: playerID, Bullet: t.engine.rand.Intn(Chambers)})
+		}
+	}
+
+	// 下一轮从开枪的玩家开始
+	t.endRound(playerID)
+}
+
+// endRound 结束这一轮，决出胜者时结束这一局
+func (t *turn) endRound(nextStarterID string) {
+	if t.checkVictory() {
+		return
+	}
+	t.emit(Event{Type: EventRoundEnded, PlayerID: nextStarterID})
+}
+
+// checkVictory 一轮结束时只剩一名存活玩家，或达到最大轮数时积分榜第一名获胜
+func (t *turn) checkVictory() bool {
+	s := t.state
+	if t.checkLastSurvivor() {
+		return true
+	}
+	if s.Settings.MaxRounds == 0 || s.RoundCount < s.Settings.MaxRounds {
+		return false
+	}
+
+	t.emit(Event{Type: EventGameWon, PlayerID: s.Scoreboard()[0].PlayerID})
+	return true
+}
+
+// checkLastSurvivor 只剩一名存活玩家时其获胜，可在一轮中途判定
+func (t *turn) checkLastSurvivor() bool {
+	s := t.state
+	alive := s.alivePlayers()
+	if len(alive) != 1 {
+		return false
+	}
+
+	t.emit(Event{Type: EventGameWon, PlayerID: s.PlayerOrder[alive[0]]})
+	return true
+}
+
+// nextRound 一轮结束后发牌，从上一轮开枪的玩家开始，其已出局则顺延，没有开枪的玩家则随机选择
+func (t *turn) nextRound() error {
+	s := t.state
+	switch {
+	case len(s.PlayerOrder) == 0:
+		return ErrGameNotStarted
+	case s.GameOver:
+		return ErrGameOver
+	case !s.RoundOver:
+		return ErrRoundInProgress
+	}
+
+	startIdx := -1
+	if idx := s.SeatIndex(s.NextStarterID); idx >= 0 {
+		if s.Players[s.NextStarterID].Alive {
+			startIdx = idx
+		} else {
+			startIdx = s.nextAlivePlayer(idx)
+		}
+	}
+
+	if startIdx == -1 {
+		alive := s.alivePlayers()
+		startIdx = alive[t.engine.rand.Intn(len(alive))]
+	}
+
+	t.deal(startIdx)
+	return nil
+}
+
+// emote 在座的玩家（包括已出局的）向全桌或另一名在座玩家发出表情
+func (t *turn) emote(a Emote) error {
+	s := t.state
+	if len(s.PlayerOrder) == 0 {
+		return ErrGameNotStarted
+	}
+	if !IsEmote(a.Emote) {
+		return ErrUnknownEmote
+	}
+	if _, ok := s.Players[a.PlayerID]; !ok {
+		return ErrUnknownPlayer
+	}
+	if _, ok := s.Players[a.TargetID]; a.TargetID != "" && (!ok || a.TargetID == a.PlayerID) {
+		return ErrUnknownPlayer
+	}
+
+	t.emit(Event{Type: EventEmote, PlayerID: a.PlayerID, TargetID: a.TargetID, Emote: a.Emote})
+	return nil
+}
+
+// forfeit 玩家认输：判定出局、弃掉手牌，并推进回合
+func (t *turn) forfeit(a Forfeit) error {
+	s := t.state
+	if len(s.PlayerOrder) == 0 {
+		return ErrGameNotStarted
+	}
+	if s.GameOver {
+		return ErrGameOver
+	}
+	player, ok := s.Players[a.PlayerID]
+	if !ok {
+		return ErrUnknownPlayer
+	}
+	if !player.Alive {
+		return ErrPlayerEliminated
+	}
+
+	t.emit(Event{Type: EventPlayerEliminated, PlayerID: a.PlayerID, Reason: EliminatedByForfeit})
+
+	// 只剩一名玩家时游戏结束，轮数上限留到这一轮结束时再判定
+	if t.checkLastSurvivor() || s.RoundOver {
+		return nil
+	}
+
+	leaverIdx := s.SeatIndex(a.PlayerID)
+	lastPlayerID := ""
+	if s.AwaitingChallenge && s.LastPlay != nil {
+		lastPlayerID = s.LastPlay.PlayerID
+	}
+
+	// 等待质疑时出牌者离开，质疑失去对象，改由被询问的玩家直接出牌
+	if lastPlayerID == a.PlayerID {
+		t.emit(Event{Type: EventTurnPassed, PlayerID: s.CurrentPlayerID()})
+		return nil
+	}
+
+	// 不涉及当前回合的玩家离开，不影响出牌顺序
+	if s.CurrentPlayerIdx != leaverIdx {
+		return nil
+	}
+
+	// 轮到离开的玩家，顺延至下一个存活且有手牌的玩家，没有玩家还有手牌则重新开始一轮
+	nextIdx := s.nextPlayerWithCards(leaverIdx)
+	if nextIdx == leaverIdx {
+		t.endRound("")
+		return nil
+	}
+
+	// 被询问质疑的玩家离开，若只剩出牌者本人有手牌则由系统质疑
+	nextPlayerID := s.PlayerOrder[nextIdx]
+	if lastPlayerID != "" && nextPlayerID == lastPlayerID {
+		t.systemChallenge()
+		return nil
+	}
+
+	// 询问下一位玩家是否质疑，或由下一位玩家出牌
+	t.emit(Event{Type: EventTurnPassed, PlayerID: nextPlayerID, Pending: lastPlayerID != ""})
+	return nil
+}
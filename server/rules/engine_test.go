@@ -0,0 +1,468 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// 完整牌组中每种牌的数量
+var fullDeck = map[string]int{CardQ: 6, CardK: 6, CardA: 6, CardJoker: 2}
+
+// simulation 用随机的合法动作驱动引擎，并在每一步检查不变量
+type simulation struct {
+	t      *testing.T
+	rand   *rand.Rand
+	engine *Engine
+	state  *State
+	events []Event
+	shots  map[string]int // 每位玩家自上次装弹以来开枪的次数
+}
+
+// newSimulation 按给定的种子创建模拟
+func newSimulation(t *testing.T, seed int64) *simulation {
+	engine := NewEngine(seed)
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine.SetClock(func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	})
+	return &simulation{
+		t:      t,
+		rand:   rand.New(rand.NewSource(seed)),
+		engine: engine,
+		state:  NewState(),
+		shots:  make(map[string]int),
+	}
+}
+
+// apply 执行一个动作，成功时检查产生的事件和新状态
+func (sim *simulation) apply(action Action) error {
+	sim.t.Helper()
+
+	before := encode(sim.t, sim.state)
+	next, events, err := sim.engine.Apply(sim.state, action)
+
+	// 传入的状态不会被修改
+	if after := encode(sim.t, sim.state); after != before {
+		sim.t.Fatalf("%T 修改了传入的状态", action)
+	}
+	if err != nil {
+		if next != sim.state || len(events) != 0 {
+			sim.t.Fatalf("%T 被拒绝时不应产生新状态或事件", action)
+		}
+		return err
+	}
+
+	for _, ev := range events {
+		if ev.Type == EventGameStarted {
+			sim.events = nil
+			sim.shots = make(map[string]int)
+		}
+		if ev.Seq != len(sim.events)+1 {
+			sim.t.Fatalf("事件序号不连续: %d", ev.Seq)
+		}
+		sim.events = append(sim.events, ev)
+
+		switch ev.Type {
+		case EventRevolverLoaded:
+			sim.shots[ev.PlayerID] = 0
+		case EventShotFired:
+			sim.shots[ev.PlayerID]++
+			if sim.shots[ev.PlayerID] > Chambers {
+				sim.t.Fatalf("左轮在一次装弹后开了 %d 枪", sim.shots[ev.PlayerID])
+			}
+		}
+	}
+
+	sim.state = next
+	sim.checkInvariants()
+	return nil
+}
+
+// checkInvariants 检查每一步之后都应成立的性质
+func (sim *simulation) checkInvariants() {
+	sim.t.Helper()
+	s := sim.state
+
+	// 牌既不会凭空出现也不会消失
+	if s.RoundCount > 0 {
+		counts := make(map[string]int)
+		for _, card := range s.Deck {
+			counts[card]++
+		}
+		for _, card := range s.Discards {
+			counts[card]++
+		}
+		for _, player := range s.Players {
+			for _, card := range player.Hand {
+				counts[card]++
+			}
+		}
+		if fmt.Sprint(counts) != fmt.Sprint(fullDeck) {
+			sim.t.Fatalf("牌数不守恒: %v", counts)
+		}
+	}
+
+	// 结束时恰好有一名胜者，且只结束一次
+	won := 0
+	for _, ev := range sim.events {
+		if ev.Type == EventGameWon {
+			won++
+		}
+	}
+	if s.GameOver {
+		if _, ok := s.Players[s.WinnerID]; !ok || won != 1 {
+			sim.t.Fatalf("游戏结束时胜者 %q，胜利事件 %d 个", s.WinnerID, won)
+		}
+		if alive := len(s.alivePlayers()); alive == 0 {
+			sim.t.Fatal("游戏结束时没有存活的玩家")
+		}
+	} else if won != 0 {
+		sim.t.Fatal("游戏未结束却有胜利事件")
+	}
+
+	// 一轮进行中时，当前玩家存活且有手牌
+	if !s.GameOver && !s.RoundOver {
+		current := s.Players[s.CurrentPlayerID()]
+		if current == nil || !current.Alive || len(current.Hand) == 0 {
+			sim.t.Fatalf("当前玩家 %d 已出局或没有手牌", s.CurrentPlayerIdx)
+		}
+	}
+
+	// 命数不为负，出局的玩家没有手牌
+	for _, player := range s.Players {
+		if player.Lives < 0 {
+			sim.t.Fatalf("%s 的命数为负", player.Name)
+		}
+		if !player.Alive && len(player.Hand) > 0 {
+			sim.t.Fatalf("出局的 %s 仍有手牌", player.Name)
+		}
+	}
+}
+
+// randomAction 随机选择一个合法动作，偶尔让玩家认输
+func (sim *simulation) randomAction() Action {
+	s := sim.state
+
+	if sim.rand.Intn(50) == 0 {
+		alive := s.alivePlayers()
+		return Forfeit{PlayerID: s.PlayerOrder[alive[sim.rand.Intn(len(alive))]]}
+	}
+	if s.RoundOver {
+		return NextRound{}
+	}
+
+	current := s.CurrentPlayerID()
+	if s.AwaitingChallenge {
+		return Challenge{PlayerID: current, Challenge: sim.rand.Intn(2) == 0}
+	}
+
+	hand := append([]string(nil), s.Players[current].Hand...)
+	sim.rand.Shuffle(len(hand), func(i, j int) { hand[i], hand[j] = hand[j], hand[i] })
+	count := 1 + sim.rand.Intn(3)
+	if count > len(hand) {
+		count = len(hand)
+	}
+	return PlayCards{PlayerID: current, Cards: hand[:count]}
+}
+
+// randomIllegalAction 随机构造一个不合法的动作
+func (sim *simulation) randomIllegalAction() Action {
+	s := sim.state
+	someone := s.PlayerOrder[sim.rand.Intn(len(s.PlayerOrder))]
+
+	switch sim.rand.Intn(5) {
+	case 0:
+		return PlayCards{PlayerID: someone, Cards: []string{CardQ, CardK, CardA, CardJoker}}
+	case 1:
+		return PlayCards{PlayerID: someone, Cards: []string{"X"}}
+	case 2:
+		return Challenge{PlayerID: "nobody", Challenge: true}
+	case 3:
+		return StartGame{Seats: []Seat{{ID: someone, Name: "x"}}}
+	default:
+		return Forfeit{PlayerID: "nobody"}
+	}
+}
+
+// playGame 从开局一直玩到决出胜者
+func (sim *simulation) playGame(seats []Seat, settings Settings) {
+	sim.t.Helper()
+
+	if err := sim.apply(StartGame{Seats: seats, Settings: settings}); err != nil {
+		sim.t.Fatalf("无法开局: %v", err)
+	}
+
+	for steps := 0; !sim.state.GameOver; steps++ {
+		if steps > 10000 {
+			sim.t.Fatal("游戏没有结束")
+		}
+		if sim.rand.Intn(10) == 0 {
+			if action := sim.randomIllegalAction(); sim.apply(action) == nil {
+				sim.t.Fatalf("不合法的动作 %T%+v 被接受", action, action)
+			}
+			continue
+		}
+		if err := sim.apply(sim.randomAction()); err != nil {
+			sim.t.Fatalf("合法动作被拒绝: %v", err)
+		}
+	}
+
+	// 状态总是可以由事件日志重放得到
+	replayed, err := Replay(sim.events)
+	if err != nil {
+		sim.t.Fatal(err)
+	}
+	if encode(sim.t, replayed) != encode(sim.t, sim.state) {
+		sim.t.Fatal("重放事件日志得到的状态不一致")
+	}
+}
+
+// TestRandomGames 随机的合法动作序列下不变量始终成立
+func TestRandomGames(t *testing.T) {
+	for seed := int64(1); seed <= 300; seed++ {
+		sim := newSimulation(t, seed)
+
+		seats := make([]Seat, MinPlayers+int(seed)%(MaxPlayers-MinPlayers+1))
+		for i := range seats {
+			seats[i] = Seat{ID: fmt.Sprintf("p%d", i), Name: fmt.Sprintf("玩家%d", i)}
+		}
+
+		settings := DefaultSettings()
+		if seed%2 == 0 {
+			settings = Settings{Mode: GameModeLives, StartingLives: 1 + int(seed)%4, MaxRounds: int(seed) % 8, BestOf: 3}
+		}
+
+		// 打完一个系列赛
+		for game := 0; game < settings.BestOf && sim.state.SeriesWinnerID == ""; game++ {
+			sim.playGame(seats, settings)
+		}
+	}
+}
+
+// TestSameSeedSameGame 相同的种子和动作得到相同的事件日志
+func TestSameSeedSameGame(t *testing.T) {
+	seats := []Seat{{ID: "a", Name: "a"}, {ID: "b", Name: "b"}, {ID: "c", Name: "c"}}
+
+	logs := make([]string, 2)
+	for i := range logs {
+		sim := newSimulation(t, 42)
+		sim.playGame(seats, DefaultSettings())
+		logs[i] = encode(t, sim.events)
+	}
+	if logs[0] != logs[1] {
+		t.Fatal("相同种子的两局游戏不一致")
+	}
+}
+
+// TestRejectedActions 不合法的动作返回对应的错误
+func TestRejectedActions(t *testing.T) {
+	engine := NewEngine(1)
+	seats := []Seat{{ID: "a", Name: "a"}, {ID: "b", Name: "b"}}
+
+	if _, _, err := engine.Apply(nil, PlayCards{PlayerID: "a", Cards: []string{CardQ}}); err != ErrGameNotStarted {
+		t.Errorf("开局前出牌: %v", err)
+	}
+	if _, _, err := engine.Apply(nil, Emote{PlayerID: "a", Emote: EmoteLaugh}); err != ErrGameNotStarted {
+		t.Errorf("开局前发表情: %v", err)
+	}
+	if _, _, err := engine.Apply(nil, StartGame{Seats: seats[:1]}); err != ErrNotEnoughPlayers {
+		t.Errorf("一名玩家开局: %v", err)
+	}
+
+	state, _, err := engine.Apply(nil, StartGame{Seats: seats, Settings: DefaultSettings()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := state.CurrentPlayerID()
+	other := "a"
+	if current == "a" {
+		other = "b"
+	}
+
+	cases := []struct {
+		action Action
+		want   error
+	}{
+		{StartGame{Seats: seats}, ErrGameInProgress},
+		{PlayCards{PlayerID: other, Cards: state.Players[other].Hand[:1]}, ErrNotYourTurn},
+		{PlayCards{PlayerID: current}, ErrCardCount},
+		{PlayCards{PlayerID: current, Cards: state.Players[current].Hand[:4]}, ErrCardCount},
+		{PlayCards{PlayerID: current, Cards: []string{"X"}}, ErrCardNotInHand},
+		{Challenge{PlayerID: current, Challenge: true}, ErrNoChallenge},
+		{NextRound{}, ErrRoundInProgress},
+		{Forfeit{PlayerID: "nobody"}, ErrUnknownPlayer},
+		{Emote{PlayerID: current, Emote: "wink"}, ErrUnknownEmote},
+		{Emote{PlayerID: "nobody", Emote: EmoteLaugh}, ErrUnknownPlayer},
+		{Emote{PlayerID: current, TargetID: current, Emote: EmoteLaugh}, ErrUnknownPlayer},
+		{Emote{PlayerID: current, TargetID: "nobody", Emote: EmoteLaugh}, ErrUnknownPlayer},
+	}
+	for _, c := range cases {
+		if _, _, err := engine.Apply(state, c.action); err != c.want {
+			t.Errorf("%T%+v: 期望 %v，实际 %v", c.action, c.action, c.want, err)
+		}
+	}
+}
+
+// encode 将值编码为JSON用于比较
+func encode(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestCustomDeck 自定义牌组和人数上限
+func TestCustomDeck(t *testing.T) {
+	deck := Deck{Queens: 8, Kings: 8, Aces: 8, Jokers: 6}
+	if err := deck.Validate(6); err != nil {
+		t.Fatal(err)
+	}
+	if err := DefaultDeck().Validate(6); err == nil {
+		t.Error("默认牌组不够6名玩家")
+	}
+
+	engine := NewEngine(1)
+	engine.SetDeck(deck)
+	engine.SetMaxPlayers(6)
+
+	seats := make([]Seat, 7)
+	for i := range seats {
+		seats[i] = Seat{ID: fmt.Sprintf("p%d", i), Name: fmt.Sprintf("玩家%d", i)}
+	}
+	if _, _, err := engine.Apply(nil, StartGame{Seats: seats, Settings: DefaultSettings()}); err != ErrTooManyPlayers {
+		t.Errorf("7名玩家开局: %v", err)
+	}
+
+	state, _, err := engine.Apply(nil, StartGame{Seats: seats[:6], Settings: DefaultSettings()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, card := range state.Deck {
+		counts[card]++
+	}
+	for _, player := range state.Players {
+		if len(player.Hand) != HandSize {
+			t.Errorf("%s 有 %d 张牌", player.Name, len(player.Hand))
+		}
+		for _, card := range player.Hand {
+			counts[card]++
+		}
+	}
+	want := map[string]int{CardQ: 8, CardK: 8, CardA: 8, CardJoker: 6}
+	if fmt.Sprint(counts) != fmt.Sprint(want) {
+		t.Errorf("牌组构成: %v", counts)
+	}
+}
+
+// TestEmote 表情只记入日志，不改变牌局
+func TestEmote(t *testing.T) {
+	engine := NewEngine(1)
+	seats := []Seat{{ID: "a", Name: "a"}, {ID: "b", Name: "b"}}
+	state, events, err := engine.Apply(nil, StartGame{Seats: seats, Settings: DefaultSettings()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, emitted, err := engine.Apply(state, Emote{PlayerID: "a", TargetID: "b", Emote: EmoteSuspicious})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != 1 || emitted[0].Type != EventEmote || emitted[0].PlayerID != "a" || emitted[0].TargetID != "b" || emitted[0].Emote != EmoteSuspicious {
+		t.Fatalf("表情事件: %+v", emitted)
+	}
+	if next.Seq != state.Seq+1 {
+		t.Errorf("序号应为 %d，实际 %d", state.Seq+1, next.Seq)
+	}
+
+	// 除了序号之外状态不变
+	unchanged := next.Clone()
+	unchanged.Seq = state.Seq
+	if encode(t, unchanged) != encode(t, state) {
+		t.Error("表情改变了牌局状态")
+	}
+
+	// 带表情的日志可以重放
+	replayed, err := Replay(append(events, emitted...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encode(t, replayed) != encode(t, next) {
+		t.Error("重放的状态与引擎给出的不一致")
+	}
+}
+
+// TestForfeitInLastRound 最后一轮中途有人认输不会提前按积分榜结束游戏
+func TestForfeitInLastRound(t *testing.T) {
+	engine := NewEngine(1)
+	seats := []Seat{{ID: "a", Name: "a"}, {ID: "b", Name: "b"}, {ID: "c", Name: "c"}}
+	settings := Settings{Mode: GameModeLives, StartingLives: 2, MaxRounds: 1, BestOf: 1}
+	state, _, err := engine.Apply(nil, StartGame{Seats: seats, Settings: settings})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaver := state.PlayerOrder[(state.CurrentPlayerIdx+1)%len(seats)]
+	next, _, err := engine.Apply(state, Forfeit{PlayerID: leaver})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.GameOver || next.RoundOver {
+		t.Errorf("认输后 GameOver=%v RoundOver=%v，应继续这一轮", next.GameOver, next.RoundOver)
+	}
+
+	// 再有一人认输，只剩一名玩家时立即获胜
+	current := next.CurrentPlayerID()
+	last, _, err := engine.Apply(next, Forfeit{PlayerID: current})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.GameOver || last.WinnerID == current || last.WinnerID == leaver {
+		t.Errorf("只剩一名玩家: GameOver=%v WinnerID=%q", last.GameOver, last.WinnerID)
+	}
+}
+
+// TestScoreboardOrder 有轮数上限时积分优先于命数，同分时先达到这个积分的玩家在前
+func TestScoreboardOrder(t *testing.T) {
+	state := NewState()
+	state.PlayerOrder = []string{"a", "b", "c", "d"}
+	state.Players = map[string]*Player{
+		"a": {ID: "a", Alive: true, Lives: 3, Score: 1, ScoredSeq: 4},
+		"b": {ID: "b", Alive: true, Lives: 2, Score: 2, ScoredSeq: 9},
+		"c": {ID: "c", Alive: true, Lives: 1, Score: 2, ScoredSeq: 7},
+		"d": {ID: "d", Alive: false, Lives: 0, Score: 5, ScoredSeq: 2},
+	}
+
+	order := func() string {
+		ids := ""
+		for _, entry := range state.Scoreboard() {
+			ids += entry.PlayerID
+		}
+		return ids
+	}
+
+	state.Settings = Settings{Mode: GameModeLives, StartingLives: 3}
+	if got := order(); got != "abcd" {
+		t.Errorf("不限轮数时按命数排序: %s", got)
+	}
+
+	state.Settings.MaxRounds = 5
+	if got := order(); got != "cbad" {
+		t.Errorf("有轮数上限时按积分排序，同分时先得分的在前: %s", got)
+	}
+
+	// 都没有得分时比命数
+	for _, player := range state.Players {
+		player.Score, player.ScoredSeq = 0, 0
+	}
+	if got := order(); got != "abcd" {
+		t.Errorf("都没有得分时按命数排序: %s", got)
+	}
+}
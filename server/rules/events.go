@@ -0,0 +1,214 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+)
+
+// 游戏事件类型
+const (
+	EventGameStarted       = "game_started"       // 开局：座位、规则和系列赛战绩
+	EventRevolverLoaded    = "revolver_loaded"    // 装弹（子弹位置对其他玩家隐藏）
+	EventCardsDealt        = "cards_dealt"        // 发牌
+	EventTargetChosen      = "target_chosen"      // 选定目标牌并开始新的一轮
+	EventCardsPlayed       = "cards_played"       // 出牌
+	EventChallengeDeclined = "challenge_declined" // 不质疑
+	EventChallengeResolved = "challenge_resolved" // 质疑（玩家或系统）结果
+	EventShotFired         = "shot_fired"         // 开枪
+	EventPlayerEliminated  = "player_eliminated"  // 玩家出局（中弹或认输）
+	EventTurnPassed        = "turn_passed"        // 因玩家离开而顺延出牌或质疑
+	EventRoundEnded        = "round_ended"        // 一轮结束，等待开始下一轮
+	EventGameWon           = "game_won"           // 决出胜者
+	EventEmote             = "emote"              // 玩家发出表情，不改变牌局
+)
+
+// 出局原因
+const (
+	EliminatedByShot    = "shot"
+	EliminatedByForfeit = "forfeit"
+)
+
+// Event 游戏事件，一局游戏的状态由事件日志依次折叠得到
+type Event struct {
+	Seq  int       `json:"seq"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	PlayerID string `json:"playerId,omitempty"` // 事件的主体玩家
+	TargetID string `json:"targetId,omitempty"` // 质疑者或下一位玩家
+
+	// 开局
+	GameNumber  int            `json:"gameNumber,omitempty"`
+	Settings    *Settings      `json:"settings,omitempty"`
+	PlayerOrder []string       `json:"playerOrder,omitempty"`
+	PlayerNames []string       `json:"playerNames,omitempty"`
+	MatchWins   map[string]int `json:"matchWins,omitempty"`
+
+	// 发牌与出牌
+	Hands map[string][]string `json:"hands,omitempty"`
+	Deck  []string            `json:"deck,omitempty"`
+	Cards []string            `json:"cards,omitempty"`
+	Card  string              `json:"card,omitempty"`
+	Round int                 `json:"round,omitempty"`
+
+	// 质疑
+	Reason  string `json:"reason,omitempty"`
+	Success bool   `json:"success,omitempty"`
+	System  bool   `json:"system,omitempty"`
+	Pending bool   `json:"pending,omitempty"` // 顺延后是否仍在等待质疑
+
+	// 开枪
+	Chamber int  `json:"chamber,omitempty"`
+	Bullet  int  `json:"bullet,omitempty"`
+	Hit     bool `json:"hit,omitempty"`
+
+	// 表情
+	Emote string `json:"emote,omitempty"`
+}
+
+// Apply 将一个事件折叠到状态上，不做任何校验
+func (s *State) Apply(ev Event) error {
+	switch ev.Type {
+	case EventGameStarted:
+		s.GameNumber = ev.GameNumber
+		s.Settings = *ev.Settings
+		s.MatchWins = make(map[string]int, len(ev.MatchWins))
+		for id, wins := range ev.MatchWins {
+			s.MatchWins[id] = wins
+		}
+		s.SeriesWinnerID = ""
+		s.GameOver = false
+		s.WinnerID = ""
+		s.FinishedAt = time.Time{}
+		s.RoundCount = 0
+		s.RoundOver = false
+		s.NextStarterID = ""
+		s.LastPlay = nil
+		s.AwaitingChallenge = false
+		s.TargetCard = ""
+		s.Deck = make([]string, 0)
+		s.Discards = make([]string, 0)
+
+		s.PlayerOrder = copyStrings(ev.PlayerOrder)
+		s.Players = make(map[string]*Player, len(ev.PlayerOrder))
+		for i, playerID := range ev.PlayerOrder {
+			s.Players[playerID] = &Player{
+				ID:    playerID,
+				Name:  ev.PlayerNames[i],
+				Hand:  make([]string, 0),
+				Alive: true,
+				Lives: ev.Settings.StartingLives,
+			}
+		}
+
+	case EventRevolverLoaded:
+		player := s.Players[ev.PlayerID]
+		player.BulletPosition = ev.Bullet
+		player.CurrentBulletPosition = 0
+
+	case EventCardsDealt:
+		for _, player := range s.Players {
+			if player.Alive {
+				player.Hand = copyStrings(ev.Hands[player.ID])
+			}
+		}
+		s.Deck = copyStrings(ev.Deck)
+		s.Discards = make([]string, 0)
+
+	case EventTargetChosen:
+		s.TargetCard = ev.Card
+		s.RoundCount = ev.Round
+		s.RoundOver = false
+		s.NextStarterID = ""
+		s.CurrentPlayerIdx = s.SeatIndex(ev.PlayerID)
+		s.LastPlay = nil
+		s.AwaitingChallenge = false
+
+	case EventCardsPlayed:
+		player := s.Players[ev.PlayerID]
+		player.Hand, _ = removeCards(player.Hand, ev.Cards)
+		s.Discards = append(s.Discards, ev.Cards...)
+		s.LastPlay = &Play{
+			PlayerID:     ev.PlayerID,
+			Cards:        copyStrings(ev.Cards),
+			Remaining:    copyStrings(player.Hand),
+			NextPlayerID: ev.TargetID,
+		}
+		if _, ok := s.Players[ev.TargetID]; ok {
+			s.CurrentPlayerIdx = s.SeatIndex(ev.TargetID)
+			s.AwaitingChallenge = true
+		}
+
+	case EventChallengeDeclined:
+		s.AwaitingChallenge = false
+
+	case EventChallengeResolved:
+		s.AwaitingChallenge = false
+		// 玩家之间的质疑，赢的一方得一分：质疑成功时质疑者赢，失败时出牌者赢
+		if !ev.System {
+			winnerID := ev.PlayerID
+			if ev.Success {
+				winnerID = ev.TargetID
+			}
+			s.Players[winnerID].Score++
+			s.Players[winnerID].ScoredSeq = ev.Seq
+		}
+
+	case EventShotFired:
+		player := s.Players[ev.PlayerID]
+		player.CurrentBulletPosition = ev.Chamber
+		if ev.Hit {
+			player.Lives--
+		}
+
+	case EventPlayerEliminated:
+		player := s.Players[ev.PlayerID]
+		player.Alive = false
+		s.Discards = append(s.Discards, player.Hand...)
+		player.Hand = make([]string, 0)
+		if ev.Reason == EliminatedByForfeit {
+			player.Lives = 0
+		}
+
+	case EventTurnPassed:
+		if ev.PlayerID != "" {
+			s.CurrentPlayerIdx = s.SeatIndex(ev.PlayerID)
+		}
+		s.AwaitingChallenge = ev.Pending
+
+	case EventRoundEnded:
+		s.RoundOver = true
+		s.NextStarterID = ev.PlayerID
+		s.AwaitingChallenge = false
+
+	case EventGameWon:
+		s.GameOver = true
+		s.WinnerID = ev.PlayerID
+		s.AwaitingChallenge = false
+		s.FinishedAt = ev.Time
+		s.MatchWins[ev.PlayerID]++
+		if s.MatchWins[ev.PlayerID] >= s.Settings.WinsNeeded() {
+			s.SeriesWinnerID = ev.PlayerID
+		}
+
+	case EventEmote:
+		// 表情只记入日志
+
+	default:
+		return fmt.Errorf("未知的游戏事件: %s", ev.Type)
+	}
+
+	s.Seq = ev.Seq
+	return nil
+}
+
+// Replay 依次重放事件日志，重建一局游戏的状态
+func Replay(events []Event) (*State, error) {
+	state := NewState()
+	for _, ev := range events {
+		if err := state.Apply(ev); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
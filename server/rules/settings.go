@@ -0,0 +1,74 @@
+package rules
+
+import "errors"
+
+// 游戏模式
+const (
+	GameModeSuddenDeath = "sudden_death" // 中弹即出局
+	GameModeLives       = "lives"        // 中弹扣除一条命，命数耗尽才出局
+)
+
+// 规则取值范围
+const (
+	DefaultStartingLives = 3   // 生命模式默认初始命数
+	MaxStartingLives     = 10  // 生命模式最大初始命数
+	MaxRoundsLimit       = 100 // 最大轮数上限
+	MaxBestOf            = 9   // 系列赛最多局数
+)
+
+// Settings 牌桌规则设置
+type Settings struct {
+	Mode          string `json:"mode"`          // 游戏模式
+	StartingLives int    `json:"startingLives"` // 初始命数（中弹即出局模式固定为1）
+	MaxRounds     int    `json:"maxRounds"`     // 最大轮数，达到后积分最高者获胜，0表示不限
+	BestOf        int    `json:"bestOf"`        // 系列赛局数（N局多胜），1表示单局
+}
+
+// DefaultSettings 返回默认规则（中弹即出局）
+func DefaultSettings() Settings {
+	return Settings{
+		Mode:          GameModeSuddenDeath,
+		StartingLives: 1,
+		MaxRounds:     0,
+		BestOf:        1,
+	}
+}
+
+// WinsNeeded 赢得系列赛所需的胜局数
+func (s Settings) WinsNeeded() int {
+	return s.BestOf/2 + 1
+}
+
+// Validate 校验规则设置并补全默认值
+func (s *Settings) Validate() error {
+	if s.BestOf == 0 {
+		s.BestOf = 1
+	}
+	if s.BestOf < 1 || s.BestOf > MaxBestOf {
+		return errors.New("系列赛局数超出范围")
+	}
+
+	switch s.Mode {
+	case "", GameModeSuddenDeath:
+		// 中弹即出局等同于只有一条命且不限轮数
+		s.Mode = GameModeSuddenDeath
+		s.StartingLives = 1
+		s.MaxRounds = 0
+		return nil
+
+	case GameModeLives:
+		if s.StartingLives == 0 {
+			s.StartingLives = DefaultStartingLives
+		}
+		if s.StartingLives < 1 || s.StartingLives > MaxStartingLives {
+			return errors.New("初始命数超出范围")
+		}
+		if s.MaxRounds < 0 || s.MaxRounds > MaxRoundsLimit {
+			return errors.New("最大轮数超出范围")
+		}
+		return nil
+
+	default:
+		return errors.New("未知的游戏模式")
+	}
+}
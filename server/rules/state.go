@@ -0,0 +1,269 @@
+package rules
+
+import (
+	"sort"
+	"time"
+)
+
+// 玩家人数限制，每桌最多人数可以通过 Engine.SetMaxPlayers 调整
+const (
+	MinPlayers = 2
+	MaxPlayers = 4
+)
+
+// 卡牌类型
+const (
+	CardQ     = "Q"
+	CardK     = "K"
+	CardA     = "A"
+	CardJoker = "Joker"
+)
+
+// 每轮每位玩家的手牌数和左轮的弹仓数
+const (
+	HandSize = 5
+	Chambers = 6
+)
+
+// State 一局游戏的状态，由事件日志依次折叠得到
+type State struct {
+	Seq               int                `json:"seq"`        // 最近一个事件的序号
+	GameNumber        int                `json:"gameNumber"` // 系列赛中的第几局
+	Settings          Settings           `json:"settings"`
+	PlayerOrder       []string           `json:"playerOrder"`
+	Players           map[string]*Player `json:"players"`
+	Deck              []string           `json:"deck"`
+	Discards          []string           `json:"discards"` // 这一轮打出和出局时弃掉的牌
+	TargetCard        string             `json:"targetCard"`
+	CurrentPlayerIdx  int                `json:"currentPlayerIdx"`
+	LastPlay          *Play              `json:"lastPlay,omitempty"` // 最近一次出牌
+	AwaitingChallenge bool               `json:"awaitingChallenge"`  // 是否在等待当前玩家决定质疑
+	RoundCount        int                `json:"roundCount"`
+	RoundOver         bool               `json:"roundOver"`               // 一轮已结束，等待开始下一轮
+	NextStarterID     string             `json:"nextStarterId,omitempty"` // 下一轮从谁开始，为空则随机
+	GameOver          bool               `json:"gameOver"`
+	WinnerID          string             `json:"winnerId,omitempty"`
+	MatchWins         map[string]int     `json:"matchWins"`                // 系列赛中每位玩家的胜局数
+	SeriesWinnerID    string             `json:"seriesWinnerId,omitempty"` // 系列赛胜利者
+	FinishedAt        time.Time          `json:"finishedAt,omitempty"`
+}
+
+// Player 玩家在一局游戏中的状态
+type Player struct {
+	ID                    string   `json:"id"`
+	Name                  string   `json:"name"`
+	Hand                  []string `json:"hand"`
+	Alive                 bool     `json:"alive"`
+	Lives                 int      `json:"lives"`                 // 剩余命数
+	Score                 int      `json:"score"`                 // 赢得质疑的积分
+	ScoredSeq             int      `json:"scoredSeq,omitempty"`   // 最近一次得分的事件序号，同分时先达到的排在前面
+	BulletPosition        int      `json:"bulletPosition"`        // 子弹所在的弹仓
+	CurrentBulletPosition int      `json:"currentBulletPosition"` // 当前转到的弹仓
+}
+
+// Play 一次出牌
+type Play struct {
+	PlayerID     string   `json:"playerId"`
+	Cards        []string `json:"cards"`
+	Remaining    []string `json:"remaining"`
+	NextPlayerID string   `json:"nextPlayerId,omitempty"` // 被询问是否质疑的玩家，为空表示由系统质疑
+}
+
+// ScoreEntry 积分榜中的一行
+type ScoreEntry struct {
+	PlayerID   string `json:"playerId"`
+	PlayerName string `json:"playerName"`
+	Lives      int    `json:"lives"`
+	Score      int    `json:"score"`
+	Alive      bool   `json:"alive"`
+	ScoredSeq  int    `json:"-"` // 最近一次得分的事件序号，只用于排序
+}
+
+// NewState 创建一个还没有开局的空状态
+func NewState() *State {
+	return &State{
+		PlayerOrder: make([]string, 0),
+		Players:     make(map[string]*Player),
+		Deck:        make([]string, 0),
+		Discards:    make([]string, 0),
+		MatchWins:   make(map[string]int),
+	}
+}
+
+// Clone 深拷贝状态，引擎在拷贝上执行动作，不修改调用方持有的状态
+func (s *State) Clone() *State {
+	clone := *s
+	clone.PlayerOrder = copyStrings(s.PlayerOrder)
+	clone.Deck = copyStrings(s.Deck)
+	clone.Discards = copyStrings(s.Discards)
+
+	clone.Players = make(map[string]*Player, len(s.Players))
+	for id, player := range s.Players {
+		p := *player
+		p.Hand = copyStrings(player.Hand)
+		clone.Players[id] = &p
+	}
+
+	clone.MatchWins = make(map[string]int, len(s.MatchWins))
+	for id, wins := range s.MatchWins {
+		clone.MatchWins[id] = wins
+	}
+
+	if s.LastPlay != nil {
+		play := *s.LastPlay
+		play.Cards = copyStrings(s.LastPlay.Cards)
+		play.Remaining = copyStrings(s.LastPlay.Remaining)
+		clone.LastPlay = &play
+	}
+
+	return &clone
+}
+
+// Playing 检查是否有一局正在进行
+func (s *State) Playing() bool {
+	return len(s.PlayerOrder) > 0 && !s.GameOver
+}
+
+// CurrentPlayerID 获取当前玩家ID
+func (s *State) CurrentPlayerID() string {
+	if s.CurrentPlayerIdx >= 0 && s.CurrentPlayerIdx < len(s.PlayerOrder) {
+		return s.PlayerOrder[s.CurrentPlayerIdx]
+	}
+	return ""
+}
+
+// SeatIndex 返回玩家在出牌顺序中的位置
+func (s *State) SeatIndex(playerID string) int {
+	for i, id := range s.PlayerOrder {
+		if id == playerID {
+			return i
+		}
+	}
+	return -1
+}
+
+// Scoreboard 生成积分榜，有轮数上限时按积分排序，否则按剩余命数排序，详见 SortScores
+func (s *State) Scoreboard() []ScoreEntry {
+	entries := make([]ScoreEntry, 0, len(s.PlayerOrder))
+	for _, playerID := range s.PlayerOrder {
+		player := s.Players[playerID]
+		entries = append(entries, ScoreEntry{
+			PlayerID:   playerID,
+			PlayerName: player.Name,
+			Lives:      player.Lives,
+			Score:      player.Score,
+			Alive:      player.Alive,
+			ScoredSeq:  player.ScoredSeq,
+		})
+	}
+
+	SortScores(entries, s.Settings.MaxRounds > 0)
+	return entries
+}
+
+// SortScores 排序积分榜，存活的玩家总在前面
+// byScore 为 true 时（有轮数上限的游戏，达到上限时积分最高者获胜）比积分，同分时先达到这个积分的玩家在前，再比剩余命数；
+// 否则先比剩余命数再比积分和得分先后；全部相同（都没有得分且命数相同）时保持原有顺序
+func SortScores(entries []ScoreEntry, byScore bool) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Alive != b.Alive {
+			return a.Alive
+		}
+		if !byScore && a.Lives != b.Lives {
+			return a.Lives > b.Lives
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.ScoredSeq != b.ScoredSeq {
+			return a.ScoredSeq < b.ScoredSeq
+		}
+		return a.Lives > b.Lives
+	})
+}
+
+// alivePlayers 返回存活玩家的位置，按座位顺序排列
+func (s *State) alivePlayers() []int {
+	alive := make([]int, 0, len(s.PlayerOrder))
+	for i, id := range s.PlayerOrder {
+		if s.Players[id].Alive {
+			alive = append(alive, i)
+		}
+	}
+	return alive
+}
+
+// nextPlayerWithCards 找到下一个有手牌的存活玩家，没有时返回 startIdx
+func (s *State) nextPlayerWithCards(startIdx int) int {
+	idx := startIdx
+	for i := 0; i < len(s.PlayerOrder); i++ {
+		idx = (idx + 1) % len(s.PlayerOrder)
+		player := s.Players[s.PlayerOrder[idx]]
+		if player.Alive && len(player.Hand) > 0 {
+			return idx
+		}
+	}
+	return startIdx
+}
+
+// nextAlivePlayer 找到下一个存活的玩家，没有时返回 -1
+func (s *State) nextAlivePlayer(startIdx int) int {
+	idx := startIdx
+	for i := 0; i < len(s.PlayerOrder); i++ {
+		idx = (idx + 1) % len(s.PlayerOrder)
+		if s.Players[s.PlayerOrder[idx]].Alive {
+			return idx
+		}
+	}
+	return -1
+}
+
+// othersHaveNoCards 检查是否所有其他存活玩家都没有手牌
+func (s *State) othersHaveNoCards(playerID string) bool {
+	for id, player := range s.Players {
+		if id != playerID && player.Alive && len(player.Hand) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidPlay 判断出牌是否符合目标牌
+func (s *State) isValidPlay(cards []string) bool {
+	return IsValidPlay(cards, s.TargetCard)
+}
+
+// IsValidPlay 判断打出的牌是否都是目标牌或王牌，即这次出牌是否诚实
+func IsValidPlay(cards []string, targetCard string) bool {
+	for _, card := range cards {
+		if card != targetCard && card != CardJoker {
+			return false
+		}
+	}
+	return true
+}
+
+// copyStrings 拷贝切片，空切片拷贝后仍为空切片而不是nil，序列化时保持为[]
+func copyStrings(cards []string) []string {
+	return append(make([]string, 0, len(cards)), cards...)
+}
+
+// removeCards 从手牌中移除打出的牌，返回剩余的牌和是否全部找到
+func removeCards(hand []string, cards []string) ([]string, bool) {
+	remaining := copyStrings(hand)
+	for _, card := range cards {
+		found := false
+		for i, handCard := range remaining {
+			if handCard == card {
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return remaining, false
+		}
+	}
+	return remaining, true
+}
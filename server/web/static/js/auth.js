@@ -38,6 +38,31 @@ const Auth = {
         return !!this.token;
     },
 
+    // 返回本浏览器的身份令牌，第一次使用时向服务器申请
+    // 令牌由服务器签发，战绩按令牌统计到匿名的浏览器档案（不是账号），所以登出和重新登录都不更换令牌
+    identityToken: async function() {
+        let token = localStorage.getItem('identityToken');
+        if (!token) {
+            token = await this.renewIdentity();
+        }
+        return token;
+    },
+
+    // 向服务器申请新的身份令牌，服务器更换密钥后旧令牌失效时使用
+    renewIdentity: async function() {
+        const response = await fetch('/api/identity', { method: 'POST' });
+        if (!response.ok) {
+            throw new Error('申请身份失败: ' + response.status);
+        }
+        const data = await response.json();
+        localStorage.setItem('identityToken', data.token);
+        if (this.token) {
+            this.token = data.token;
+            this.saveToStorage();
+        }
+        return data.token;
+    },
+
     // 登录
     login: async function(username, password) {
         try {
@@ -55,7 +80,7 @@ const Auth = {
             // 模拟成功响应
             const data = {
                 success: true,
-                token: 'mock-jwt-token-' + Math.random().toString(36).substring(2),
+                token: await this.identityToken(),
                 userId: 'user-' + Math.random().toString(36).substring(2),
                 username: username
             };
@@ -121,6 +146,7 @@ document.addEventListener('DOMContentLoaded', function() {
         document.getElementById('auth-screen').classList.add('hidden');
         document.getElementById('lobby-screen').classList.remove('hidden');
         document.getElementById('user-name').textContent = Auth.username;
+        Lobby.showStats();
     }
 
     // 登录按钮事件
@@ -139,6 +165,7 @@ document.addEventListener('DOMContentLoaded', function() {
             document.getElementById('auth-screen').classList.add('hidden');
             document.getElementById('lobby-screen').classList.remove('hidden');
             document.getElementById('user-name').textContent = Auth.username;
+            Lobby.showStats();
         } else {
             alert(result.message);
         }
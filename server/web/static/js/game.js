@@ -6,6 +6,19 @@ const Game = {
     playerId: null,
     gameState: null,
     selectedCards: [],
+    mutedPlayers: {},
+    
+    // 服务器接受的表情及显示的图标和说明
+    emotes: {
+        laugh: { icon: '😂', label: '大笑' },
+        suspicious: { icon: '🤨', label: '怀疑' },
+        sweat: { icon: '😅', label: '冒汗' },
+        confident: { icon: '😎', label: '自信' },
+        angry: { icon: '😠', label: '生气' },
+        cry: { icon: '😭', label: '哭' },
+        think: { icon: '🤔', label: '思考' },
+        clap: { icon: '👏', label: '鼓掌' }
+    },
     
     // 初始化游戏
     init: function(gameId, playerId) {
@@ -71,6 +84,26 @@ const Game = {
             this.sendChallenge(false, reason);
             document.getElementById('challenge-container').classList.add('hidden');
         });
+        
+        // 聊天发送按钮和回车键
+        document.getElementById('chat-send-btn').addEventListener('click', () => this.sendChat());
+        document.getElementById('chat-input').addEventListener('keydown', (event) => {
+            if (event.key === 'Enter') {
+                this.sendChat();
+            }
+        });
+        
+        // 表情按钮
+        const emoteButtons = document.getElementById('emote-buttons');
+        emoteButtons.innerHTML = '';
+        for (const emote in this.emotes) {
+            const button = document.createElement('button');
+            button.className = 'btn emote-btn';
+            button.textContent = this.emotes[emote].icon;
+            button.title = this.emotes[emote].label;
+            button.addEventListener('click', () => this.sendEmote(emote));
+            emoteButtons.appendChild(button);
+        }
     },
     
     // WebSocket连接打开时的处理函数
@@ -128,6 +161,52 @@ const Game = {
             case 'error':
                 this.handleError(message);
                 break;
+                
+            case 'system_message':
+                this.addLogEntry(`系统消息: ${message.message}`);
+                break;
+                
+            case 'chat':
+                this.addChatEntry(message.message);
+                break;
+                
+            case 'chat_history':
+                document.getElementById('chat-container').innerHTML = '';
+                message.messages.forEach(entry => this.addChatEntry(entry));
+                break;
+                
+            case 'emote':
+                this.addEmoteEntry(message);
+                break;
+                
+            case 'mute_updated':
+                this.mutedPlayers[message.playerId] = message.muted;
+                this.updateOtherPlayers();
+                break;
+                
+            case 'countdown':
+                document.getElementById('game-status-text').textContent = `游戏将在 ${message.seconds} 秒后开始`;
+                break;
+                
+            case 'countdown_cancelled':
+                this.addLogEntry(`倒计时取消: ${message.reason}`);
+                break;
+                
+            case 'rematch_status':
+                this.handleRematchStatus(message);
+                break;
+                
+            case 'host_changed':
+                this.addLogEntry(`${message.playerName} 成为房主`);
+                break;
+                
+            case 'player_kicked':
+                this.addLogEntry(`${message.playerName} 被移出游戏`);
+                break;
+                
+            case 'kicked':
+                this.handleKicked(message);
+                break;
         }
     },
     
@@ -166,6 +245,18 @@ const Game = {
         }
         document.getElementById('game-status-text').textContent = statusText;
         
+        // 再来一局开始后回到游戏界面
+        if (state.state === 'starting' || state.state === 'playing') {
+            document.getElementById('game-over-screen').classList.add('hidden');
+            document.getElementById('game-screen').classList.remove('hidden');
+        }
+        
+        // 开始前可以切换准备状态
+        const me = state.players ? state.players[this.playerId] : null;
+        const readyButton = document.getElementById('ready-btn');
+        readyButton.classList.toggle('hidden', !me || (state.state !== 'waiting' && state.state !== 'starting'));
+        readyButton.textContent = me && me.ready ? '取消准备' : '准备';
+        
         // 更新目标牌
         if (state.targetCard) {
             document.getElementById('target-card').textContent = state.targetCard;
@@ -219,6 +310,11 @@ const Game = {
         const otherPlayersElement = document.getElementById('other-players');
         otherPlayersElement.innerHTML = '';
         
+        // 表情的目标只能是其他玩家，保留之前的选择
+        const emoteTarget = document.getElementById('emote-target');
+        const selectedTarget = emoteTarget.value;
+        emoteTarget.innerHTML = '<option value="">对全桌</option>';
+        
         // 创建其他玩家信息
         for (const playerId in this.gameState.players) {
             if (playerId === this.playerId) continue; // 跳过当前玩家
@@ -242,8 +338,108 @@ const Game = {
                 <div class="player-cards">手牌数量: ${player.handCount || 0}</div>
             `;
             
+            // 开始前显示准备状态和房主
+            if (this.gameState.state === 'waiting' || this.gameState.state === 'starting') {
+                const statusElement = document.createElement('div');
+                statusElement.className = 'player-ready';
+                statusElement.textContent = playerId === this.gameState.hostId ? '房主' : (player.ready ? '已准备' : '未准备');
+                playerElement.appendChild(statusElement);
+            }
+            
+            // 房主可以在开始前踢出玩家，随时转让房主
+            if (this.isHost()) {
+                if (this.gameState.state !== 'playing') {
+                    const kickButton = document.createElement('button');
+                    kickButton.className = 'btn small';
+                    kickButton.textContent = '踢出';
+                    kickButton.addEventListener('click', () => this.sendHostAction('kick_player', playerId));
+                    playerElement.appendChild(kickButton);
+                }
+                
+                const transferButton = document.createElement('button');
+                transferButton.className = 'btn small';
+                transferButton.textContent = '转让房主';
+                transferButton.addEventListener('click', () => this.sendHostAction('transfer_host', playerId));
+                playerElement.appendChild(transferButton);
+            }
+            
+            // 屏蔽或取消屏蔽该玩家的聊天
+            const muteButton = document.createElement('button');
+            muteButton.className = 'btn mute-btn';
+            muteButton.textContent = this.mutedPlayers[playerId] ? '取消屏蔽' : '屏蔽聊天';
+            muteButton.addEventListener('click', () => {
+                this.socket.send(JSON.stringify({
+                    type: 'mute_player',
+                    playerId: playerId,
+                    muted: !this.mutedPlayers[playerId]
+                }));
+            });
+            playerElement.appendChild(muteButton);
+            
             otherPlayersElement.appendChild(playerElement);
+            
+            const option = document.createElement('option');
+            option.value = playerId;
+            option.textContent = `对 ${player.name}`;
+            emoteTarget.appendChild(option);
         }
+        emoteTarget.value = this.gameState.players[selectedTarget] ? selectedTarget : '';
+    },
+    
+    // 发送聊天消息
+    sendChat: function() {
+        const input = document.getElementById('chat-input');
+        const text = input.value.trim();
+        if (!text || !this.socket) return;
+        
+        this.socket.send(JSON.stringify({ type: 'chat', text: text }));
+        input.value = '';
+    },
+    
+    // 发送表情，选择了玩家时对该玩家
+    sendEmote: function(emote) {
+        if (!this.socket) return;
+        
+        const message = { type: 'emote', emote: emote };
+        const target = document.getElementById('emote-target').value;
+        if (target) {
+            message.playerId = target;
+        }
+        this.socket.send(JSON.stringify(message));
+    },
+    
+    // 在聊天记录中显示一个表情
+    addEmoteEntry: function(message) {
+        const emote = this.emotes[message.emote];
+        if (!emote) return;
+        
+        const chatContainer = document.getElementById('chat-container');
+        const entryElement = document.createElement('div');
+        entryElement.className = 'chat-entry emote';
+        const target = message.targetName ? `对 ${message.targetName} ` : '';
+        entryElement.textContent = `${message.playerName} ${target}${emote.icon} ${emote.label}`;
+        
+        chatContainer.appendChild(entryElement);
+        chatContainer.scrollTop = chatContainer.scrollHeight;
+    },
+    
+    // 添加一条聊天记录，出局频道的消息单独标出
+    addChatEntry: function(entry) {
+        const chatContainer = document.getElementById('chat-container');
+        const entryElement = document.createElement('div');
+        entryElement.className = 'chat-entry';
+        if (entry.channel === 'out') {
+            entryElement.classList.add('out');
+        }
+        
+        const nameElement = document.createElement('span');
+        nameElement.className = 'chat-name';
+        nameElement.textContent = entry.channel === 'out' ? `[出局] ${entry.playerName}: ` : `${entry.playerName}: `;
+        entryElement.appendChild(nameElement);
+        entryElement.appendChild(document.createTextNode(entry.text));
+        
+        chatContainer.appendChild(entryElement);
+        chatContainer.scrollTop = chatContainer.scrollHeight;
     },
     
     // 切换卡牌选择状态
@@ -365,7 +561,4 @@ const Game = {
         
         this.addLogEntry(logText);
     },
-    
-    // 处理系统自动质疑
-    handleSystemChallenge: function(message) {
-        let logText = `系统自动质疑 ${message.playerName} 的手牌！`
\ No newline at end of file
+};
@@ -15,13 +15,15 @@ Game.handleSystemChallenge = function(message) {
     this.addLogEntry(logText);
 };
 
-// 处理游戏结束
+// 处理游戏结束，保持连接以便再来一局
 Game.handleGameOver = function(message) {
     // 更新游戏状态
     document.getElementById('game-status-text').textContent = '游戏已结束';
     
     // 显示胜利者信息
     document.getElementById('winner-name').textContent = message.winnerName;
+    document.getElementById('rematch-status').textContent = '';
+    document.getElementById('rematch-btn').disabled = false;
     
     // 切换到游戏结束界面
     document.getElementById('game-screen').classList.add('hidden');
@@ -29,9 +31,25 @@ Game.handleGameOver = function(message) {
     
     // 添加日志
     this.addLogEntry(`游戏结束！${message.winnerName} 获胜！`);
-    
-    // 断开WebSocket连接
+};
+
+// 显示再来一局的同意情况
+Game.handleRematchStatus = function(message) {
+    document.getElementById('rematch-status').textContent =
+        `${message.playerName} ${message.accept ? '同意' : '不同意'}再来一局（${message.accepted.length}/${message.total}）`;
+};
+
+// 被房主踢出后回到大厅
+Game.handleKicked = function(message) {
+    alert(message.message || '你已被移出游戏');
     this.disconnect();
+    
+    document.getElementById('game-screen').classList.add('hidden');
+    document.getElementById('game-over-screen').classList.add('hidden');
+    document.getElementById('lobby-screen').classList.remove('hidden');
+    
+    localStorage.removeItem('currentGameId');
+    localStorage.removeItem('currentPlayerId');
 };
 
 // 处理错误消息
@@ -105,10 +123,58 @@ Game.startGame = function() {
     }));
 };
 
-// 检查是否可以开始游戏（至少2名玩家）
+// 切换准备状态
+Game.toggleReady = function() {
+    if (!this.socket || this.socket.readyState !== WebSocket.OPEN) {
+        this.addLogEntry('无法准备：与服务器的连接已断开');
+        return;
+    }
+    
+    const me = this.gameState && this.gameState.players ? this.gameState.players[this.playerId] : null;
+    this.socket.send(JSON.stringify({
+        type: 'ready',
+        ready: !(me && me.ready)
+    }));
+};
+
+// 同意再来一局
+Game.requestRematch = function() {
+    if (!this.socket || this.socket.readyState !== WebSocket.OPEN) {
+        this.addLogEntry('无法再来一局：与服务器的连接已断开');
+        return;
+    }
+    
+    this.socket.send(JSON.stringify({
+        type: 'rematch',
+        accept: true
+    }));
+};
+
+// 房主踢出玩家或转让房主
+Game.sendHostAction = function(type, playerId) {
+    if (!this.socket || this.socket.readyState !== WebSocket.OPEN) {
+        this.addLogEntry('操作失败：与服务器的连接已断开');
+        return;
+    }
+    
+    this.socket.send(JSON.stringify({
+        type: type,
+        playerId: playerId
+    }));
+};
+
+// 检查自己是否是房主
+Game.isHost = function() {
+    return !!this.gameState && this.gameState.hostId === this.playerId;
+};
+
+// 检查是否可以开始游戏：房主、至少2名玩家且其他玩家都已准备，房主开始时自动准备
 Game.canStartGame = function() {
-    if (!this.gameState || !this.gameState.players) return false;
-    return Object.keys(this.gameState.players).length >= 2;
+    if (!this.isHost() || !this.gameState.players) return false;
+    
+    const playerIds = Object.keys(this.gameState.players);
+    return playerIds.length >= 2 &&
+        playerIds.every(id => id === this.playerId || this.gameState.players[id].ready);
 };
 
 // 自动重连
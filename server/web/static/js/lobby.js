@@ -1,23 +1,25 @@
 // lobby.js - 处理游戏大厅相关功能
 
 const Lobby = {
-    // 创建新游戏
-    createGame: async function() {
+    // 创建新游戏，创建者直接入座成为房主
+    createGame: async function(playerName) {
         try {
             const response = await fetch('/api/games', {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
                     'Authorization': `Bearer ${Auth.token}`
-                }
+                },
+                body: JSON.stringify({ playerName })
             });
             
+            // 成功和失败都返回JSON，失败时带有 code 和 message
             const data = await response.json();
             
             if (data.gameId) {
-                return { success: true, gameId: data.gameId };
+                return { success: true, gameId: data.gameId, playerId: data.playerId };
             } else {
-                return { success: false, message: '创建游戏失败' };
+                return { success: false, message: data.message || '创建游戏失败' };
             }
         } catch (error) {
             console.error('创建游戏错误:', error);
@@ -50,6 +52,62 @@ const Lobby = {
         }
     },
     
+    // 获取自己的战绩，还没有打完过一局时返回 null
+    getStats: async function() {
+        try {
+            let response = await fetch('/api/players/me/stats', {
+                headers: { 'Authorization': `Bearer ${Auth.token}` }
+            });
+            // 令牌已失效（服务器更换了身份密钥）时申请新的身份
+            if (response.status === 401) {
+                await Auth.renewIdentity();
+                response = await fetch('/api/players/me/stats', {
+                    headers: { 'Authorization': `Bearer ${Auth.token}` }
+                });
+            }
+            if (!response.ok) {
+                return null;
+            }
+            return await response.json();
+        } catch (error) {
+            console.error('获取战绩错误:', error);
+            return null;
+        }
+    },
+    
+    // 显示自己的战绩
+    showStats: async function() {
+        const stats = await this.getStats();
+        const container = document.getElementById('stats-container');
+        if (!stats) {
+            container.textContent = '还没有打完过一局';
+            return;
+        }
+        
+        const rows = [
+            ['局数', stats.gamesPlayed],
+            ['胜场', stats.wins],
+            ['中弹出局', stats.eliminations],
+            ['开枪幸存', stats.shotsSurvived],
+            ['说谎次数', stats.liesTold],
+            ['被拆穿', stats.timesCaughtLying],
+            ['质疑成功', `${stats.liesCaught} / ${stats.challenges}`],
+            ['质疑准确率', `${Math.round(stats.challengeAccuracy * 100)}%`]
+        ];
+        container.innerHTML = '';
+        rows.forEach(([label, value]) => {
+            const row = document.createElement('div');
+            row.className = 'stats-row';
+            const labelElement = document.createElement('span');
+            labelElement.textContent = label;
+            const valueElement = document.createElement('span');
+            valueElement.textContent = value;
+            row.appendChild(labelElement);
+            row.appendChild(valueElement);
+            container.appendChild(row);
+        });
+    },
+    
     // 获取可用游戏列表（在实际应用中应该实现）
     getAvailableGames: async function() {
         // 这里应该调用API获取游戏列表
@@ -62,28 +120,19 @@ const Lobby = {
 document.addEventListener('DOMContentLoaded', function() {
     // 创建游戏按钮事件
     document.getElementById('create-game-btn').addEventListener('click', async function() {
-        const result = await Lobby.createGame();
+        const result = await Lobby.createGame(Auth.username);
         
         if (result.success) {
-            // 保存游戏ID
+            // 创建时已入座，保存游戏ID和玩家ID
             localStorage.setItem('currentGameId', result.gameId);
+            localStorage.setItem('currentPlayerId', result.playerId);
             
-            // 加入自己创建的游戏
-            const joinResult = await Lobby.joinGame(result.gameId, Auth.username);
+            // 切换到游戏界面
+            document.getElementById('lobby-screen').classList.add('hidden');
+            document.getElementById('game-screen').classList.remove('hidden');
             
-            if (joinResult.success) {
-                // 保存玩家ID
-                localStorage.setItem('currentPlayerId', joinResult.playerId);
-                
-                // 切换到游戏界面
-                document.getElementById('lobby-screen').classList.add('hidden');
-                document.getElementById('game-screen').classList.remove('hidden');
-                
-                // 初始化游戏
-                Game.init(result.gameId, joinResult.playerId);
-            } else {
-                alert(joinResult.message);
-            }
+            // 初始化游戏
+            Game.init(result.gameId, result.playerId);
         } else {
             alert(result.message);
         }
@@ -117,10 +166,16 @@ document.addEventListener('DOMContentLoaded', function() {
         }
     });
     
-    // 返回大厅按钮事件（游戏结束界面）
+    // 返回大厅按钮事件（游戏结束界面），离开牌桌不再参加再来一局
     document.getElementById('back-to-lobby-btn').addEventListener('click', function() {
+        if (Game.socket && Game.socket.readyState === WebSocket.OPEN) {
+            Game.socket.send(JSON.stringify({ type: 'leave_game' }));
+        }
+        Game.disconnect();
+        
         document.getElementById('game-over-screen').classList.add('hidden');
         document.getElementById('lobby-screen').classList.remove('hidden');
+        Lobby.showStats();
         
         // 清除当前游戏信息
         localStorage.removeItem('currentGameId');
@@ -129,6 +184,11 @@ document.addEventListener('DOMContentLoaded', function() {
     
     // 离开游戏按钮事件
     document.getElementById('leave-game-btn').addEventListener('click', function() {
+        // 通知服务器离开游戏（游戏进行中视为认输）
+        if (Game.socket && Game.socket.readyState === WebSocket.OPEN) {
+            Game.socket.send(JSON.stringify({ type: 'leave_game' }));
+        }
+        
         // 关闭WebSocket连接
         Game.disconnect();
         
@@ -12,6 +12,7 @@ document.addEventListener('DOMContentLoaded', function() {
         document.getElementById('auth-screen').classList.add('hidden');
         document.getElementById('lobby-screen').classList.remove('hidden');
         document.getElementById('user-name').textContent = Auth.username;
+        Lobby.showStats();
     }
     
     // 添加开始游戏按钮事件（当有足够玩家时显示）
@@ -30,6 +31,15 @@ document.addEventListener('DOMContentLoaded', function() {
         this.style.display = 'none';
     });
     
+    // 准备和再来一局按钮
+    document.getElementById('ready-btn').addEventListener('click', function() {
+        Game.toggleReady();
+    });
+    document.getElementById('rematch-btn').addEventListener('click', function() {
+        Game.requestRematch();
+        this.disabled = true;
+    });
+    
     // 定期检查是否可以开始游戏
     setInterval(function() {
         if (Game.canStartGame() && Game.gameState && Game.gameState.state === 'waiting') {
@@ -0,0 +1,128 @@
+// Package web 提供网页客户端：默认使用编译进二进制的静态文件，开发时可以直接读取磁盘上的目录
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed static
+var embedded embed.FS
+
+// indexFile 单页应用的入口
+const indexFile = "index.html"
+
+// 缓存策略：入口页面每次都要验证，其他资源可以缓存一段时间，开发模式下都不缓存
+const (
+	cacheIndex  = "no-cache"
+	cacheAssets = "public, max-age=3600"
+	cacheDev    = "no-store"
+)
+
+// securityHeaders 每个静态文件响应都带上的安全相关响应头
+var securityHeaders = map[string]string{
+	"Content-Security-Policy": "default-src 'self'; connect-src 'self' ws: wss:; img-src 'self' data:; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'",
+	"X-Content-Type-Options":  "nosniff",
+	"X-Frame-Options":         "DENY",
+	"Referrer-Policy":         "same-origin",
+}
+
+// Handler 静态文件服务
+type Handler struct {
+	files fs.FS
+	dev   bool
+
+	// 编译进二进制的文件不会变化，ETag 只需要计算一次
+	etagsMutex sync.Mutex
+	etags      map[string]string
+}
+
+// NewHandler 创建静态文件服务，dir 为空时使用编译进二进制的文件，否则每次请求都从磁盘读取 dir
+func NewHandler(dir string) *Handler {
+	if dir != "" {
+		return &Handler{files: os.DirFS(dir), dev: true}
+	}
+
+	files, err := fs.Sub(embedded, "static")
+	if err != nil {
+		panic(err)
+	}
+	return &Handler{files: files, etags: make(map[string]string)}
+}
+
+// ServeHTTP 返回请求的文件，找不到且路径不像文件时返回入口页面，交给前端路由处理
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for key, value := range securityHeaders {
+		w.Header().Set(key, value)
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "只支持GET方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = indexFile
+	}
+
+	data, err := fs.ReadFile(h.files, name)
+	if err != nil {
+		// 带扩展名的路径是在找某个资源，确实不存在
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		name = indexFile
+		if data, err = fs.ReadFile(h.files, name); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	switch {
+	case h.dev:
+		w.Header().Set("Cache-Control", cacheDev)
+	case name == indexFile:
+		w.Header().Set("Cache-Control", cacheIndex)
+	default:
+		w.Header().Set("Cache-Control", cacheAssets)
+	}
+	w.Header().Set("ETag", h.etag(name, data))
+
+	// ServeContent 按扩展名设置 Content-Type，并处理 If-None-Match 和 Range
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+}
+
+// etag 根据文件内容计算强 ETag
+func (h *Handler) etag(name string, data []byte) string {
+	if h.etags == nil {
+		return contentETag(data)
+	}
+
+	h.etagsMutex.Lock()
+	defer h.etagsMutex.Unlock()
+
+	etag, ok := h.etags[name]
+	if !ok {
+		etag = contentETag(data)
+		h.etags[name] = etag
+	}
+	return etag
+}
+
+// contentETag 取内容 SHA-256 的前16个字节
+func contentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
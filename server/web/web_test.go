@@ -0,0 +1,108 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// get 向处理器发送请求并返回响应
+func get(h http.Handler, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestEmbedded(t *testing.T) {
+	h := NewHandler("")
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		cache       string
+	}{
+		{"/", http.StatusOK, "text/html", cacheIndex},
+		{"/index.html", http.StatusOK, "text/html", cacheIndex},
+		{"/js/game.js", http.StatusOK, "javascript", cacheAssets},
+		{"/css/style.css", http.StatusOK, "text/css", cacheAssets},
+		{"/game/123", http.StatusOK, "text/html", cacheIndex},
+		{"/js/missing.js", http.StatusNotFound, "", ""},
+		{"/../main.go", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		w := get(h, tt.path, nil)
+		if w.Code != tt.status {
+			t.Errorf("%s: 状态码 %d，应为 %d", tt.path, w.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.Contains(ct, tt.contentType) {
+			t.Errorf("%s: Content-Type %q", tt.path, ct)
+		}
+		if cc := w.Header().Get("Cache-Control"); cc != tt.cache {
+			t.Errorf("%s: Cache-Control %q，应为 %q", tt.path, cc, tt.cache)
+		}
+		for key, value := range securityHeaders {
+			if got := w.Header().Get(key); got != value {
+				t.Errorf("%s: %s %q，应为 %q", tt.path, key, got, value)
+			}
+		}
+	}
+
+	// 带上 ETag 再次请求时返回304
+	etag := get(h, "/js/game.js", nil).Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("缺少ETag")
+	}
+	if w := get(h, "/js/game.js", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: 状态码 %d，应为304", w.Code)
+	}
+	if get(h, "/css/style.css", nil).Header().Get("ETag") == etag {
+		t.Error("不同文件的ETag相同")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: 状态码 %d，应为405", w.Code)
+	}
+}
+
+func TestDevDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("index.html", "<p>v1</p>")
+	write("app.js", "v1")
+
+	h := NewHandler(dir)
+	first := get(h, "/app.js", nil)
+	if first.Body.String() != "v1" || first.Header().Get("Cache-Control") != cacheDev {
+		t.Fatalf("app.js: %q %q", first.Body.String(), first.Header().Get("Cache-Control"))
+	}
+
+	// 修改后的文件立即生效，ETag 随之变化
+	write("app.js", "v2")
+	second := get(h, "/app.js", http.Header{"If-None-Match": {first.Header().Get("ETag")}})
+	if second.Code != http.StatusOK || second.Body.String() != "v2" {
+		t.Errorf("修改后: %d %q", second.Code, second.Body.String())
+	}
+
+	if w := get(h, "/lobby", nil); w.Body.String() != "<p>v1</p>" {
+		t.Errorf("前端路由应返回入口页面: %q", w.Body.String())
+	}
+}